@@ -0,0 +1,322 @@
+package collectd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// AggregationFields is a set of identifier fields that value lists
+// are grouped by.
+type AggregationFields int
+
+// The fields that value lists can be grouped by.
+const (
+	GroupByHost AggregationFields = 1 << iota
+	GroupByPlugin
+	GroupByPluginInstance
+	GroupByTypeInstance
+)
+
+// Aggregation selects value lists and the statistics computed over
+// them, like an Aggregation block of collectd's aggregation plugin.
+// The values of the selected value lists are grouped by the fields in
+// GroupBy and their type, and each group yields one value list per
+// statistic and interval.
+//
+// The identifiers of the results are derived like in collectd. The
+// host is the group's host, or "global" when not grouping by host.
+// The plugin is "aggregation". The plugin instance consists of the
+// group's plugin and plugin instance, as far as they are grouped by,
+// and the name of the statistic, such as "cpu-average". The type
+// instance is the group's type instance, if grouped by. The Set
+// fields override the respective parts.
+type Aggregation struct {
+	// Match selects value lists. Its fields are matched against
+	// those of identifiers using path.Match; empty fields match
+	// everything. Selected value lists must have a single value.
+	Match Identifier
+	// GroupBy are the fields that value lists are grouped by.
+	GroupBy AggregationFields
+
+	SetHost           string
+	SetPlugin         string
+	SetPluginInstance string
+	SetTypeInstance   string
+
+	// The statistics to compute. Values are converted to rates,
+	// as by RateCache, before being aggregated.
+	CalculateNum     bool
+	CalculateSum     bool
+	CalculateAverage bool
+	CalculateMinimum bool
+	CalculateMaximum bool
+	CalculateStddev  bool
+}
+
+func (agg *Aggregation) match(id Identifier) bool {
+	return matchIdentifier(agg.Match, id)
+}
+
+// group returns the identifier of the group of id, without the name
+// of a statistic.
+func (agg *Aggregation) group(id Identifier) Identifier {
+	out := Identifier{Host: "global", Plugin: "aggregation", Type: id.Type}
+	if agg.GroupBy&GroupByHost != 0 {
+		out.Host = id.Host
+	}
+	var plugin, pluginInstance string
+	if agg.GroupBy&GroupByPlugin != 0 {
+		plugin = id.Plugin
+	}
+	if agg.GroupBy&GroupByPluginInstance != 0 {
+		pluginInstance = id.PluginInstance
+	}
+	out.PluginInstance = joinNonEmpty(plugin, pluginInstance)
+	if agg.GroupBy&GroupByTypeInstance != 0 {
+		out.TypeInstance = id.TypeInstance
+	}
+	if agg.SetHost != "" {
+		out.Host = agg.SetHost
+	}
+	if agg.SetPlugin != "" {
+		out.Plugin = agg.SetPlugin
+	}
+	if agg.SetPluginInstance != "" {
+		out.PluginInstance = agg.SetPluginInstance
+	}
+	if agg.SetTypeInstance != "" {
+		out.TypeInstance = agg.SetTypeInstance
+	}
+	return out
+}
+
+func joinNonEmpty(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "-" + b
+	}
+}
+
+type aggKey struct {
+	agg int
+	id  Identifier
+}
+
+type aggGroup struct {
+	dsType   DSType
+	num      int
+	sum      float64
+	squares  float64
+	min, max float64
+	// states holds the state of converting each statistic back to
+	// the group's data source type.
+	states map[string]*rateState
+}
+
+// Aggregator is a Writer that aggregates the value lists written to
+// it according to its aggregations, and periodically writes the
+// results to another writer while Run is running. Value lists that
+// match no aggregation are dropped.
+type Aggregator struct {
+	Aggregations []Aggregation
+	// Next receives the aggregated value lists.
+	Next Writer
+	// Interval is the interval at which results are written. It
+	// defaults to ten seconds.
+	Interval time.Duration
+
+	rates RateCache
+
+	errs   health.ErrorTracker
+	failed atomic.Bool
+
+	mu     sync.Mutex
+	groups map[aggKey]*aggGroup
+}
+
+var _ Writer = (*Aggregator)(nil)
+
+// Write adds vl to the groups of all matching aggregations. Values
+// whose rate is not known yet, such as the first value of a derive,
+// are skipped.
+func (a *Aggregator) Write(ctx context.Context, vl ValueList) error {
+	var matches []int
+	for i := range a.Aggregations {
+		if a.Aggregations[i].match(vl.Identifier) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	if len(vl.Values) != 1 {
+		return fmt.Errorf("aggregation of %s requires a single value, got %d", vl.Identifier, len(vl.Values))
+	}
+	rates, err := a.rates.Rates(vl)
+	if err != nil {
+		return err
+	}
+	r := rates[0]
+	if math.IsNaN(r) {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.groups == nil {
+		a.groups = map[aggKey]*aggGroup{}
+	}
+	for _, i := range matches {
+		key := aggKey{i, a.Aggregations[i].group(vl.Identifier)}
+		g, ok := a.groups[key]
+		if !ok {
+			g = &aggGroup{dsType: vl.Values[0].DSType(), states: map[string]*rateState{}}
+			g.reset()
+			a.groups[key] = g
+		}
+		g.num++
+		g.sum += r
+		g.squares += r * r
+		if math.IsNaN(g.min) || r < g.min {
+			g.min = r
+		}
+		if math.IsNaN(g.max) || r > g.max {
+			g.max = r
+		}
+	}
+	return nil
+}
+
+func (g *aggGroup) reset() {
+	g.num, g.sum, g.squares = 0, 0, 0
+	g.min, g.max = math.NaN(), math.NaN()
+}
+
+// Run writes the aggregated values every interval until ctx is
+// canceled. Groups are kept across intervals, so that statistics are
+// written even for intervals without values; Num and Sum are then 0
+// and the others are NaN. Run returns ctx.Err().
+func (a *Aggregator) Run(ctx context.Context) error {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return Schedule{Interval: interval}.Run(ctx, func(ctx context.Context, t time.Time) {
+		for _, vl := range a.collect(t, interval) {
+			err := a.Next.Write(ctx, vl)
+			a.errs.Track(err)
+			a.failed.Store(err != nil)
+		}
+	})
+}
+
+// collect returns the results of all groups and resets them.
+func (a *Aggregator) collect(t time.Time, interval time.Duration) []ValueList {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var out []ValueList
+	for key, g := range a.groups {
+		agg := &a.Aggregations[key.agg]
+		n := float64(g.num)
+		avg := g.sum / n
+		for _, stat := range [...]struct {
+			enabled bool
+			name    string
+			value   float64
+		}{
+			{agg.CalculateNum, "num", n},
+			{agg.CalculateSum, "sum", g.sum},
+			{agg.CalculateAverage, "average", avg},
+			{agg.CalculateMinimum, "minimum", g.min},
+			{agg.CalculateMaximum, "maximum", g.max},
+			{agg.CalculateStddev, "stddev", math.Sqrt(g.squares/n - avg*avg)},
+		} {
+			if !stat.enabled {
+				continue
+			}
+			st, ok := g.states[stat.name]
+			if !ok {
+				st = &rateState{}
+				g.states[stat.name] = st
+			}
+			v, ok := st.value(stat.value, g.dsType, t)
+			if !ok {
+				continue
+			}
+			id := key.id
+			id.PluginInstance = joinNonEmpty(id.PluginInstance, stat.name)
+			out = append(out, ValueList{Identifier: id, Time: t, Interval: interval, Values: []Value{v}})
+		}
+		g.reset()
+	}
+	return out
+}
+
+// Health reports the Aggregator as connected if the most recent write
+// of a result succeeded.
+func (a *Aggregator) Health() Health {
+	err, when := a.errs.Last()
+	return Health{Healthy: true, Connected: !a.failed.Load(), LastError: err, LastErrorTime: when}
+}
+
+// rateState converts rates back to values of a data source type, like
+// collectd's rate_to_value.
+type rateState struct {
+	last     Value
+	lastTime time.Time
+	residual float64
+}
+
+// value returns the value of a data source of type typ that has
+// changed at rate since the previous call. It reports false if there
+// is no value yet, or if rate is invalid for typ.
+func (s *rateState) value(rate float64, typ DSType, t time.Time) (Value, bool) {
+	if typ == DSTypeGauge {
+		return Gauge(rate), true
+	}
+	if math.IsNaN(rate) || (rate < 0 && typ != DSTypeDerive) {
+		*s = rateState{}
+		return nil, false
+	}
+	if s.lastTime.IsZero() {
+		s.last, s.residual = integral(typ, rate, nil)
+		s.lastTime = t
+		return nil, false
+	}
+	delta := rate*t.Sub(s.lastTime).Seconds() + s.residual
+	s.last, s.residual = integral(typ, delta, s.last)
+	s.lastTime = t
+	return s.last, true
+}
+
+// integral adds the integral part of delta to prev, which may be nil,
+// and returns the sum and the fractional remainder. Absolute values
+// are not summed.
+func integral(typ DSType, delta float64, prev Value) (Value, float64) {
+	switch typ {
+	case DSTypeDerive:
+		d := Derive(delta)
+		if p, ok := prev.(Derive); ok {
+			return p + d, delta - float64(d)
+		}
+		return d, delta - float64(d)
+	case DSTypeCounter:
+		c := Counter(delta)
+		if p, ok := prev.(Counter); ok {
+			return p + c, delta - float64(c)
+		}
+		return c, delta - float64(c)
+	default:
+		a := Absolute(delta)
+		return a, delta - float64(a)
+	}
+}
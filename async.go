@@ -0,0 +1,153 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+var (
+	// ErrQueueFull is returned by AsyncWriter.Write when the queue
+	// has no room for another value list.
+	ErrQueueFull = errors.New("collectd: queue full")
+	// ErrClosed is returned when using a writer that has been
+	// closed.
+	ErrClosed = errors.New("collectd: writer closed")
+)
+
+type asyncItem struct {
+	vl     ValueList
+	queued time.Time
+	flush  chan struct{}
+}
+
+// AsyncWriter is a Writer that queues value lists in a bounded queue
+// and submits them from a background goroutine, so that callers never
+// block on the underlying writer.
+type AsyncWriter struct {
+	w       Writer
+	onError func(ValueList, error)
+	queue   chan asyncItem
+	done    chan struct{}
+
+	errs   health.ErrorTracker
+	failed atomic.Bool
+	lag    atomic.Int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+var _ Writer = (*AsyncWriter)(nil)
+
+// NewAsyncWriter returns an AsyncWriter that queues up to size value
+// lists before submitting them to w. If size is not positive, it
+// defaults to 64. Because submission happens in the background,
+// errors are reported by calling onError, which may be nil.
+func NewAsyncWriter(w Writer, size int, onError func(ValueList, error)) *AsyncWriter {
+	if size <= 0 {
+		size = 64
+	}
+	a := &AsyncWriter{
+		w:       w,
+		onError: onError,
+		queue:   make(chan asyncItem, size),
+		done:    make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for item := range a.queue {
+		if item.flush != nil {
+			close(item.flush)
+			continue
+		}
+		a.lag.Store(int64(time.Since(item.queued)))
+		err := a.w.Write(context.Background(), item.vl)
+		a.errs.Track(err)
+		a.failed.Store(err != nil)
+		if err != nil && a.onError != nil {
+			a.onError(item.vl, err)
+		}
+	}
+}
+
+// Write queues vl for submission. It never blocks and returns
+// ErrQueueFull if the queue is full.
+func (a *AsyncWriter) Write(ctx context.Context, vl ValueList) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return ErrClosed
+	}
+	select {
+	case a.queue <- asyncItem{vl: vl, queued: time.Now()}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Flush waits until all value lists queued before the call have been
+// submitted, or ctx is canceled.
+func (a *AsyncWriter) Flush(ctx context.Context) error {
+	ch := make(chan struct{})
+	a.mu.RLock()
+	if a.closed {
+		a.mu.RUnlock()
+		return ErrClosed
+	}
+	select {
+	case a.queue <- asyncItem{flush: ch}:
+		a.mu.RUnlock()
+	case <-ctx.Done():
+		a.mu.RUnlock()
+		return ctx.Err()
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Health reports the state of the queue. The writer is considered
+// connected if the most recent submission succeeded, and unhealthy
+// once closed.
+func (a *AsyncWriter) Health() Health {
+	a.mu.RLock()
+	closed := a.closed
+	a.mu.RUnlock()
+	err, when := a.errs.Last()
+	return Health{
+		Healthy:       !closed,
+		Connected:     !a.failed.Load(),
+		LastError:     err,
+		LastErrorTime: when,
+		Queued:        len(a.queue),
+		Lag:           time.Duration(a.lag.Load()),
+	}
+}
+
+// Close stops accepting new value lists and waits until all queued
+// ones have been submitted. It does not close the underlying writer.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return ErrClosed
+	}
+	a.closed = true
+	close(a.queue)
+	a.mu.Unlock()
+	<-a.done
+	return nil
+}
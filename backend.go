@@ -0,0 +1,285 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Backend stores values on behalf of a Server. Use BackendHandler
+// to serve a Backend. A Backend that also implements
+// NotificationWriter receives PUTNOTIF commands.
+type Backend interface {
+	// GetValue returns the current values of id, keyed by data
+	// source name.
+	GetValue(ctx context.Context, id Identifier) (map[string]float64, error)
+	// ListValues returns all known identifiers and the time of
+	// their last update.
+	ListValues(ctx context.Context) ([]ListEntry, error)
+	// PutValue stores a value list.
+	PutValue(ctx context.Context, vl ValueList) error
+	// Flush flushes values older than timeout, or all values if
+	// timeout is negative, optionally limited to plugins and ids.
+	Flush(ctx context.Context, timeout time.Duration, plugins []string, ids []Identifier) error
+}
+
+// BackendHandler returns a Handler that implements the plain text
+// protocol on top of b.
+func BackendHandler(b Backend) Handler {
+	return HandlerFunc(func(ctx context.Context, cmd Command) ([]string, error) {
+		switch cmd := cmd.(type) {
+		case *PutvalCommand:
+			for _, vl := range cmd.ValueLists {
+				if err := b.PutValue(ctx, vl); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		case *PutnotifCommand:
+			if nw, ok := b.(NotificationWriter); ok {
+				return nil, nw.WriteNotification(ctx, cmd.Notification)
+			}
+			return nil, nil
+		case *GetvalCommand:
+			vals, err := b.GetValue(ctx, cmd.Identifier)
+			if err != nil {
+				return nil, err
+			}
+			names := make([]string, 0, len(vals))
+			for name := range vals {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			lines := make([]string, len(names))
+			for i, name := range names {
+				lines[i] = name + "=" + strconv.FormatFloat(vals[name], 'e', -1, 64)
+			}
+			return lines, nil
+		case *ListvalCommand:
+			entries, err := b.ListValues(ctx)
+			if err != nil {
+				return nil, err
+			}
+			lines := make([]string, len(entries))
+			for i, e := range entries {
+				lines[i] = formatTime(e.LastUpdate, 3) + " " + e.Identifier.String()
+			}
+			return lines, nil
+		case *FlushCommand:
+			return nil, b.Flush(ctx, cmd.Timeout, cmd.Plugins, cmd.Identifiers)
+		default:
+			return nil, fmt.Errorf("unsupported command %T", cmd)
+		}
+	})
+}
+
+// WriterHandler returns a Handler that passes PUTVAL commands to w,
+// and PUTNOTIF commands too if w is a NotificationWriter. FLUSH calls
+// w's Flush method if it has one. w can't be queried, so GETVAL finds
+// no values and LISTVAL lists none.
+func WriterHandler(w Writer) Handler {
+	return HandlerFunc(func(ctx context.Context, cmd Command) ([]string, error) {
+		switch cmd := cmd.(type) {
+		case *PutvalCommand:
+			for _, vl := range cmd.ValueLists {
+				if err := w.Write(ctx, vl); err != nil {
+					return nil, err
+				}
+			}
+			return nil, nil
+		case *PutnotifCommand:
+			if nw, ok := w.(NotificationWriter); ok {
+				return nil, nw.WriteNotification(ctx, cmd.Notification)
+			}
+			return nil, nil
+		case *GetvalCommand:
+			return nil, errors.New("No such value")
+		case *ListvalCommand:
+			return nil, nil
+		case *FlushCommand:
+			if f, ok := w.(interface{ Flush(context.Context) error }); ok {
+				return nil, f.Flush(ctx)
+			}
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("unsupported command %T", cmd)
+		}
+	})
+}
+
+// MemoryBackend is a Backend that keeps the most recent value list of
+// each identifier in memory. Like collectd, it rejects values that
+// are not newer than the ones it already has. The zero value is ready
+// to use.
+type MemoryBackend struct {
+	// TypesDB provides data source names for GetValue. Without it,
+	// a single value is called "value" and multiple values "value0",
+	// "value1" and so on.
+	TypesDB TypesDB
+	// Timeout is the number of intervals without updates after
+	// which CheckTimeouts considers a value missing, like collectd's
+	// Timeout option. It defaults to 2.
+	Timeout int
+	// Notifications, if not nil, receives a failure notification
+	// when a value goes missing and an okay notification when it is
+	// updated again, with the same messages as collectd.
+	Notifications NotificationWriter
+
+	mu   sync.RWMutex
+	vals map[Identifier]memEntry
+}
+
+type memEntry struct {
+	vl ValueList
+	// updated is the time the entry was stored, which, unlike the
+	// value list's time, is not subject to clock skew of the
+	// sender.
+	updated time.Time
+	missing bool
+}
+
+var _ Backend = (*MemoryBackend)(nil)
+
+// GetValue implements Backend.
+func (m *MemoryBackend) GetValue(ctx context.Context, id Identifier) (map[string]float64, error) {
+	m.mu.RLock()
+	e, ok := m.vals[id]
+	m.mu.RUnlock()
+	if !ok || e.missing {
+		return nil, errors.New("No such value")
+	}
+	vl := e.vl
+	names := m.TypesDB.DSNames(vl)
+	out := make(map[string]float64, len(vl.Values))
+	for i, v := range vl.Values {
+		out[names[i]] = valueFloat(v)
+	}
+	return out, nil
+}
+
+// ListValues implements Backend.
+func (m *MemoryBackend) ListValues(ctx context.Context) ([]ListEntry, error) {
+	m.mu.RLock()
+	out := make([]ListEntry, 0, len(m.vals))
+	for id, e := range m.vals {
+		if !e.missing {
+			out = append(out, ListEntry{Identifier: id, LastUpdate: e.vl.Time})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Identifier.String() < out[j].Identifier.String()
+	})
+	return out, nil
+}
+
+// PutValue implements Backend. Value lists without a time are stored
+// with the current time. Errors of the notification about a missing
+// value being updated again are ignored.
+func (m *MemoryBackend) PutValue(ctx context.Context, vl ValueList) error {
+	if vl.Time.IsZero() {
+		vl.Time = time.Now()
+	}
+	now := time.Now()
+	m.mu.Lock()
+	old, ok := m.vals[vl.Identifier]
+	if ok && !vl.Time.After(old.vl.Time) {
+		m.mu.Unlock()
+		return fmt.Errorf("value too old: name = %s; value time = %s; last cache update = %s",
+			vl.Identifier, formatTime(vl.Time, 3), formatTime(old.vl.Time, 3))
+	}
+	if m.vals == nil {
+		m.vals = map[Identifier]memEntry{}
+	}
+	m.vals[vl.Identifier] = memEntry{vl: vl, updated: now}
+	m.mu.Unlock()
+	if ok && old.missing && m.Notifications != nil {
+		// The value list has been stored, which is what the caller
+		// is interested in.
+		m.Notifications.WriteNotification(ctx, Notification{
+			Identifier: vl.Identifier,
+			Severity:   SeverityOkay,
+			Time:       vl.Time,
+			Message: fmt.Sprintf("Received a value for %s. It was missing for %.3f seconds.",
+				vl.Identifier, now.Sub(old.updated).Seconds()),
+		})
+	}
+	return nil
+}
+
+// CheckTimeouts marks values that haven't been updated for Timeout
+// times their interval as missing, sending failure notifications for
+// them. Missing values are omitted by GetValue and ListValues until
+// they are updated again. Errors of Notifications are returned. Call
+// CheckTimeouts periodically, for example with a Schedule, to detect
+// values that stop being updated, like collectd does after every read
+// cycle.
+func (m *MemoryBackend) CheckTimeouts(ctx context.Context) error {
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = 2
+	}
+	now := time.Now()
+	var ns []Notification
+	m.mu.Lock()
+	for id, e := range m.vals {
+		if e.missing {
+			continue
+		}
+		interval := e.vl.Interval
+		if interval <= 0 {
+			interval = 10 * time.Second
+		}
+		age := now.Sub(e.updated)
+		if age < time.Duration(timeout)*interval {
+			continue
+		}
+		e.missing = true
+		m.vals[id] = e
+		ns = append(ns, Notification{
+			Identifier: id,
+			Severity:   SeverityFailure,
+			Time:       now,
+			Message:    fmt.Sprintf("%s has not been updated for %.3f seconds.", id, age.Seconds()),
+		})
+	}
+	m.mu.Unlock()
+	if m.Notifications == nil {
+		return nil
+	}
+	sort.Slice(ns, func(i, j int) bool {
+		return ns[i].Identifier.String() < ns[j].Identifier.String()
+	})
+	var errs []error
+	for _, n := range ns {
+		errs = append(errs, m.Notifications.WriteNotification(ctx, n))
+	}
+	return errors.Join(errs...)
+}
+
+// Flush implements Backend. Values are always current, so flushing is
+// a no-op.
+func (m *MemoryBackend) Flush(ctx context.Context, timeout time.Duration, plugins []string, ids []Identifier) error {
+	return nil
+}
+
+// valueFloat returns v as a float64.
+func valueFloat(v Value) float64 {
+	switch v := v.(type) {
+	case Gauge:
+		return float64(v)
+	case Derive:
+		return float64(v)
+	case Counter:
+		return float64(v)
+	case Absolute:
+		return float64(v)
+	default:
+		return math.NaN()
+	}
+}
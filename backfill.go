@@ -0,0 +1,95 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backfill submits historical value lists, for example when
+// importing data after an outage or from another system. Value lists
+// are submitted in chronological order, optionally rate limited and
+// separated by flush barriers. Values that collectd rejects for being
+// older than what it already has are skipped.
+type Backfill struct {
+	Writer Writer
+	// Rate is the maximum number of value lists submitted per
+	// second. Zero means no limit.
+	Rate float64
+	// FlushEvery causes Flush to be called after every FlushEvery
+	// value lists, and once at the end. Zero disables flushing.
+	FlushEvery int
+	// Flush is the barrier used by FlushEvery, typically a call to
+	// Conn.Flush.
+	Flush func(ctx context.Context) error
+}
+
+// BackfillResult summarizes a backfill.
+type BackfillResult struct {
+	// Written is the number of value lists that were accepted.
+	Written int
+	// TooOld is the number of value lists that were skipped because
+	// they were older than existing data.
+	TooOld int
+}
+
+// Run submits vls. All value lists must have explicit timestamps. Run
+// stops at the first error other than a value being too old.
+func (b *Backfill) Run(ctx context.Context, vls []ValueList) (BackfillResult, error) {
+	var res BackfillResult
+	sorted := make([]ValueList, len(vls))
+	copy(sorted, vls)
+	for _, vl := range sorted {
+		if vl.Time.IsZero() {
+			return res, fmt.Errorf("backfill: value list %s has no timestamp", vl.Identifier)
+		}
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	start := time.Now()
+	for i, vl := range sorted {
+		if b.Rate > 0 {
+			due := start.Add(time.Duration(float64(i) / b.Rate * float64(time.Second)))
+			if d := time.Until(due); d > 0 {
+				t := time.NewTimer(d)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					return res, ctx.Err()
+				}
+			}
+		}
+		if err := b.Writer.Write(ctx, vl); err != nil {
+			if !IsTooOld(err) {
+				return res, err
+			}
+			res.TooOld++
+		} else {
+			res.Written++
+		}
+		if b.FlushEvery > 0 && b.Flush != nil && (i+1)%b.FlushEvery == 0 {
+			if err := b.Flush(ctx); err != nil {
+				return res, err
+			}
+		}
+	}
+	if b.FlushEvery > 0 && b.Flush != nil && len(sorted)%b.FlushEvery != 0 {
+		if err := b.Flush(ctx); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+// IsTooOld reports whether err is collectd's rejection of a value
+// that is not newer than the last value it has for the identifier.
+func IsTooOld(err error) bool {
+	var e Error
+	return errors.As(err, &e) && strings.Contains(strings.ToLower(e.Err.Error()), "too old")
+}
@@ -0,0 +1,198 @@
+package collectd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// BatchError reports the errors of individual value lists of a
+// batch. Errors is indexed like the batch; value lists that were
+// submitted successfully have a nil error.
+type BatchError struct {
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	var parts []string
+	for i, err := range e.Errors {
+		if err != nil {
+			parts = append(parts, fmt.Sprintf("value list %d: %s", i, err))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap returns the non-nil errors.
+func (e *BatchError) Unwrap() []error {
+	var out []error
+	for _, err := range e.Errors {
+		if err != nil {
+			out = append(out, err)
+		}
+	}
+	return out
+}
+
+// WriteBatch submits several value lists, pipelining the PUTVAL
+// commands to avoid one round trip per value list. If any of them
+// fail, the returned error is a *BatchError.
+func (c *Conn) WriteBatch(ctx context.Context, vls []ValueList) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	cmds := make([]string, len(vls))
+	for i, vl := range vls {
+		if err := checkValueList(vl); err != nil {
+			return err
+		}
+		cmds[i] = formatPutval(vl, c.precision)
+	}
+	var errs []error
+	for i, r := range c.pipeline(ctx, cmds) {
+		if r.err != nil {
+			if errs == nil {
+				errs = make([]error, len(vls))
+			}
+			errs[i] = r.err
+		}
+	}
+	if errs != nil {
+		return &BatchError{Errors: errs}
+	}
+	return nil
+}
+
+// A BatchWriter submits several value lists at once. Conn and
+// Redialer are BatchWriters.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, vls []ValueList) error
+}
+
+// Batcher is a Writer that coalesces value lists and submits them as
+// one batch once either a number of value lists has accumulated or an
+// interval has passed, greatly reducing the number of system calls
+// when exporting many values.
+type Batcher struct {
+	w       BatchWriter
+	size    int
+	onError func([]ValueList, error)
+	stop    chan struct{}
+	done    chan struct{}
+
+	errs health.ErrorTracker
+
+	mu      sync.Mutex
+	pending []ValueList
+	closed  bool
+}
+
+var _ Writer = (*Batcher)(nil)
+
+// NewBatcher returns a Batcher that submits value lists to w in
+// batches of up to size, and at least every interval. If interval is
+// not positive, it defaults to ten seconds. Errors of batches
+// submitted in the background are reported by calling onError, which
+// may be nil.
+func NewBatcher(w BatchWriter, size int, interval time.Duration, onError func([]ValueList, error)) *Batcher {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	b := &Batcher{
+		w:       w,
+		size:    size,
+		onError: onError,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.run(interval)
+	return b
+}
+
+func (b *Batcher) run(interval time.Duration) {
+	defer close(b.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			b.Flush(context.Background())
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Write adds vl to the current batch. If that fills the batch, it is
+// submitted before Write returns.
+func (b *Batcher) Write(ctx context.Context, vl ValueList) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.pending = append(b.pending, vl)
+	if len(b.pending) < b.size {
+		b.mu.Unlock()
+		return nil
+	}
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	return b.submit(ctx, batch)
+}
+
+// Flush submits the current batch.
+func (b *Batcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return b.submit(ctx, batch)
+}
+
+func (b *Batcher) submit(ctx context.Context, batch []ValueList) error {
+	err := b.w.WriteBatch(ctx, batch)
+	b.errs.Track(err)
+	if err != nil && b.onError != nil {
+		b.onError(batch, err)
+	}
+	return err
+}
+
+// Health reports the health of the underlying writer, if it is a
+// HealthReporter, together with the number of value lists in the
+// current batch.
+func (b *Batcher) Health() Health {
+	h := Health{Healthy: true, Connected: true}
+	if hr, ok := b.w.(HealthReporter); ok {
+		h = hr.Health()
+	}
+	h.LastError, h.LastErrorTime = b.errs.Last()
+	b.mu.Lock()
+	h.Queued = len(b.pending)
+	b.mu.Unlock()
+	return h
+}
+
+// Close submits the current batch and stops the background flushing.
+// It does not close the underlying writer.
+func (b *Batcher) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrClosed
+	}
+	b.closed = true
+	b.mu.Unlock()
+	close(b.stop)
+	<-b.done
+	return b.Flush(context.Background())
+}
@@ -0,0 +1,69 @@
+// Package cdtime implements collectd's high resolution time format, a
+// fixed-point number in units of 2^-30 seconds.
+package cdtime // import "honnef.co/go/collectd/cdtime"
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time is a point in time in units of 2^-30 seconds since the Unix
+// epoch, or a duration in units of 2^-30 seconds.
+type Time uint64
+
+const fracMask = 1<<30 - 1
+
+// New converts t to a Time. Times before the Unix epoch, including
+// the zero time.Time, are converted to 0.
+func New(t time.Time) Time {
+	if t.Unix() < 0 {
+		return 0
+	}
+	return fromParts(uint64(t.Unix()), uint64(t.Nanosecond()))
+}
+
+// NewDuration converts d to a Time. Negative durations are converted
+// to 0.
+func NewDuration(d time.Duration) Time {
+	if d < 0 {
+		return 0
+	}
+	return fromParts(uint64(d/time.Second), uint64(d%time.Second))
+}
+
+// fromParts rounds to the nearest representable time, like collectd.
+func fromParts(sec, nsec uint64) Time {
+	return Time(sec<<30 | (nsec<<30+5e8)/1e9)
+}
+
+// nanoseconds returns the fractional part of t in nanoseconds,
+// rounded like collectd does.
+func (t Time) nanoseconds() int64 {
+	return int64((uint64(t)&fracMask*1e9 + 1<<29) >> 30)
+}
+
+// Time converts t to a time.Time. 0 is converted to the zero
+// time.Time.
+func (t Time) Time() time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(t>>30), t.nanoseconds())
+}
+
+// Duration converts t to a time.Duration.
+func (t Time) Duration() time.Duration {
+	return time.Duration(t>>30)*time.Second + time.Duration(t.nanoseconds())
+}
+
+// String formats t as seconds with up to nine decimal places.
+func (t Time) String() string {
+	s := strconv.FormatUint(uint64(t>>30), 10)
+	ns := t.nanoseconds()
+	if ns == 0 {
+		return s
+	}
+	frac := strconv.FormatInt(1e9+ns, 10)[1:]
+	return s + "." + strings.TrimRight(frac, "0")
+}
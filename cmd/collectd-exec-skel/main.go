@@ -0,0 +1,85 @@
+// Command collectd-exec-skel generates the main package of a collectd
+// exec plugin, built on package honnef.co/go/collectd/exec.
+//
+// Usage:
+//
+//	collectd-exec-skel [-plugin name] [-f] dir
+//
+// It writes dir/main.go, which reads an example value once per
+// interval and can be built right away. The plugin name defaults to
+// the base name of dir.
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+//go:embed main.go.tmpl
+var tmplText string
+
+var tmpl = template.Must(template.New("main.go").Parse(tmplText))
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("collectd-exec-skel: ")
+	plugin := flag.String("plugin", "", "name of the collectd plugin (default: base name of dir)")
+	force := flag.Bool("f", false, "overwrite an existing main.go")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: collectd-exec-skel [-plugin name] [-f] dir")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := flag.Arg(0)
+	name := *plugin
+	if name == "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name = filepath.Base(abs)
+	}
+	if name == "" || strings.ContainsAny(name, "/-\" \t") {
+		log.Fatalf("invalid plugin name %q; it must not contain slashes, dashes, quotes or spaces", name)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, struct{ Plugin string }{name}); err != nil {
+		log.Fatal(err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	path := filepath.Join(dir, "main.go")
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !*force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0o644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := f.Write(src); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("wrote", path)
+}
@@ -2,18 +2,59 @@ package collectd // import "honnef.co/go/collectd"
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	"honnef.co/go/collectd/internal/health"
 )
 
 type Conn struct {
-	w io.WriteCloser
-	r *bufio.Reader
+	mu sync.Mutex
+	w  io.WriteCloser
+	r  *bufio.Reader
+
+	logger *slog.Logger
+	hooks  []Hook
+
+	limiter   *tokenBucket
+	precision int
+	trace     io.Writer
+
+	errs   health.ErrorTracker
+	broken atomic.Bool
+}
+
+// A Hook observes the commands sent over a connection, for example
+// to record tracing spans or metrics.
+type Hook interface {
+	// BeforeCommand is called before command is written to the
+	// connection.
+	BeforeCommand(command string)
+	// AfterCommand is called after the response to command has been
+	// read, or sending it failed. d is the time it took and err the
+	// error, if any, that the command resulted in.
+	AfterCommand(command string, d time.Duration, err error)
+}
+
+// An Option configures a connection.
+type Option func(*Conn)
+
+// WithLogger causes the connection to log every command it sends,
+// collectd's response status and the command's latency to l at
+// debug level.
+func WithLogger(l *slog.Logger) Option {
+	return func(c *Conn) {
+		c.logger = l
+	}
 }
 
 // IOError wraps errors that happen while reading or writing. It often
@@ -26,25 +67,109 @@ type IOError struct {
 // processing collectd's response.
 type Error struct {
 	Err error
+	// Command is the command that failed.
+	Command string
+	// Status is the negative status code returned by collectd, or
+	// zero if the error occurred while processing the response.
+	Status int
 }
 
 func (e IOError) Error() string {
 	return e.Err.Error()
 }
 
+func (e IOError) Unwrap() error {
+	return e.Err
+}
+
 func (e Error) Error() string {
-	return e.Err.Error()
+	switch {
+	case e.Command == "":
+		return e.Err.Error()
+	case e.Status != 0:
+		return fmt.Sprintf("%s failed: %d %s", e.Command, e.Status, e.Err)
+	default:
+		return fmt.Sprintf("%s failed: %s", e.Command, e.Err)
+	}
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// ParseError describes a line of collectd's response that could not
+// be parsed. It is wrapped in an Error, or an IOError if the rest of
+// the response could not be read as a consequence.
+type ParseError struct {
+	Line string
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("could not parse response %q: %s", e.Line, e.Msg)
+}
+
+// WithHook registers a hook that is called for every command sent over
+// the connection. Multiple hooks are called in the order they were
+// registered.
+func WithHook(h Hook) Option {
+	return func(c *Conn) {
+		c.hooks = append(c.hooks, h)
+	}
+}
+
+// WithRateLimit limits the rate at which commands are sent to rate
+// commands per second, allowing bursts of up to burst commands.
+// Commands exceeding the limit block until they may be sent. This
+// protects collectd from callers that suddenly emit large numbers of
+// commands. WithRateLimit panics if rate is not positive.
+func WithRateLimit(rate float64, burst int) Option {
+	if !(rate > 0) {
+		panic("collectd: non-positive rate limit")
+	}
+	return func(c *Conn) {
+		c.limiter = newTokenBucket(rate, burst)
+	}
+}
+
+// WithTimePrecision sets the number of digits after the decimal
+// point of timestamps sent to collectd, between 0 and 9. The default
+// is 3, i.e. millisecond resolution.
+func WithTimePrecision(digits int) Option {
+	return func(c *Conn) {
+		c.precision = digits
+	}
+}
+
+// WithTrace copies all raw bytes written to and read from the
+// connection to w, one line per line of protocol traffic, prefixed
+// with a timestamp and > for data sent or < for data received. This
+// is meant for debugging protocol problems.
+func WithTrace(w io.Writer) Option {
+	return func(c *Conn) {
+		c.trace = w
+	}
 }
 
 // New creates a collectd connection. Usually you will want to use
 // DialUnix instead.
-func New(rw io.ReadWriteCloser) *Conn {
-	return &Conn{rw, bufio.NewReader(rw)}
+func New(rw io.ReadWriteCloser, opts ...Option) *Conn {
+	c := &Conn{precision: 3}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.trace != nil {
+		rw = &traceRW{rw: rw, w: c.trace}
+	}
+	c.w, c.r = rw, bufio.NewReader(rw)
+	return c
 }
 
-// DialUnix opens a unix socket and passes it to New.
-func DialUnix(name string) (*Conn, error) {
-	addr, err := net.ResolveUnixAddr("unix", name)
+// DialUnix opens a unix socket and passes it to New. On Linux, names
+// starting with @ or a NUL byte refer to sockets in the abstract
+// namespace.
+func DialUnix(name string, opts ...Option) (*Conn, error) {
+	addr, err := resolveUnix(name)
 	if err != nil {
 		return nil, IOError{err}
 	}
@@ -53,44 +178,180 @@ func DialUnix(name string) (*Conn, error) {
 		return nil, IOError{err}
 	}
 
-	return New(c), nil
+	return New(c, opts...), nil
 }
 
-func (c *Conn) readResponse() ([]string, error) {
-	var num int
-	_, err := fmt.Fscanf(c.r, "%d ", &num)
+// maxResponseLines bounds the number of lines we are willing to read
+// for a single response, protecting against corrupt counts.
+const maxResponseLines = 1 << 24
+
+// readLine reads a line, tolerating CRLF line endings. A final line
+// without line ending is reported as truncated.
+func (c *Conn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
 	if err != nil {
-		return nil, IOError{err}
+		if err == io.EOF && line != "" {
+			err = &ParseError{Line: line, Msg: "truncated line"}
+		}
+		return "", err
 	}
-	status, err := c.r.ReadString('\n')
+	line = strings.TrimSuffix(line[:len(line)-1], "\r")
+	return line, nil
+}
+
+func (c *Conn) readResponse() (status string, lines []string, err error) {
+	line, err := c.readLine()
 	if err != nil {
-		return nil, IOError{err}
+		return "", nil, IOError{err}
+	}
+	numStr, status, _ := strings.Cut(line, " ")
+	num, err := strconv.Atoi(numStr)
+	if err != nil {
+		// We can't know where the response ends, which leaves the
+		// connection unusable.
+		return "", nil, IOError{&ParseError{Line: line, Msg: "invalid status line"}}
 	}
 	if num < 0 {
-		return nil, Error{errors.New(status[:len(status)-1])}
+		return status, nil, Error{Err: errors.New(status), Status: num}
+	}
+	if num > maxResponseLines {
+		return status, nil, IOError{&ParseError{Line: line, Msg: "implausible number of lines"}}
 	}
 
-	out := make([]string, num)
+	out := make([]string, 0, min(num, 1024))
 	for i := 0; i < num; i++ {
-		resp, err := c.r.ReadString('\n')
+		resp, err := c.readLine()
 		if err != nil {
-			return out, IOError{err}
+			return status, out, IOError{err}
 		}
-
-		out[i] = resp[:len(resp)-1]
+		out = append(out, resp)
 	}
 
-	return out, nil
+	return status, out, nil
 }
 
 // SendCommand sends an arbitrary command to collectd.
 func (c *Conn) SendCommand(command string) ([]string, error) {
-	_, err := c.w.Write([]byte(command + "\n"))
-	if err != nil {
-		return nil, IOError{err}
+	return c.command(context.Background(), command)
+}
+
+func (c *Conn) command(ctx context.Context, command string) ([]string, error) {
+	res := c.pipeline(ctx, []string{command})
+	return res[0].lines, res[0].err
+}
+
+type response struct {
+	lines []string
+	err   error
+}
+
+// maxWindow and maxWindowBytes bound the number and size of the
+// commands that pipeline writes before reading their responses.
+const (
+	maxWindow      = 64
+	maxWindowBytes = 64 << 10
+)
+
+// pipeline sends commands in windows of up to maxWindow commands,
+// each in a single write followed by reading its responses, saving
+// round trips and system calls.
+func (c *Conn) pipeline(ctx context.Context, commands []string) []response {
+	res := make([]response, len(commands))
+	if c.limiter != nil {
+		for range commands {
+			if err := c.limiter.wait(ctx); err != nil {
+				for i := range res {
+					res[i].err = err
+				}
+				return res
+			}
+		}
 	}
 
-	return c.readResponse()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// The deadline is only set while holding the lock, so that it
+	// doesn't affect the commands of concurrent callers.
+	if dl, ok := ctx.Deadline(); ok {
+		if d, ok := c.w.(interface{ SetDeadline(time.Time) error }); ok {
+			d.SetDeadline(dl)
+			defer d.SetDeadline(time.Time{})
+		}
+	}
+	for _, command := range commands {
+		for _, h := range c.hooks {
+			h.BeforeCommand(command)
+		}
+	}
+	start := time.Now()
+	statuses := make([]string, len(commands))
+	// Commands are written in windows whose responses are read before
+	// the next window is written. Writing all commands at once would
+	// deadlock once the socket buffers in both directions are full, as
+	// collectd blocks writing responses that we don't read yet.
+	var window []int
+	var buf []byte
+	var ioErr error
+	flush := func() {
+		if len(window) == 0 {
+			return
+		}
+		if ioErr == nil {
+			if _, err := c.w.Write(buf); err != nil {
+				ioErr = IOError{err}
+			}
+		}
+		for _, i := range window {
+			if ioErr != nil {
+				res[i].err = ioErr
+				continue
+			}
+			statuses[i], res[i].lines, res[i].err = c.readResponse()
+			if e, ok := res[i].err.(Error); ok {
+				e.Command = commands[i]
+				res[i].err = e
+			}
+			if _, ok := res[i].err.(IOError); ok {
+				ioErr = res[i].err
+			}
+		}
+		window, buf = window[:0], buf[:0]
+	}
+	for i, command := range commands {
+		// Commands with line breaks would be split into several and
+		// desynchronize the responses, so they aren't sent at all.
+		if err := checkFields(command); err != nil {
+			res[i].err = err
+			continue
+		}
+		window = append(window, i)
+		buf = append(buf, command...)
+		buf = append(buf, '\n')
+		if len(window) >= maxWindow || len(buf) >= maxWindowBytes {
+			flush()
+		}
+	}
+	flush()
+	d := time.Since(start)
+
+	for i, command := range commands {
+		err := res[i].err
+		c.errs.Track(err)
+		if _, ok := err.(IOError); ok {
+			c.broken.Store(true)
+		}
+		for _, h := range c.hooks {
+			h.AfterCommand(command, d, err)
+		}
+		if c.logger != nil {
+			c.logger.Debug("collectd command",
+				"command", command,
+				"status", statuses[i],
+				"latency", d,
+				"error", err)
+		}
+	}
+	return res
 }
 
 // GetValue returns the values for an identifier. The map maps names
@@ -100,15 +361,21 @@ func (c *Conn) GetValue(name string) (map[string]float64, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseGetval(res)
+}
 
+func parseGetval(res []string) (map[string]float64, error) {
 	ret := make(map[string]float64, len(res))
 	for _, v := range res {
-		fields := strings.SplitN(v, "=", 2)
-		f, err := strconv.ParseFloat(fields[1], 64)
+		name, value, ok := strings.Cut(v, "=")
+		if !ok {
+			return ret, Error{Err: &ParseError{Line: v, Msg: "missing ="}}
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
 		if err != nil {
-			return ret, Error{fmt.Errorf("Could not parse value %q: %s", fields[1], err)}
+			return ret, Error{Err: &ParseError{Line: v, Msg: "invalid value"}}
 		}
-		ret[fields[0]] = f
+		ret[strings.TrimSpace(name)] = f
 	}
 
 	return ret, nil
@@ -124,21 +391,32 @@ func mapToKV(v map[string]string) string {
 	return strings.Join(parts, " ")
 }
 
-// PutValue submits values to collectd. Each value can be a number or
-// the string "U" to mean undefined. If t is nil, collectd will
-// determine the current timestamp. opts is a key=value map of
-// options.
+// PutValue submits values to collectd. Each value can be a number, a
+// Value or the string "U" to mean undefined. Floating point NaN is
+// submitted as undefined, too. If t is nil, collectd will
+// determine the current timestamp. Timestamps have millisecond
+// resolution unless configured otherwise with WithTimePrecision. opts
+// is a key=value map of options.
 func (c *Conn) PutValue(name string, opts map[string]string, t *time.Time, values ...interface{}) error {
 	var value []string
 
 	if t != nil {
-		value = append(value, fmt.Sprintf("%d", t.Unix()))
+		value = append(value, formatTime(*t, c.precision))
 	} else {
 		value = append(value, "N")
 	}
 
 	for _, v := range values {
-		value = append(value, fmt.Sprintf("%v", v))
+		switch v := v.(type) {
+		case Value:
+			value = append(value, formatValue(v))
+		case float64:
+			value = append(value, formatValue(Gauge(v)))
+		case float32:
+			value = append(value, formatValue(Gauge(v)))
+		default:
+			value = append(value, fmt.Sprintf("%v", v))
+		}
 	}
 
 	_, err := c.SendCommand(fmt.Sprintf(`PUTVAL "%s" %s %s`,
@@ -147,6 +425,35 @@ func (c *Conn) PutValue(name string, opts map[string]string, t *time.Time, value
 	return err
 }
 
+// PutGauge submits gauge values. NaN values are submitted as
+// undefined. If t is the zero time, collectd will determine the
+// current timestamp.
+func (c *Conn) PutGauge(id Identifier, t time.Time, values ...float64) error {
+	vs := make([]Value, len(values))
+	for i, v := range values {
+		vs[i] = Gauge(v)
+	}
+	return c.Write(context.Background(), ValueList{Identifier: id, Time: t, Values: vs})
+}
+
+// PutDerive submits derive values. See PutGauge.
+func (c *Conn) PutDerive(id Identifier, t time.Time, values ...int64) error {
+	vs := make([]Value, len(values))
+	for i, v := range values {
+		vs[i] = Derive(v)
+	}
+	return c.Write(context.Background(), ValueList{Identifier: id, Time: t, Values: vs})
+}
+
+// PutCounter submits counter values. See PutGauge.
+func (c *Conn) PutCounter(id Identifier, t time.Time, values ...uint64) error {
+	vs := make([]Value, len(values))
+	for i, v := range values {
+		vs[i] = Counter(v)
+	}
+	return c.Write(context.Background(), ValueList{Identifier: id, Time: t, Values: vs})
+}
+
 // PutNotif submits a notification to collectd.
 func (c *Conn) PutNotif(opts map[string]string, message string) error {
 	_, err := c.SendCommand(fmt.Sprintf(`PUTNOTIF %s message="%s"`, mapToKV(opts), message))
@@ -162,19 +469,15 @@ func (c *Conn) ListValues() (map[string]time.Time, error) {
 	}
 	ret := make(map[string]time.Time, len(res))
 	for _, val := range res {
-		fields := strings.SplitN(val, " ", 2)
-		var sec, msec int64
-		n, err := fmt.Sscanf(fields[0], "%d.%d", &sec, &msec)
-		if err != nil {
-			if n == 1 {
-				msec = 0
-			} else {
-				return nil, Error{fmt.Errorf("Could not parse timestamp %q: %s", fields[0], err)}
-			}
+		ts, name, ok := strings.Cut(strings.TrimSpace(val), " ")
+		if !ok || name == "" {
+			return nil, Error{Err: &ParseError{Line: val, Msg: "missing identifier"}}
 		}
-
-		t := time.Unix(sec, msec*1e6)
-		ret[fields[1]] = t
+		t, err := parseTime(ts)
+		if err != nil || t.IsZero() {
+			return nil, Error{Err: &ParseError{Line: val, Msg: "invalid timestamp"}}
+		}
+		ret[name] = t
 	}
 
 	return ret, nil
@@ -199,5 +502,14 @@ func (c *Conn) Flush(timeout int, plugins []string, identifiers []string) error
 // this must be called to properly close the socket. If using New, it
 // is optional.
 func (c *Conn) Close() error {
+	c.broken.Store(true)
 	return c.w.Close()
 }
+
+// Health reports the health of the connection. A connection that
+// encountered an IOError or was closed is unhealthy.
+func (c *Conn) Health() Health {
+	err, when := c.errs.Last()
+	ok := !c.broken.Load()
+	return Health{Healthy: ok, Connected: ok, LastError: err, LastErrorTime: when}
+}
@@ -0,0 +1,123 @@
+package collectd
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeConn returns a fixed response and discards all writes.
+type fakeConn struct {
+	io.Reader
+}
+
+func (fakeConn) Write(b []byte) (int, error) { return len(b), nil }
+func (fakeConn) Close() error                { return nil }
+
+func TestReadResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		in     string
+		status string
+		lines  []string
+		// ioErr and parseErr describe the expected error, if any.
+		ioErr    bool
+		parseErr string
+		rejected int
+	}{
+		{
+			name:   "no lines",
+			in:     "0 Success\n",
+			status: "Success",
+			lines:  []string{},
+		},
+		{
+			name:   "lines",
+			in:     "2 Values found\nrx=1\ntx=2\n",
+			status: "Values found",
+			lines:  []string{"rx=1", "tx=2"},
+		},
+		{
+			name:   "CRLF",
+			in:     "2 Values found\r\nrx=1\r\ntx=2\r\n",
+			status: "Values found",
+			lines:  []string{"rx=1", "tx=2"},
+		},
+		{
+			name:     "rejected",
+			in:       "-1 No such value\n",
+			status:   "No such value",
+			rejected: -1,
+		},
+		{
+			name:     "invalid status line",
+			in:       "Success\n",
+			ioErr:    true,
+			parseErr: "invalid status line",
+		},
+		{
+			name:     "implausible count",
+			in:       strconv.Itoa(maxResponseLines+1) + " Values found\n",
+			status:   "Values found",
+			ioErr:    true,
+			parseErr: "implausible number of lines",
+		},
+		{
+			name:     "truncated status line",
+			in:       "0 Succ",
+			ioErr:    true,
+			parseErr: "truncated line",
+		},
+		{
+			name:     "truncated final line",
+			in:       "2 Values found\nrx=1\ntx=",
+			status:   "Values found",
+			lines:    []string{"rx=1"},
+			ioErr:    true,
+			parseErr: "truncated line",
+		},
+		{
+			name:   "missing lines",
+			in:     "2 Values found\nrx=1\n",
+			status: "Values found",
+			lines:  []string{"rx=1"},
+			ioErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(fakeConn{strings.NewReader(tt.in)})
+			status, lines, err := c.readResponse()
+			if status != tt.status {
+				t.Errorf("got status %q, want %q", status, tt.status)
+			}
+			if len(lines) != len(tt.lines) || (len(lines) > 0 && !reflect.DeepEqual(lines, tt.lines)) {
+				t.Errorf("got lines %q, want %q", lines, tt.lines)
+			}
+
+			var ioErr IOError
+			if got := errors.As(err, &ioErr); got != tt.ioErr {
+				t.Errorf("got error %v, want IOError: %t", err, tt.ioErr)
+			}
+			var perr *ParseError
+			if tt.parseErr != "" {
+				if !errors.As(err, &perr) || perr.Msg != tt.parseErr {
+					t.Errorf("got error %v, want ParseError %q", err, tt.parseErr)
+				}
+			} else if errors.As(err, &perr) {
+				t.Errorf("got unexpected ParseError %v", err)
+			}
+			var cerr Error
+			if tt.rejected != 0 {
+				if !errors.As(err, &cerr) || cerr.Status != tt.rejected {
+					t.Errorf("got error %v, want Error with status %d", err, tt.rejected)
+				}
+			} else if !tt.ioErr && err != nil {
+				t.Errorf("got unexpected error %v", err)
+			}
+		})
+	}
+}
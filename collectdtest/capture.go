@@ -0,0 +1,131 @@
+package collectdtest
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// Capture is a Writer and NotificationWriter that stores everything
+// written to it, so that tests can assert exactly what code under test
+// would have submitted. The zero value is ready to use.
+type Capture struct {
+	mu            sync.Mutex
+	vls           []collectd.ValueList
+	notifications []collectd.Notification
+}
+
+var (
+	_ collectd.Writer             = (*Capture)(nil)
+	_ collectd.NotificationWriter = (*Capture)(nil)
+)
+
+// Write stores a copy of vl. It never fails.
+func (c *Capture) Write(ctx context.Context, vl collectd.ValueList) error {
+	vl.Values = slices.Clone(vl.Values)
+	if vl.Meta != nil {
+		meta := make(map[string]any, len(vl.Meta))
+		for k, v := range vl.Meta {
+			meta[k] = v
+		}
+		vl.Meta = meta
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vls = append(c.vls, vl)
+	return nil
+}
+
+// WriteNotification stores n. It never fails.
+func (c *Capture) WriteNotification(ctx context.Context, n collectd.Notification) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notifications = append(c.notifications, n)
+	return nil
+}
+
+// ValueLists returns the stored value lists, in the order they were
+// written.
+func (c *Capture) ValueLists() []collectd.ValueList {
+	return c.filter(func(collectd.ValueList) bool { return true })
+}
+
+// Notifications returns the stored notifications, in the order they
+// were written.
+func (c *Capture) Notifications() []collectd.Notification {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.notifications)
+}
+
+// Find returns the stored value lists whose identifiers match pattern,
+// in the order they were written. Its fields are matched against those
+// of identifiers using path.Match; empty fields match everything.
+func (c *Capture) Find(pattern collectd.Identifier) []collectd.ValueList {
+	return c.filter(collectd.MatchIdentifier(pattern))
+}
+
+// Between returns the stored value lists whose time is in the range
+// [start, end), in the order they were written. Value lists without a
+// time are never in range.
+func (c *Capture) Between(start, end time.Time) []collectd.ValueList {
+	return c.filter(func(vl collectd.ValueList) bool {
+		return !vl.Time.IsZero() && !vl.Time.Before(start) && vl.Time.Before(end)
+	})
+}
+
+// Last returns the value list of id that was written last.
+func (c *Capture) Last(id collectd.Identifier) (collectd.ValueList, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := len(c.vls) - 1; i >= 0; i-- {
+		if c.vls[i].Identifier == id {
+			return c.vls[i], true
+		}
+	}
+	return collectd.ValueList{}, false
+}
+
+func (c *Capture) filter(fn func(collectd.ValueList) bool) []collectd.ValueList {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []collectd.ValueList
+	for _, vl := range c.vls {
+		if fn(vl) {
+			out = append(out, vl)
+		}
+	}
+	return out
+}
+
+// Dump returns the stored value lists as PUTVAL commands, one per
+// line, sorted by identifier and time so that the output doesn't
+// depend on the order of concurrent writes. It is meant to be
+// compared against golden files or expected strings, which makes
+// differences easy to read.
+func (c *Capture) Dump() string {
+	vls := c.ValueLists()
+	slices.SortStableFunc(vls, func(a, b collectd.ValueList) int {
+		if c := strings.Compare(a.Identifier.String(), b.Identifier.String()); c != 0 {
+			return c
+		}
+		return a.Time.Compare(b.Time)
+	})
+	var sb strings.Builder
+	for _, vl := range vls {
+		sb.WriteString(collectd.FormatPutval(vl))
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// Reset discards all stored value lists and notifications.
+func (c *Capture) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.vls, c.notifications = nil, nil
+}
@@ -0,0 +1,188 @@
+// Package collectdtest provides a fake of collectd's unixsock plugin
+// for testing code that talks to collectd, without running collectd,
+// and a Writer that captures value lists for assertions.
+package collectdtest // import "honnef.co/go/collectd/collectdtest"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// Server is an in-process fake of collectd's unixsock plugin, listening
+// on a unix socket in a temporary directory. It stores the values it
+// receives in a MemoryBackend, which answers GETVAL and LISTVAL and can
+// be filled with canned values. Errors and latency can be injected to
+// test how clients handle them.
+type Server struct {
+	// Path is the path of the server's socket, for use with
+	// collectd.DialUnix.
+	Path string
+	// Backend stores the values of PUTVAL commands and answers
+	// GETVAL, LISTVAL and FLUSH commands.
+	Backend *collectd.MemoryBackend
+
+	srv *collectd.Server
+	dir string
+
+	mu            sync.Mutex
+	latency       time.Duration
+	failures      []failure
+	commands      []collectd.Command
+	notifications []collectd.Notification
+}
+
+// failure is a scripted error status.
+type failure struct {
+	command string
+	n       int
+	message string
+}
+
+// NewServer starts a Server. PUTVAL values are typed and checked
+// according to types, which may be nil to treat all values as gauges
+// and name data sources as MemoryBackend does. NewServer panics if it
+// can't listen, like httptest.NewServer. Servers should be closed when
+// they are no longer needed.
+func NewServer(types collectd.TypesDB) *Server {
+	dir, err := os.MkdirTemp("", "collectdtest")
+	if err != nil {
+		panic(fmt.Sprintf("collectdtest: could not create socket directory: %s", err))
+	}
+	path := filepath.Join(dir, "unixsock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		os.RemoveAll(dir)
+		panic(fmt.Sprintf("collectdtest: could not listen on %s: %s", path, err))
+	}
+	s := &Server{
+		Path:    path,
+		Backend: &collectd.MemoryBackend{TypesDB: types},
+		dir:     dir,
+	}
+	s.srv = &collectd.Server{Handler: collectd.HandlerFunc(s.serveCommand), TypesDB: types}
+	go s.srv.Serve(l)
+	return s
+}
+
+func (s *Server) serveCommand(ctx context.Context, cmd collectd.Command) ([]string, error) {
+	s.mu.Lock()
+	latency := s.latency
+	s.commands = append(s.commands, cmd)
+	err := s.fail(commandName(cmd))
+	s.mu.Unlock()
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cmd, ok := cmd.(*collectd.PutnotifCommand); ok {
+		s.mu.Lock()
+		s.notifications = append(s.notifications, cmd.Notification)
+		s.mu.Unlock()
+		return nil, nil
+	}
+	return collectd.BackendHandler(s.Backend).ServeCommand(ctx, cmd)
+}
+
+// fail returns the scripted error of the command name, if any. It
+// must be called with s.mu held.
+func (s *Server) fail(name string) error {
+	for i := range s.failures {
+		f := &s.failures[i]
+		if f.command != "" && f.command != name {
+			continue
+		}
+		f.n--
+		if f.n == 0 {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+		}
+		return errors.New(f.message)
+	}
+	return nil
+}
+
+func commandName(cmd collectd.Command) string {
+	switch cmd.(type) {
+	case *collectd.PutvalCommand:
+		return "PUTVAL"
+	case *collectd.PutnotifCommand:
+		return "PUTNOTIF"
+	case *collectd.GetvalCommand:
+		return "GETVAL"
+	case *collectd.ListvalCommand:
+		return "LISTVAL"
+	case *collectd.FlushCommand:
+		return "FLUSH"
+	default:
+		return ""
+	}
+}
+
+// Put stores canned value lists in the backend, as if they had been
+// received with PUTVAL. It panics if the backend rejects one of them.
+func (s *Server) Put(vls ...collectd.ValueList) {
+	for _, vl := range vls {
+		if err := s.Backend.PutValue(context.Background(), vl); err != nil {
+			panic(fmt.Sprintf("collectdtest: could not put %s: %s", vl.Identifier, err))
+		}
+	}
+}
+
+// FailNext causes the next n commands named command, such as
+// "PUTVAL", to fail with the error status message, as if collectd had
+// rejected them. An empty command matches all commands. Failures are
+// scripted in order: a command consumes the earliest scripted failure
+// that matches it.
+func (s *Server) FailNext(command string, n int, message string) {
+	if n <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{command: command, n: n, message: message})
+}
+
+// SetLatency delays the responses to all subsequent commands by d.
+func (s *Server) SetLatency(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = d
+}
+
+// Commands returns the commands the server has received, in order,
+// including those that failed.
+func (s *Server) Commands() []collectd.Command {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]collectd.Command(nil), s.commands...)
+}
+
+// Notifications returns the notifications the server has received
+// with PUTNOTIF, in order.
+func (s *Server) Notifications() []collectd.Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]collectd.Notification(nil), s.notifications...)
+}
+
+// Close closes all connections, stops the server and removes its
+// socket.
+func (s *Server) Close() {
+	s.srv.Close()
+	os.RemoveAll(s.dir)
+}
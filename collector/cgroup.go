@@ -0,0 +1,111 @@
+package collector
+
+import (
+	"context"
+	"path"
+
+	"honnef.co/go/collectd"
+)
+
+// Cgroup collects the CPU, memory and I/O usage of control groups,
+// such as that of a container, from the inside, where the host's
+// collectd can't attribute usage to the workload. Both cgroup v1 and
+// v2 hierarchies are supported.
+//
+// Values are named like those of collectd's cgroups plugin: the plugin
+// is "cgroups" and the plugin instance the base name of the cgroup,
+// or "root" for the root cgroup. CPU time is reported in the types
+// "cpu-user" and "cpu-system", in units of USER_HZ. Memory usage, the
+// memory limit if there is one, and selected fields of memory.stat are
+// of type "memory", with type instances "usage", "limit", "anon" and
+// so on. I/O is reported per device, with its major and minor number
+// as type instance, in the types "disk_octets" and "disk_ops".
+// Controllers that aren't enabled for a cgroup are skipped.
+//
+// It is only supported on Linux. On other systems, Collect returns an
+// error.
+type Cgroup struct {
+	// Host is the host of the value lists. If it is empty, the host
+	// name collectd would use is determined once and used.
+	Host string
+	// Root is the mount point of the cgroup hierarchy. It defaults
+	// to /sys/fs/cgroup.
+	Root string
+	// Paths are the cgroups to collect from, relative to Root, such
+	// as "system.slice/docker-0123abcd.scope". If it is empty, the
+	// cgroup of the current process is used, which in a container
+	// with its own cgroup namespace is the container's.
+	Paths []string
+}
+
+// cgroupStats is the resource usage of a cgroup.
+type cgroupStats struct {
+	// path is the cgroup's path, resolved if the current cgroup was
+	// requested.
+	path string
+	// hasCPU reports whether user and system, the CPU time in units
+	// of USER_HZ, are known.
+	hasCPU       bool
+	user, system uint64
+	// memory are the memory statistics, in bytes.
+	memory []cgroupStat
+	io     []cgroupIO
+}
+
+type cgroupStat struct {
+	name  string
+	value uint64
+}
+
+// cgroupIO is the I/O of a cgroup on a device.
+type cgroupIO struct {
+	device                string
+	readBytes, writeBytes uint64
+	readOps, writeOps     uint64
+}
+
+// Collect returns the current usage of all cgroups, leaving the time of
+// the value lists to the caller.
+func (c *Cgroup) Collect(ctx context.Context) ([]collectd.ValueList, error) {
+	root := c.Root
+	if root == "" {
+		root = "/sys/fs/cgroup"
+	}
+	paths := c.Paths
+	if len(paths) == 0 {
+		// The empty path denotes the current cgroup.
+		paths = []string{""}
+	}
+	host := hostname(c.Host)
+	var vls []collectd.ValueList
+	for _, p := range paths {
+		st, err := readCgroupStats(root, p)
+		if err != nil {
+			return vls, err
+		}
+		name := path.Base(path.Clean("/" + st.path))
+		if name == "/" {
+			name = "root"
+		}
+		id := collectd.Identifier{Host: host, Plugin: "cgroups", PluginInstance: name}
+		vl := func(typ, typeInstance string, vs ...collectd.Value) collectd.ValueList {
+			id := id
+			id.Type, id.TypeInstance = typ, typeInstance
+			return collectd.ValueList{Identifier: id, Values: vs}
+		}
+		if st.hasCPU {
+			vls = append(vls,
+				vl("cpu", "user", collectd.Derive(st.user)),
+				vl("cpu", "system", collectd.Derive(st.system)))
+		}
+		for _, m := range st.memory {
+			vls = append(vls, vl("memory", m.name, collectd.Gauge(m.value)))
+		}
+		for _, d := range st.io {
+			vls = append(vls,
+				vl("disk_octets", d.device, collectd.Derive(d.readBytes), collectd.Derive(d.writeBytes)),
+				vl("disk_ops", d.device, collectd.Derive(d.readOps), collectd.Derive(d.writeOps)))
+		}
+	}
+	return vls, nil
+}
@@ -0,0 +1,298 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The fields of memory.stat that are reported, for cgroup v1 and v2.
+var (
+	cgroupV1MemoryStats = []string{"rss", "cache", "mapped_file", "shmem", "swap"}
+	cgroupV2MemoryStats = []string{"anon", "file", "file_mapped", "shmem", "kernel_stack", "slab", "sock"}
+)
+
+func readCgroupStats(root, path string) (cgroupStats, error) {
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return readCgroupV2Stats(root, path)
+	}
+	return readCgroupV1Stats(root, path)
+}
+
+// currentCgroups returns the cgroups of the current process, by
+// controller. The cgroup of the v2 hierarchy has the empty controller.
+func currentCgroups() (map[string]string, error) {
+	b, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[1] == "" {
+			out[""] = fields[2]
+			continue
+		}
+		for _, c := range strings.Split(fields[1], ",") {
+			out[c] = fields[2]
+		}
+	}
+	return out, nil
+}
+
+func readCgroupV2Stats(root, path string) (cgroupStats, error) {
+	if path == "" {
+		cgroups, err := currentCgroups()
+		if err != nil {
+			return cgroupStats{}, err
+		}
+		var ok bool
+		path, ok = cgroups[""]
+		if !ok {
+			return cgroupStats{}, errors.New("collector: process is not in a cgroup v2 hierarchy")
+		}
+	}
+	dir := filepath.Join(root, path)
+	if _, err := os.Stat(dir); err != nil {
+		return cgroupStats{}, err
+	}
+	st := cgroupStats{path: path}
+
+	cpu, err := readKeyValues(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return st, err
+	}
+	if cpu != nil {
+		st.hasCPU = true
+		st.user = cpu["user_usec"] * userHZ / 1e6
+		st.system = cpu["system_usec"] * userHZ / 1e6
+	}
+
+	if v, ok, err := readUintFile(filepath.Join(dir, "memory.current")); err != nil {
+		return st, err
+	} else if ok {
+		st.memory = append(st.memory, cgroupStat{"usage", v})
+	}
+	// memory.max is "max" if there is no limit, which readUintFile
+	// reports as absent.
+	if v, ok, err := readUintFile(filepath.Join(dir, "memory.max")); err != nil {
+		return st, err
+	} else if ok {
+		st.memory = append(st.memory, cgroupStat{"limit", v})
+	}
+	mem, err := readKeyValues(filepath.Join(dir, "memory.stat"))
+	if err != nil {
+		return st, err
+	}
+	st.memory = appendStats(st.memory, mem, cgroupV2MemoryStats)
+
+	b, err := os.ReadFile(filepath.Join(dir, "io.stat"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return st, err
+	}
+	// Lines look like "8:0 rbytes=1 wbytes=2 rios=3 wios=4 dbytes=0
+	// dios=0".
+	for _, line := range strings.Split(strings.TrimSpace(string(b)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		d := cgroupIO{device: fields[0]}
+		for _, f := range fields[1:] {
+			k, v, _ := strings.Cut(f, "=")
+			n, _ := strconv.ParseUint(v, 10, 64)
+			switch k {
+			case "rbytes":
+				d.readBytes = n
+			case "wbytes":
+				d.writeBytes = n
+			case "rios":
+				d.readOps = n
+			case "wios":
+				d.writeOps = n
+			}
+		}
+		st.io = append(st.io, d)
+	}
+	return st, nil
+}
+
+func readCgroupV1Stats(root, path string) (cgroupStats, error) {
+	var cgroups map[string]string
+	if path == "" {
+		var err error
+		cgroups, err = currentCgroups()
+		if err != nil {
+			return cgroupStats{}, err
+		}
+	}
+	// dir returns the directory of the cgroup in the hierarchy of
+	// controller, or "" if the controller isn't mounted.
+	dir := func(controller string) (string, error) {
+		p := path
+		if cgroups != nil {
+			var ok bool
+			p, ok = cgroups[controller]
+			if !ok {
+				return "", nil
+			}
+		}
+		mount := filepath.Join(root, controller)
+		if _, err := os.Stat(mount); err != nil {
+			return "", nil
+		}
+		d := filepath.Join(mount, p)
+		_, err := os.Stat(d)
+		return d, err
+	}
+	st := cgroupStats{path: path}
+	if cgroups != nil {
+		st.path = cgroups["cpuacct"]
+	}
+
+	if d, err := dir("cpuacct"); err != nil {
+		return st, err
+	} else if d != "" {
+		// cpuacct.stat is in units of USER_HZ already.
+		cpu, err := readKeyValues(filepath.Join(d, "cpuacct.stat"))
+		if err != nil {
+			return st, err
+		}
+		if cpu != nil {
+			st.hasCPU = true
+			st.user, st.system = cpu["user"], cpu["system"]
+		}
+	}
+
+	if d, err := dir("memory"); err != nil {
+		return st, err
+	} else if d != "" {
+		if v, ok, err := readUintFile(filepath.Join(d, "memory.usage_in_bytes")); err != nil {
+			return st, err
+		} else if ok {
+			st.memory = append(st.memory, cgroupStat{"usage", v})
+		}
+		// Without a limit, memory.limit_in_bytes is the largest
+		// multiple of the page size that fits into an int64.
+		if v, ok, err := readUintFile(filepath.Join(d, "memory.limit_in_bytes")); err != nil {
+			return st, err
+		} else if ok && v < 1<<62 {
+			st.memory = append(st.memory, cgroupStat{"limit", v})
+		}
+		mem, err := readKeyValues(filepath.Join(d, "memory.stat"))
+		if err != nil {
+			return st, err
+		}
+		st.memory = appendStats(st.memory, mem, cgroupV1MemoryStats)
+	}
+
+	if d, err := dir("blkio"); err != nil {
+		return st, err
+	} else if d != "" {
+		devices := map[string]*cgroupIO{}
+		var order []string
+		for _, f := range [...]struct {
+			name        string
+			read, write func(*cgroupIO) *uint64
+		}{
+			{"blkio.throttle.io_service_bytes",
+				func(d *cgroupIO) *uint64 { return &d.readBytes },
+				func(d *cgroupIO) *uint64 { return &d.writeBytes }},
+			{"blkio.throttle.io_serviced",
+				func(d *cgroupIO) *uint64 { return &d.readOps },
+				func(d *cgroupIO) *uint64 { return &d.writeOps }},
+		} {
+			b, err := os.ReadFile(filepath.Join(d, f.name))
+			if err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return st, err
+			}
+			// Lines look like "8:0 Read 1234", followed by a
+			// line "Total 1234".
+			for _, line := range strings.Split(string(b), "\n") {
+				fields := strings.Fields(line)
+				if len(fields) != 3 {
+					continue
+				}
+				n, _ := strconv.ParseUint(fields[2], 10, 64)
+				dev, ok := devices[fields[0]]
+				if !ok {
+					dev = &cgroupIO{device: fields[0]}
+					devices[fields[0]] = dev
+					order = append(order, fields[0])
+				}
+				switch fields[1] {
+				case "Read":
+					*f.read(dev) = n
+				case "Write":
+					*f.write(dev) = n
+				}
+			}
+		}
+		for _, name := range order {
+			st.io = append(st.io, *devices[name])
+		}
+	}
+	return st, nil
+}
+
+// readUintFile reads a file consisting of a single number. It reports
+// false if the file doesn't exist or doesn't contain a number, such as
+// the "max" of cgroup v2 limits.
+func readUintFile(name string) (uint64, bool, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	v, err := strconv.ParseUint(string(bytes.TrimSpace(b)), 10, 64)
+	return v, err == nil, nil
+}
+
+// readKeyValues reads a file of lines like "key 123". It returns nil
+// if the file doesn't exist.
+func readKeyValues(name string) (map[string]uint64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	out := map[string]uint64{}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		k, v, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(v, 10, 64); err == nil {
+			out[k] = n
+		}
+	}
+	return out, sc.Err()
+}
+
+// appendStats appends the values of the fields names of m that exist.
+func appendStats(dst []cgroupStat, m map[string]uint64, names []string) []cgroupStat {
+	for _, name := range names {
+		if v, ok := m[name]; ok {
+			dst = append(dst, cgroupStat{name, v})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+func readCgroupStats(root, path string) (cgroupStats, error) {
+	return cgroupStats{}, errors.New("collector: cgroup statistics are only supported on Linux")
+}
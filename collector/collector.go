@@ -0,0 +1,64 @@
+// Package collector provides collectors of commonly needed metrics,
+// such as those of the Go runtime, that report them as collectd value
+// lists. Their Collect methods can be run with Run, which writes the
+// value lists to any collectd.Writer, or registered as read callbacks
+// of an exec plugin or of a Scheduler.
+package collector // import "honnef.co/go/collectd/collector"
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// A ReadFunc collects value lists. It has the signature of the
+// Collect methods of collectors and of exec.ReadFunc.
+type ReadFunc func(ctx context.Context) ([]collectd.ValueList, error)
+
+// Run calls fn at every tick of s and writes the returned value lists
+// to w, until ctx is canceled. Value lists without a time are written
+// with the scheduled time of the tick, and those without an interval
+// with the schedule's interval. Errors of fn and w are passed to
+// onError, which may be nil. Run returns ctx.Err().
+func Run(ctx context.Context, s collectd.Schedule, w collectd.Writer, fn ReadFunc, onError func(error)) error {
+	return s.Run(ctx, func(ctx context.Context, t time.Time) {
+		vls, err := fn(ctx)
+		if err != nil && onError != nil {
+			onError(err)
+		}
+		for _, vl := range vls {
+			if vl.Time.IsZero() {
+				vl.Time = t
+			}
+			if vl.Interval == 0 {
+				vl.Interval = s.Interval
+			}
+			if err := w.Write(ctx, vl); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	})
+}
+
+var (
+	hostOnce sync.Once
+	hostName string
+)
+
+// hostname returns host, or if it is empty, the host name collectd
+// would use.
+func hostname(host string) string {
+	if host != "" {
+		return host
+	}
+	hostOnce.Do(func() {
+		var err error
+		hostName, err = collectd.Hostname(true)
+		if err != nil {
+			hostName = "localhost"
+		}
+	})
+	return hostName
+}
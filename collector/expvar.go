@@ -0,0 +1,120 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"path"
+	"sort"
+	"strings"
+
+	"honnef.co/go/collectd"
+)
+
+// ExpvarRule determines how matching expvar variables are reported.
+type ExpvarRule struct {
+	// Pattern is matched against the names of variables using
+	// path.Match. The values of maps, such as expvar.Map or the
+	// memstats variable, are named by joining the keys with dots,
+	// as in "memstats.HeapAlloc".
+	Pattern string
+	// Drop causes matching variables not to be reported.
+	Drop bool
+	// DSType is the data source type of matching variables, either
+	// collectd.DSTypeGauge or collectd.DSTypeDerive.
+	DSType collectd.DSType
+	// Type is the type of matching variables. It defaults to "gauge"
+	// or "derive", depending on DSType.
+	Type string
+}
+
+// Expvar reports the numeric variables published with the expvar
+// package, so that programs that already use expvar can report to
+// collectd without further changes. The name of a variable becomes
+// the type instance. Variables that match none of the rules are
+// reported as gauges; non-numeric ones are ignored.
+type Expvar struct {
+	// Host is the host of the value lists. If it is empty, the host
+	// name collectd would use is determined once and used.
+	Host string
+	// Plugin is the plugin of the value lists. It defaults to
+	// "expvar".
+	Plugin string
+	// PluginInstance is the plugin instance of the value lists.
+	PluginInstance string
+	// Rules are tried in order, the first matching rule applies.
+	Rules []ExpvarRule
+}
+
+// Collect returns the current values of all variables, sorted by
+// name, leaving the time of the value lists to the caller.
+func (e *Expvar) Collect(ctx context.Context) ([]collectd.ValueList, error) {
+	plugin := e.Plugin
+	if plugin == "" {
+		plugin = "expvar"
+	}
+	id := collectd.Identifier{Host: hostname(e.Host), Plugin: plugin, PluginInstance: e.PluginInstance}
+	nums := map[string]json.Number{}
+	expvar.Do(func(kv expvar.KeyValue) {
+		d := json.NewDecoder(strings.NewReader(kv.Value.String()))
+		d.UseNumber()
+		var v any
+		if d.Decode(&v) == nil {
+			flatten(nums, kv.Key, v)
+		}
+	})
+	names := make([]string, 0, len(nums))
+	for name := range nums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var vls []collectd.ValueList
+	for _, name := range names {
+		rule := ExpvarRule{DSType: collectd.DSTypeGauge}
+		for _, r := range e.Rules {
+			if ok, _ := path.Match(r.Pattern, name); ok {
+				rule = r
+				break
+			}
+		}
+		if rule.Drop {
+			continue
+		}
+		var v collectd.Value
+		typ := rule.Type
+		if rule.DSType == collectd.DSTypeDerive {
+			n, err := nums[name].Int64()
+			if err != nil {
+				f, _ := nums[name].Float64()
+				n = int64(f)
+			}
+			v = collectd.Derive(n)
+			if typ == "" {
+				typ = "derive"
+			}
+		} else {
+			f, _ := nums[name].Float64()
+			v = collectd.Gauge(f)
+			if typ == "" {
+				typ = "gauge"
+			}
+		}
+		id := id
+		id.Type = typ
+		id.TypeInstance = strings.ReplaceAll(name, "/", "_")
+		vls = append(vls, collectd.ValueList{Identifier: id, Values: []collectd.Value{v}})
+	}
+	return vls, nil
+}
+
+// flatten adds the numbers in v to nums, named by their path.
+func flatten(nums map[string]json.Number, name string, v any) {
+	switch v := v.(type) {
+	case json.Number:
+		nums[name] = v
+	case map[string]any:
+		for k, v := range v {
+			flatten(nums, name+"."+k, v)
+		}
+	}
+}
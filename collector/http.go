@@ -0,0 +1,85 @@
+package collector
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultLatency configures the latency histograms of HTTPMiddleware
+// and the gRPC interceptors of package rpc, in seconds.
+var DefaultLatency = HistogramOpts{
+	Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	Quantiles: []float64{0.5, 0.9, 0.99},
+}
+
+// HTTPMiddleware records the requests of HTTP handlers in a registry.
+// For a handler named name, the number of requests is a counter of
+// type "total_requests" and type instance name, the number of requests
+// per status class one with type instances such as "name-2xx", and
+// the latency of requests a histogram of type "response_time" and
+// type instance name.
+type HTTPMiddleware struct {
+	Registry *Registry
+	// Latency configures the latency histograms. If it has neither
+	// buckets nor quantiles, DefaultLatency is used.
+	Latency HistogramOpts
+}
+
+// Wrap returns a handler that calls h and records its requests under
+// name, such as the route it is mounted at. Requests whose handler
+// panics are not recorded.
+func (m *HTTPMiddleware) Wrap(name string, h http.Handler) http.Handler {
+	opts := m.Latency
+	if len(opts.Buckets) == 0 && len(opts.Quantiles) == 0 {
+		opts = DefaultLatency
+	}
+	requests := m.Registry.Counter("total_requests", name)
+	latency := m.Registry.Histogram("response_time", name, opts)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		latency.Observe(time.Since(start).Seconds())
+		requests.Inc()
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.Registry.Counter("total_requests", name+"-"+strconv.Itoa(status/100)+"xx").Inc()
+	})
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes the underlying ResponseWriter if it supports
+// flushing.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying ResponseWriter, for use by
+// http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
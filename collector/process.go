@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"honnef.co/go/collectd"
+)
+
+// Process collects the resource usage of a process, by default the
+// current one, naming the values like collectd's processes plugin
+// does for a Process block: the plugin is "processes", the plugin
+// instance the process' name, and the types are ps_cputime, ps_rss,
+// ps_vm, ps_count, ps_pagefaults and file_handles.
+//
+// It is only supported on Linux, where it reads /proc. On other
+// systems, Collect returns an error.
+type Process struct {
+	// Host is the host of the value lists. If it is empty, the host
+	// name collectd would use is determined once and used.
+	Host string
+	// Name is the plugin instance of the value lists. It defaults to
+	// the base name of the program.
+	Name string
+	// PID is the process to collect from. Zero means the current
+	// process.
+	PID int
+}
+
+// procStats is the resource usage of a process.
+type procStats struct {
+	// userMicros and systemMicros are the CPU time spent in user and
+	// kernel mode, in microseconds.
+	userMicros   uint64
+	systemMicros uint64
+	// rss is the resident set size and vsz the size of the virtual
+	// memory, in bytes.
+	rss     uint64
+	vsz     uint64
+	threads uint64
+	minflt  uint64
+	majflt  uint64
+	fds     uint64
+}
+
+// Collect returns the current resource usage, leaving the time of the
+// value lists to the caller.
+func (p *Process) Collect(ctx context.Context) ([]collectd.ValueList, error) {
+	pid := p.PID
+	if pid == 0 {
+		pid = os.Getpid()
+	}
+	st, err := readProcStats(pid)
+	if err != nil {
+		return nil, err
+	}
+	name := p.Name
+	if name == "" {
+		name = filepath.Base(os.Args[0])
+	}
+	id := collectd.Identifier{Host: hostname(p.Host), Plugin: "processes", PluginInstance: name}
+	vl := func(typ string, vs ...collectd.Value) collectd.ValueList {
+		id := id
+		id.Type = typ
+		return collectd.ValueList{Identifier: id, Values: vs}
+	}
+	return []collectd.ValueList{
+		vl("ps_cputime", collectd.Derive(st.userMicros), collectd.Derive(st.systemMicros)),
+		vl("ps_rss", collectd.Gauge(st.rss)),
+		vl("ps_vm", collectd.Gauge(st.vsz)),
+		vl("ps_count", collectd.Gauge(1), collectd.Gauge(st.threads)),
+		vl("ps_pagefaults", collectd.Derive(st.minflt), collectd.Derive(st.majflt)),
+		vl("file_handles", collectd.Gauge(st.fds)),
+	}, nil
+}
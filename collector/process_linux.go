@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// userHZ is the unit of CPU times in /proc, which is fixed at 100 on
+// all architectures Go supports.
+const userHZ = 100
+
+func readProcStats(pid int) (procStats, error) {
+	dir := filepath.Join("/proc", strconv.Itoa(pid))
+	b, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return procStats{}, err
+	}
+	// The command name may contain spaces and parentheses, but is
+	// followed by the last closing parenthesis.
+	i := strings.LastIndexByte(string(b), ')')
+	if i < 0 {
+		return procStats{}, errors.New("collector: malformed " + filepath.Join(dir, "stat"))
+	}
+	// fields[0] is the state, the third field of the file.
+	fields := strings.Fields(string(b[i+1:]))
+	if len(fields) < 22 {
+		return procStats{}, errors.New("collector: malformed " + filepath.Join(dir, "stat"))
+	}
+	field := func(n int) uint64 {
+		v, _ := strconv.ParseUint(fields[n-3], 10, 64)
+		return v
+	}
+	fds, err := os.ReadDir(filepath.Join(dir, "fd"))
+	if err != nil {
+		return procStats{}, err
+	}
+	return procStats{
+		userMicros:   field(14) * 1e6 / userHZ,
+		systemMicros: field(15) * 1e6 / userHZ,
+		minflt:       field(10),
+		majflt:       field(12),
+		threads:      field(20),
+		vsz:          field(23),
+		rss:          field(24) * uint64(os.Getpagesize()),
+		fds:          uint64(len(fds)),
+	}, nil
+}
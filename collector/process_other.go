@@ -0,0 +1,9 @@
+//go:build !linux
+
+package collector
+
+import "errors"
+
+func readProcStats(pid int) (procStats, error) {
+	return procStats{}, errors.New("collector: process statistics are only supported on Linux")
+}
@@ -0,0 +1,293 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"honnef.co/go/collectd"
+)
+
+// Registry holds metrics that a program updates as it runs, and
+// reports their current values whenever it is collected, much like the
+// client of a statsd server, but without any aggregation in between.
+// Metrics are identified by their type and type instance; the other
+// parts of their identifiers are those of the registry.
+//
+// To submit the metrics every interval, run its Collect method with
+// Run.
+type Registry struct {
+	// Host is the host of the value lists. If it is empty, the host
+	// name collectd would use is determined once and used.
+	Host string
+
+	plugin         string
+	pluginInstance string
+
+	mu      sync.Mutex
+	metrics map[regKey]metric
+	order   []regKey
+}
+
+type regKey struct {
+	typ, typeInstance string
+}
+
+// metric is a metric of a registry.
+type metric interface {
+	// values returns the value lists of the metric, which has the
+	// identifier id.
+	values(id collectd.Identifier) []collectd.ValueList
+}
+
+// NewRegistry returns an empty registry whose metrics have the given
+// plugin and plugin instance.
+func NewRegistry(plugin, pluginInstance string) *Registry {
+	return &Registry{plugin: plugin, pluginInstance: pluginInstance}
+}
+
+// register returns the metric registered under typ and typeInstance,
+// registering the result of create if there is none.
+func (r *Registry) register(typ, typeInstance string, create func() metric) metric {
+	k := regKey{typ, typeInstance}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := r.metrics[k]; ok {
+		return m
+	}
+	if r.metrics == nil {
+		r.metrics = map[regKey]metric{}
+	}
+	m := create()
+	r.metrics[k] = m
+	r.order = append(r.order, k)
+	return m
+}
+
+// Gauge returns the gauge of type typ and type instance typeInstance,
+// registering it if necessary. typ must have a single data source of
+// type GAUGE, such as "gauge" or "memory". It panics if a metric of
+// another kind is registered under the same name.
+func (r *Registry) Gauge(typ, typeInstance string) *Gauge {
+	m := r.register(typ, typeInstance, func() metric { return new(Gauge) })
+	g, ok := m.(*Gauge)
+	if !ok {
+		panic(fmt.Sprintf("collector: %s-%s is registered as %T", typ, typeInstance, m))
+	}
+	return g
+}
+
+// Counter returns the counter of type typ and type instance
+// typeInstance, registering it if necessary. typ must have a single
+// data source of type DERIVE, such as "derive" or "total_requests".
+// It panics if a metric of another kind is registered under the same
+// name.
+func (r *Registry) Counter(typ, typeInstance string) *Counter {
+	m := r.register(typ, typeInstance, func() metric { return new(Counter) })
+	c, ok := m.(*Counter)
+	if !ok {
+		panic(fmt.Sprintf("collector: %s-%s is registered as %T", typ, typeInstance, m))
+	}
+	return c
+}
+
+// Collect returns the current values of all metrics, in the order of
+// registration, leaving the time of the value lists to the caller.
+// Every call starts a new interval for the quantiles of histograms, so
+// a registry should only be collected by one caller.
+func (r *Registry) Collect(ctx context.Context) ([]collectd.ValueList, error) {
+	r.mu.Lock()
+	order := r.order
+	metrics := make([]metric, len(order))
+	for i, k := range order {
+		metrics[i] = r.metrics[k]
+	}
+	r.mu.Unlock()
+	id := collectd.Identifier{Host: hostname(r.Host), Plugin: r.plugin, PluginInstance: r.pluginInstance}
+	var vls []collectd.ValueList
+	for i, m := range metrics {
+		id := id
+		id.Type, id.TypeInstance = order[i].typ, order[i].typeInstance
+		vls = append(vls, m.values(id)...)
+	}
+	return vls, nil
+}
+
+// Gauge is a metric that is set to arbitrary values. It is safe for
+// concurrent use.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds delta, which may be negative, to the gauge.
+func (g *Gauge) Add(delta float64) {
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+delta)) {
+			return
+		}
+	}
+}
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+func (g *Gauge) values(id collectd.Identifier) []collectd.ValueList {
+	return []collectd.ValueList{{Identifier: id, Values: []collectd.Value{collectd.Gauge(g.Value())}}}
+}
+
+// Counter is a metric that counts events, reported as a derive. It is
+// safe for concurrent use.
+type Counter struct {
+	n atomic.Int64
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.n.Add(1)
+}
+
+// Add adds delta to the counter. delta should not be negative.
+func (c *Counter) Add(delta int64) {
+	c.n.Add(delta)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() int64 {
+	return c.n.Load()
+}
+
+func (c *Counter) values(id collectd.Identifier) []collectd.ValueList {
+	return []collectd.ValueList{{Identifier: id, Values: []collectd.Value{collectd.Derive(c.Value())}}}
+}
+
+// HistogramOpts configures a histogram.
+type HistogramOpts struct {
+	// Buckets are the upper bounds of the buckets, in increasing
+	// order. An implicit last bucket has no upper bound.
+	Buckets []float64
+	// Quantiles are the quantiles, between 0 and 1, that are
+	// computed over the observations of each interval.
+	Quantiles []float64
+	// MaxSamples is the number of observations per interval that
+	// quantiles are computed from. If there are more, a uniform
+	// random sample of them is used. It defaults to 1024.
+	MaxSamples int
+}
+
+// Histogram returns the histogram of type typ and type instance
+// typeInstance, registering it with opts if necessary. It panics if a
+// metric of another kind is registered under the same name.
+//
+// As collectd has no histogram type, a histogram is reported as
+// several value lists, whose type instances have the histogram's type
+// instance as prefix. The cumulative count of observations less than
+// or equal to each bucket's bound is a derive of type "derive" with
+// the type instance "bucket-bound", such as "bucket-0.5" and
+// "bucket-inf", and the total count of observations is one with the
+// type instance "count". Quantiles are gauges of type typ, such as
+// "latency", with type instances like "quantile-0.99". They are NaN
+// for intervals without observations.
+func (r *Registry) Histogram(typ, typeInstance string, opts HistogramOpts) *Histogram {
+	m := r.register(typ, typeInstance, func() metric {
+		opts.Buckets = append([]float64(nil), opts.Buckets...)
+		return &Histogram{opts: opts, counts: make([]uint64, len(opts.Buckets)+1)}
+	})
+	h, ok := m.(*Histogram)
+	if !ok {
+		panic(fmt.Sprintf("collector: %s-%s is registered as %T", typ, typeInstance, m))
+	}
+	return h
+}
+
+// Histogram is a metric that counts observations, such as request
+// latencies, in buckets and computes quantiles over them. It is safe
+// for concurrent use.
+type Histogram struct {
+	opts HistogramOpts
+
+	mu     sync.Mutex
+	counts []uint64
+	total  uint64
+	// samples are the observations of the current interval, of
+	// which there were seen.
+	samples []float64
+	seen    int
+}
+
+// Observe records the observation v.
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.opts.Buckets, v)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.counts[i]++
+	h.total++
+	if len(h.opts.Quantiles) == 0 {
+		return
+	}
+	limit := h.opts.MaxSamples
+	if limit <= 0 {
+		limit = 1024
+	}
+	h.seen++
+	if len(h.samples) < limit {
+		h.samples = append(h.samples, v)
+	} else if j := rand.N(h.seen); j < limit {
+		h.samples[j] = v
+	}
+}
+
+// values returns the value lists of the histogram and starts a new
+// interval for quantiles.
+func (h *Histogram) values(id collectd.Identifier) []collectd.ValueList {
+	h.mu.Lock()
+	counts := append([]uint64(nil), h.counts...)
+	total := h.total
+	samples := h.samples
+	h.samples, h.seen = nil, 0
+	h.mu.Unlock()
+
+	vl := func(typ, typeInstance string, v collectd.Value) collectd.ValueList {
+		id := id
+		id.Type = typ
+		if id.TypeInstance != "" {
+			typeInstance = id.TypeInstance + "-" + typeInstance
+		}
+		id.TypeInstance = typeInstance
+		return collectd.ValueList{Identifier: id, Values: []collectd.Value{v}}
+	}
+	var vls []collectd.ValueList
+	var cum uint64
+	for i, n := range counts {
+		cum += n
+		bound := "inf"
+		if i < len(h.opts.Buckets) {
+			bound = strconv.FormatFloat(h.opts.Buckets[i], 'g', -1, 64)
+		}
+		vls = append(vls, vl("derive", "bucket-"+bound, collectd.Derive(cum)))
+	}
+	vls = append(vls, vl("derive", "count", collectd.Derive(total)))
+	sort.Float64s(samples)
+	for _, q := range h.opts.Quantiles {
+		v := math.NaN()
+		if len(samples) > 0 {
+			// The nearest rank.
+			i := int(math.Ceil(q*float64(len(samples)))) - 1
+			v = samples[min(max(i, 0), len(samples)-1)]
+		}
+		vls = append(vls, vl(id.Type, "quantile-"+strconv.FormatFloat(q, 'g', -1, 64), collectd.Gauge(v)))
+	}
+	return vls
+}
@@ -0,0 +1,65 @@
+package collector
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// Runtime collects statistics of the Go runtime: memory usage, garbage
+// collection, goroutines and cgo calls. The values use types of
+// collectd's types.db; cumulative ones are derives.
+type Runtime struct {
+	// Host is the host of the value lists. If it is empty, the host
+	// name collectd would use is determined once and used.
+	Host string
+	// Plugin is the plugin of the value lists. It defaults to "go".
+	Plugin string
+	// PluginInstance is the plugin instance of the value lists, for
+	// example the name of the program.
+	PluginInstance string
+}
+
+// Collect returns the current statistics, leaving the time of the
+// value lists to the caller. It briefly stops the world to read them,
+// like runtime.ReadMemStats.
+func (r *Runtime) Collect(ctx context.Context) ([]collectd.ValueList, error) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	plugin := r.Plugin
+	if plugin == "" {
+		plugin = "go"
+	}
+	id := collectd.Identifier{Host: hostname(r.Host), Plugin: plugin, PluginInstance: r.PluginInstance}
+	vl := func(typ, typeInstance string, v collectd.Value) collectd.ValueList {
+		id := id
+		id.Type, id.TypeInstance = typ, typeInstance
+		return collectd.ValueList{Identifier: id, Values: []collectd.Value{v}}
+	}
+	var lastPause collectd.Gauge
+	if ms.NumGC > 0 {
+		lastPause = collectd.Gauge(time.Duration(ms.PauseNs[(ms.NumGC+255)%256]).Seconds())
+	}
+	return []collectd.ValueList{
+		vl("memory", "heap_alloc", collectd.Gauge(ms.HeapAlloc)),
+		vl("memory", "heap_idle", collectd.Gauge(ms.HeapIdle)),
+		vl("memory", "heap_inuse", collectd.Gauge(ms.HeapInuse)),
+		vl("memory", "heap_released", collectd.Gauge(ms.HeapReleased)),
+		vl("memory", "heap_sys", collectd.Gauge(ms.HeapSys)),
+		vl("memory", "stack_inuse", collectd.Gauge(ms.StackInuse)),
+		vl("memory", "sys", collectd.Gauge(ms.Sys)),
+		vl("memory", "next_gc", collectd.Gauge(ms.NextGC)),
+		vl("objects", "heap", collectd.Gauge(ms.HeapObjects)),
+		vl("total_bytes", "alloc", collectd.Derive(ms.TotalAlloc)),
+		vl("operations", "malloc", collectd.Derive(ms.Mallocs)),
+		vl("operations", "free", collectd.Derive(ms.Frees)),
+		vl("operations", "gc", collectd.Derive(ms.NumGC)),
+		vl("total_time_in_ms", "gc_pause", collectd.Derive(ms.PauseTotalNs/uint64(time.Millisecond))),
+		vl("duration", "gc_pause_last", lastPause),
+		vl("percent", "gc_cpu", collectd.Gauge(ms.GCCPUFraction*100)),
+		vl("count", "goroutines", collectd.Gauge(runtime.NumGoroutine())),
+		vl("operations", "cgo_call", collectd.Derive(runtime.NumCgoCall())),
+	}, nil
+}
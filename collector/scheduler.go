@@ -0,0 +1,198 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// Read is a read callback of a Scheduler.
+type Read struct {
+	// Name identifies the callback in errors. It must be unique
+	// within a scheduler.
+	Name string
+	// Schedule determines when the callback is called. Its interval
+	// defaults to ten seconds.
+	Schedule collectd.Schedule
+	// Timeout is the deadline of each call's context. It defaults
+	// to the interval. Callbacks that ignore their context delay
+	// their next calls instead.
+	Timeout time.Duration
+	Func    ReadFunc
+}
+
+// Scheduler calls read callbacks on their own schedules and writes the
+// value lists they return to a writer, like collectd does for the read
+// callbacks of its plugins. Value lists without a time are written
+// with the scheduled time of the call, and those without an interval
+// with the callback's interval.
+//
+// Callbacks that fail, by returning an error, exceeding their timeout
+// or panicking, are backed off like in collectd: the interval between
+// their calls doubles with every failure, up to MaxBackoff, and is
+// reset by the first success.
+type Scheduler struct {
+	Writer collectd.Writer
+	// MaxBackoff is the longest interval between the calls of a
+	// failing callback. It defaults to a day, like collectd's
+	// MaxReadInterval.
+	MaxBackoff time.Duration
+	// OnError, if not nil, is called with the errors of callbacks
+	// and of Writer. It may be called concurrently.
+	OnError func(name string, err error)
+
+	mu    sync.Mutex
+	reads []*schedRead
+	// ctx is the context of Run while it is running.
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+type schedRead struct {
+	Read
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Register adds the read callback r. If the scheduler is running, the
+// callback starts right away, else with Run. Calling unregister
+// removes the callback and waits for its running call, if any, to
+// return. Register panics if a callback with the same name exists.
+func (s *Scheduler) Register(r Read) (unregister func()) {
+	if r.Schedule.Interval <= 0 {
+		r.Schedule.Interval = 10 * time.Second
+	}
+	if r.Timeout <= 0 {
+		r.Timeout = r.Schedule.Interval
+	}
+	sr := &schedRead{Read: r}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.reads {
+		if other.Name == r.Name {
+			panic(fmt.Sprintf("collector: a read callback named %q already exists", r.Name))
+		}
+	}
+	s.reads = append(s.reads, sr)
+	if s.ctx != nil {
+		s.start(sr)
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			if i := slices.Index(s.reads, sr); i >= 0 {
+				s.reads = slices.Delete(s.reads, i, i+1)
+			}
+			cancel, done := sr.cancel, sr.done
+			s.mu.Unlock()
+			if cancel != nil {
+				cancel()
+				<-done
+			}
+		})
+	}
+}
+
+// start runs the callback r until the context of Run is canceled. It
+// must be called with s.mu held.
+func (s *Scheduler) start(r *schedRead) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	r.cancel, r.done = cancel, make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer close(r.done)
+		defer cancel()
+		s.loop(ctx, r.Read)
+	}()
+}
+
+// Run calls the registered callbacks until ctx is canceled and then
+// waits for running calls to return. It returns ctx.Err().
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.mu.Lock()
+	if s.ctx != nil {
+		s.mu.Unlock()
+		panic("collector: Scheduler is already running")
+	}
+	s.ctx = ctx
+	for _, r := range s.reads {
+		s.start(r)
+	}
+	s.mu.Unlock()
+	<-ctx.Done()
+	s.mu.Lock()
+	s.ctx = nil
+	s.mu.Unlock()
+	s.wg.Wait()
+	return ctx.Err()
+}
+
+func (s *Scheduler) loop(ctx context.Context, r Read) {
+	maxBackoff := s.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = 24 * time.Hour
+	}
+	var backoff time.Duration
+	var notBefore time.Time
+	r.Schedule.Run(ctx, func(ctx context.Context, t time.Time) {
+		if t.Before(notBefore) {
+			return
+		}
+		if err := s.read(ctx, r, t); err != nil {
+			s.report(r.Name, err)
+			if backoff == 0 {
+				backoff = r.Schedule.Interval
+			}
+			backoff = min(2*backoff, maxBackoff)
+			notBefore = t.Add(backoff)
+			return
+		}
+		backoff, notBefore = 0, time.Time{}
+	})
+}
+
+// read calls r once and writes the returned value lists. It returns
+// the callback's error; errors of the writer are reported directly.
+func (s *Scheduler) read(ctx context.Context, r Read, t time.Time) error {
+	rctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	vls, err := call(rctx, r.Func)
+	if err == nil && rctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("read callback exceeded its timeout of %s", r.Timeout)
+	}
+	for _, vl := range vls {
+		if vl.Time.IsZero() {
+			vl.Time = t
+		}
+		if vl.Interval == 0 {
+			vl.Interval = r.Schedule.Interval
+		}
+		if werr := s.Writer.Write(ctx, vl); werr != nil {
+			s.report(r.Name, werr)
+			break
+		}
+	}
+	return err
+}
+
+// call calls fn, turning a panic into an error.
+func call(ctx context.Context, fn ReadFunc) (vls []collectd.ValueList, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("read callback panicked: %v", p)
+		}
+	}()
+	return fn(ctx)
+}
+
+func (s *Scheduler) report(name string, err error) {
+	if s.OnError != nil {
+		s.OnError(name, err)
+	}
+}
@@ -0,0 +1,94 @@
+package collector
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// DBStats collects the connection pool statistics of database/sql
+// handles. The plugin instance of each handle's value lists is the
+// name it was registered with. The zero value is ready to use.
+type DBStats struct {
+	// Host is the host of the value lists. If it is empty, the host
+	// name collectd would use is determined once and used.
+	Host string
+	// Plugin is the plugin of the value lists. It defaults to
+	// "database_sql".
+	Plugin string
+
+	mu  sync.Mutex
+	dbs []namedDB
+}
+
+type namedDB struct {
+	name string
+	db   *sql.DB
+}
+
+// Register adds db to the handles whose statistics are collected,
+// under name, such as the name of the database. Registering a name
+// again replaces the handle.
+func (s *DBStats) Register(name string, db *sql.DB) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.dbs {
+		if s.dbs[i].name == name {
+			s.dbs[i].db = db
+			return
+		}
+	}
+	s.dbs = append(s.dbs, namedDB{name, db})
+}
+
+// Unregister removes the handle registered under name.
+func (s *DBStats) Unregister(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.dbs {
+		if s.dbs[i].name == name {
+			s.dbs = append(s.dbs[:i], s.dbs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Collect returns the current statistics of all handles, leaving the
+// time of the value lists to the caller. Connection counts are gauges
+// of type "count", and the cumulative numbers of waits and closed
+// connections are derives of type "operations". The time spent
+// waiting for connections is a derive of type "total_time_in_ms".
+func (s *DBStats) Collect(ctx context.Context) ([]collectd.ValueList, error) {
+	s.mu.Lock()
+	dbs := append([]namedDB(nil), s.dbs...)
+	s.mu.Unlock()
+	plugin := s.Plugin
+	if plugin == "" {
+		plugin = "database_sql"
+	}
+	var vls []collectd.ValueList
+	for _, ndb := range dbs {
+		st := ndb.db.Stats()
+		id := collectd.Identifier{Host: hostname(s.Host), Plugin: plugin, PluginInstance: ndb.name}
+		vl := func(typ, typeInstance string, v collectd.Value) collectd.ValueList {
+			id := id
+			id.Type, id.TypeInstance = typ, typeInstance
+			return collectd.ValueList{Identifier: id, Values: []collectd.Value{v}}
+		}
+		vls = append(vls,
+			vl("count", "max_open", collectd.Gauge(st.MaxOpenConnections)),
+			vl("count", "open", collectd.Gauge(st.OpenConnections)),
+			vl("count", "in_use", collectd.Gauge(st.InUse)),
+			vl("count", "idle", collectd.Gauge(st.Idle)),
+			vl("operations", "wait", collectd.Derive(st.WaitCount)),
+			vl("total_time_in_ms", "wait", collectd.Derive(st.WaitDuration/time.Millisecond)),
+			vl("operations", "closed_max_idle", collectd.Derive(st.MaxIdleClosed)),
+			vl("operations", "closed_max_idle_time", collectd.Derive(st.MaxIdleTimeClosed)),
+			vl("operations", "closed_max_lifetime", collectd.Derive(st.MaxLifetimeClosed)),
+		)
+	}
+	return vls, nil
+}
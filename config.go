@@ -0,0 +1,394 @@
+package collectd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSocketFile is the unixsock plugin's default socket path.
+const DefaultSocketFile = "/var/run/collectd-unixsock"
+
+// DefaultNetworkPort is the network plugin's default port.
+const DefaultNetworkPort = "25826"
+
+// Config is the subset of collectd.conf that is needed to find and
+// talk to a collectd instance.
+type Config struct {
+	Hostname   string
+	FQDNLookup bool
+	// Interval is the global interval. It defaults to ten seconds.
+	Interval time.Duration
+	TypesDB  []string
+
+	// SocketFile is the unixsock plugin's socket. It is empty if
+	// the unixsock plugin is neither loaded nor configured.
+	SocketFile string
+	// Listen and Servers are the network plugin's Listen and Server
+	// blocks.
+	Listen  []NetworkEndpoint
+	Servers []NetworkEndpoint
+}
+
+// NetworkEndpoint is a Listen or Server block of the network plugin.
+type NetworkEndpoint struct {
+	Host string
+	Port string
+	// SecurityLevel is one of None, Sign and Encrypt, or empty.
+	SecurityLevel string
+	Username      string
+	Password      string
+	AuthFile      string
+	Interface     string
+	// ResolveInterval is how often a Server's host name is resolved
+	// again. It is zero if not configured.
+	ResolveInterval time.Duration
+}
+
+// configItem is a generic node of a collectd config file.
+type configItem struct {
+	Key      string
+	Values   []string
+	Children []configItem
+}
+
+// ReadConfig reads the collectd configuration at path, following
+// Include directives and blocks. Included directories are read
+// recursively.
+func ReadConfig(path string) (*Config, error) {
+	items, err := readConfigFile(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return configFromItems(items)
+}
+
+// ParseConfig parses a collectd configuration. Include directives
+// are resolved relative to the current directory.
+func ParseConfig(r io.Reader) (*Config, error) {
+	items, err := parseConfig(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	return configFromItems(items)
+}
+
+// DialConfig reads the collectd configuration at path and connects
+// to the socket of its unixsock plugin.
+func DialConfig(path string, opts ...Option) (*Conn, error) {
+	cfg, err := ReadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.SocketFile == "" {
+		return nil, fmt.Errorf("%s: unixsock plugin is not loaded", path)
+	}
+	return DialUnix(cfg.SocketFile, opts...)
+}
+
+const maxIncludeDepth = 8
+
+func readConfigFile(path string, depth int) ([]configItem, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	items, err := parseConfig(f, depth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return items, nil
+}
+
+func parseConfig(r io.Reader, depth int) ([]configItem, error) {
+	type frame struct {
+		item  configItem
+		items []configItem
+	}
+	stack := []frame{{}}
+	sc := bufio.NewScanner(r)
+	var pending string
+	for n := 1; sc.Scan(); n++ {
+		line := pending + sc.Text()
+		pending = ""
+		if strings.HasSuffix(line, `\`) {
+			pending = line[:len(line)-1]
+			continue
+		}
+		toks, err := configTokens(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if len(toks) == 0 {
+			continue
+		}
+		top := &stack[len(stack)-1]
+		switch {
+		case strings.HasPrefix(toks[0], "</"):
+			key := strings.TrimSuffix(toks[0][2:], ">")
+			if len(stack) == 1 || !strings.EqualFold(key, top.item.Key) {
+				return nil, fmt.Errorf("line %d: unexpected closing tag %s", n, toks[0])
+			}
+			top.item.Children = top.items
+			item := top.item
+			stack = stack[:len(stack)-1]
+			parent := &stack[len(stack)-1]
+			if strings.EqualFold(item.Key, "Include") && len(item.Values) > 0 {
+				// <Include "path"> blocks may restrict the included
+				// files with Filter.
+				var filter string
+				for _, c := range item.Children {
+					if strings.EqualFold(c.Key, "Filter") && len(c.Values) > 0 {
+						filter = c.Values[0]
+					}
+				}
+				items, err := includeConfig(item.Values[0], filter, depth)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", n, err)
+				}
+				parent.items = append(parent.items, items...)
+				break
+			}
+			parent.items = append(parent.items, item)
+		case strings.HasPrefix(toks[0], "<"):
+			last := toks[len(toks)-1]
+			if !strings.HasSuffix(last, ">") {
+				return nil, fmt.Errorf("line %d: unterminated block tag", n)
+			}
+			toks[len(toks)-1] = strings.TrimSuffix(last, ">")
+			if toks[len(toks)-1] == "" {
+				toks = toks[:len(toks)-1]
+			}
+			key := toks[0][1:]
+			if key == "" {
+				return nil, fmt.Errorf("line %d: empty block tag", n)
+			}
+			stack = append(stack, frame{item: configItem{Key: key, Values: toks[1:]}})
+		case strings.EqualFold(toks[0], "Include") && len(toks) >= 2:
+			items, err := includeConfig(toks[1], "", depth)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %s", n, err)
+			}
+			top.items = append(top.items, items...)
+		default:
+			top.items = append(top.items, configItem{Key: toks[0], Values: toks[1:]})
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(stack) != 1 {
+		return nil, fmt.Errorf("unclosed block %s", stack[len(stack)-1].item.Key)
+	}
+	return stack[0].items, nil
+}
+
+// includeConfig reads the files matching pattern. Like collectd,
+// it includes directories recursively, skipping hidden files, and
+// only includes files whose names match filter, unless it is empty.
+func includeConfig(pattern, filter string, depth int) ([]configItem, error) {
+	if depth >= maxIncludeDepth {
+		return nil, errors.New("includes nested too deeply")
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var items []configItem
+	for _, path := range paths {
+		more, err := includePath(path, filter, depth)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, more...)
+	}
+	return items, nil
+}
+
+func includePath(path, filter string, depth int) ([]configItem, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		// Skip entries that can't be followed, such as broken
+		// symlinks.
+		return nil, nil
+	}
+	if !fi.IsDir() {
+		if filter != "" {
+			if ok, err := filepath.Match(filter, filepath.Base(path)); err != nil || !ok {
+				return nil, err
+			}
+		}
+		return readConfigFile(path, depth+1)
+	}
+	if depth+1 >= maxIncludeDepth {
+		return nil, errors.New("includes nested too deeply")
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var items []configItem
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		more, err := includePath(filepath.Join(path, e.Name()), filter, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, more...)
+	}
+	return items, nil
+}
+
+// configTokens splits a config line into tokens, removing comments
+// and quotes.
+func configTokens(line string) ([]string, error) {
+	var toks []string
+	var cur strings.Builder
+	inTok, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quoted && ch == '\\' && i+1 < len(line):
+			i++
+			cur.WriteByte(line[i])
+		case ch == '"':
+			quoted = !quoted
+			inTok = true
+		case !quoted && ch == '#':
+			i = len(line)
+		case !quoted && (ch == ' ' || ch == '\t' || ch == '\r'):
+			if inTok {
+				toks = append(toks, cur.String())
+				cur.Reset()
+				inTok = false
+			}
+		default:
+			cur.WriteByte(ch)
+			inTok = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if inTok {
+		toks = append(toks, cur.String())
+	}
+	return toks, nil
+}
+
+func configFromItems(items []configItem) (*Config, error) {
+	cfg := &Config{FQDNLookup: true, Interval: 10 * time.Second}
+	loaded := map[string]bool{}
+	var unixsock bool
+	for _, it := range items {
+		switch strings.ToLower(it.Key) {
+		case "hostname":
+			if len(it.Values) > 0 {
+				cfg.Hostname = it.Values[0]
+			}
+		case "fqdnlookup":
+			if len(it.Values) > 0 {
+				cfg.FQDNLookup = configBool(it.Values[0])
+			}
+		case "interval":
+			d, err := configDuration(it)
+			if err != nil {
+				return nil, err
+			}
+			cfg.Interval = d
+		case "typesdb":
+			cfg.TypesDB = append(cfg.TypesDB, it.Values...)
+		case "loadplugin":
+			if len(it.Values) > 0 {
+				loaded[strings.ToLower(it.Values[0])] = true
+			}
+		case "plugin":
+			if len(it.Values) == 0 {
+				continue
+			}
+			switch strings.ToLower(it.Values[0]) {
+			case "unixsock":
+				unixsock = true
+				for _, c := range it.Children {
+					if strings.EqualFold(c.Key, "SocketFile") && len(c.Values) > 0 {
+						cfg.SocketFile = c.Values[0]
+					}
+				}
+			case "network":
+				for _, c := range it.Children {
+					switch strings.ToLower(c.Key) {
+					case "listen":
+						cfg.Listen = append(cfg.Listen, networkEndpoint(c))
+					case "server":
+						cfg.Servers = append(cfg.Servers, networkEndpoint(c))
+					}
+				}
+			}
+		}
+	}
+	if (loaded["unixsock"] || unixsock) && cfg.SocketFile == "" {
+		cfg.SocketFile = DefaultSocketFile
+	}
+	return cfg, nil
+}
+
+func networkEndpoint(it configItem) NetworkEndpoint {
+	ep := NetworkEndpoint{Port: DefaultNetworkPort}
+	if len(it.Values) > 0 {
+		ep.Host = it.Values[0]
+	}
+	if len(it.Values) > 1 {
+		ep.Port = it.Values[1]
+	}
+	for _, c := range it.Children {
+		if len(c.Values) == 0 {
+			continue
+		}
+		switch strings.ToLower(c.Key) {
+		case "resolveinterval":
+			if d, err := configDuration(c); err == nil {
+				ep.ResolveInterval = d
+			}
+		case "securitylevel":
+			ep.SecurityLevel = c.Values[0]
+		case "username":
+			ep.Username = c.Values[0]
+		case "password":
+			ep.Password = c.Values[0]
+		case "authfile":
+			ep.AuthFile = c.Values[0]
+		case "interface":
+			ep.Interface = c.Values[0]
+		}
+	}
+	return ep
+}
+
+func configBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "true", "yes", "on":
+		return true
+	default:
+		return false
+	}
+}
+
+func configDuration(it configItem) (time.Duration, error) {
+	if len(it.Values) == 0 {
+		return 0, fmt.Errorf("%s: missing value", it.Key)
+	}
+	f, err := strconv.ParseFloat(it.Values[0], 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", it.Key, it.Values[0])
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
@@ -0,0 +1,83 @@
+package collectd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"collectd.conf.d/unixsock.conf":     "LoadPlugin unixsock\n<Plugin unixsock>\n  SocketFile \"/run/collectd.sock\"\n</Plugin>\n",
+		"collectd.conf.d/zz.conf.dpkg":      "Hostname \"unfiltered\"\n",
+		"collectd.conf.d/.hidden.conf":      "Hostname \"hidden\"\n",
+		"collectd.conf.d/sub/hostname.conf": "Hostname \"web1\"\n",
+		"single.conf":                       "Hostname \"single\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	confd := filepath.Join(dir, "collectd.conf.d")
+
+	tests := []struct {
+		name       string
+		config     string
+		hostname   string
+		socketFile string
+	}{
+		{
+			name:     "file",
+			config:   `Include "` + filepath.Join(dir, "single.conf") + `"`,
+			hostname: "single",
+		},
+		{
+			name:     "glob",
+			config:   `Include "` + filepath.Join(dir, "sing*.conf") + `"`,
+			hostname: "single",
+		},
+		{
+			name:       "directory",
+			config:     `Include "` + confd + `"`,
+			hostname:   "unfiltered",
+			socketFile: "/run/collectd.sock",
+		},
+		{
+			name:       "block with filter",
+			config:     "<Include \"" + confd + "\">\n  Filter \"*.conf\"\n</Include>",
+			hostname:   "web1",
+			socketFile: "/run/collectd.sock",
+		},
+		{
+			name:     "block with filter matching nothing",
+			config:   "Hostname \"default\"\n<Include \"" + confd + "\">\n  Filter \"*.nomatch\"\n</Include>",
+			hostname: "default",
+		},
+		{
+			name:     "missing file",
+			config:   "Hostname \"default\"\nInclude \"" + filepath.Join(dir, "missing.conf") + "\"",
+			hostname: "default",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ParseConfig(strings.NewReader(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Hostname != tt.hostname {
+				t.Errorf("got hostname %q, want %q", cfg.Hostname, tt.hostname)
+			}
+			if cfg.SocketFile != tt.socketFile {
+				t.Errorf("got socket file %q, want %q", cfg.SocketFile, tt.socketFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package collectd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"path"
+	"sync"
+)
+
+// ConversionRule relates notifications and values. Notifications
+// matching Pattern are converted into gauges submitted under
+// Identifier, and, if Watch is set, values matching Pattern generate
+// notifications when they cross Threshold.
+type ConversionRule struct {
+	// Pattern is matched against identifiers using path.Match.
+	Pattern string
+
+	// Identifier is the identifier of the gauge that notifications
+	// are converted into. Empty fields are filled in from the
+	// notification. If Type is empty, notifications are not
+	// converted.
+	Identifier Identifier
+	// SeverityValues maps severities to gauge values. If nil,
+	// failures and warnings map to 1 and okay maps to 0.
+	SeverityValues map[Severity]float64
+
+	// Watch enables generating notifications from values.
+	Watch bool
+	// Index selects the data source that is compared against
+	// Threshold.
+	Index int
+	// Threshold is the value at or above which a value is
+	// considered failing, or at or below which if Below is set.
+	Threshold float64
+	Below     bool
+	// Severity is the severity of notifications for failing
+	// values. It defaults to SeverityFailure. Recovery is always
+	// announced with SeverityOkay.
+	Severity Severity
+}
+
+var defaultSeverityValues = map[Severity]float64{
+	SeverityFailure: 1,
+	SeverityWarning: 1,
+	SeverityOkay:    0,
+}
+
+// NotificationConverter is a processing stage that converts
+// notifications into gauge values, so that alerting state can be
+// graphed, and value transitions into notifications, so that graphed
+// values can alert. Values and notifications are passed on
+// unchanged in addition to the converted ones.
+type NotificationConverter struct {
+	Rules []ConversionRule
+	// Next receives all value lists, including the ones converted
+	// from notifications.
+	Next Writer
+	// Notifications receives all notifications, including the ones
+	// generated from values. It may be nil.
+	Notifications NotificationWriter
+
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+var (
+	_ Writer             = (*NotificationConverter)(nil)
+	_ NotificationWriter = (*NotificationConverter)(nil)
+)
+
+// WriteNotification converts n according to the matching rules and
+// passes it on.
+func (c *NotificationConverter) WriteNotification(ctx context.Context, n Notification) error {
+	name := n.Identifier.String()
+	for _, r := range c.Rules {
+		if r.Identifier.Type == "" {
+			continue
+		}
+		if ok, _ := path.Match(r.Pattern, name); !ok {
+			continue
+		}
+		sv := r.SeverityValues
+		if sv == nil {
+			sv = defaultSeverityValues
+		}
+		v, ok := sv[n.Severity]
+		if !ok {
+			continue
+		}
+		id := r.Identifier
+		fill(&id.Host, n.Host)
+		fill(&id.Plugin, n.Plugin)
+		fill(&id.PluginInstance, n.PluginInstance)
+		fill(&id.TypeInstance, n.TypeInstance)
+		vl := ValueList{Identifier: id, Time: n.Time, Values: []Value{Gauge(v)}}
+		if err := c.Next.Write(ctx, vl); err != nil {
+			return err
+		}
+	}
+	if c.Notifications == nil {
+		return nil
+	}
+	return c.Notifications.WriteNotification(ctx, n)
+}
+
+func fill(dst *string, src string) {
+	if *dst == "" {
+		*dst = src
+	}
+}
+
+// Write passes vl on, generating notifications for values that
+// started or stopped failing according to the matching rules.
+func (c *NotificationConverter) Write(ctx context.Context, vl ValueList) error {
+	if err := c.Next.Write(ctx, vl); err != nil {
+		return err
+	}
+	if c.Notifications == nil {
+		return nil
+	}
+	name := vl.Identifier.String()
+	for i, r := range c.Rules {
+		if !r.Watch || r.Index >= len(vl.Values) {
+			continue
+		}
+		if ok, _ := path.Match(r.Pattern, name); !ok {
+			continue
+		}
+		v, ok := vl.Values[r.Index].(Gauge)
+		if !ok || math.IsNaN(float64(v)) {
+			continue
+		}
+		failing := float64(v) >= r.Threshold
+		if r.Below {
+			failing = float64(v) <= r.Threshold
+		}
+		key := fmt.Sprintf("%d %s", i, name)
+		c.mu.Lock()
+		if c.failing == nil {
+			c.failing = map[string]bool{}
+		}
+		was := c.failing[key]
+		c.failing[key] = failing
+		c.mu.Unlock()
+		if was == failing {
+			continue
+		}
+		n := Notification{Identifier: vl.Identifier, Time: vl.Time}
+		if failing {
+			n.Severity = r.Severity
+			if n.Severity == 0 {
+				n.Severity = SeverityFailure
+			}
+			n.Message = fmt.Sprintf("value %g crossed threshold %g", float64(v), r.Threshold)
+		} else {
+			n.Severity = SeverityOkay
+			n.Message = fmt.Sprintf("value %g is back within threshold %g", float64(v), r.Threshold)
+		}
+		if err := c.Notifications.WriteNotification(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
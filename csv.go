@@ -0,0 +1,154 @@
+package collectd
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// CSVWriter is a Writer that appends value lists to files in the
+// layout and format of collectd's csv plugin, so that its output can
+// be archived or compared with that of collectd. Each identifier has
+// a file per day, dir/host/plugin-instance/type-instance-YYYY-MM-DD,
+// that starts with a header line naming the data sources. Every value
+// list becomes a line of its time in seconds since the epoch and its
+// values, separated by commas. Values are written as they are;
+// collectd's StoreRates option is not supported.
+type CSVWriter struct {
+	// TypesDB provides the data source names of header lines. If it
+	// is nil, they are named as by TypesDB.DSNames.
+	TypesDB TypesDB
+	// NoDate omits the date from file names, like setting the csv
+	// plugin's WithDateInFilename option to false.
+	NoDate bool
+
+	dir string
+
+	errs health.ErrorTracker
+	mu   sync.Mutex
+}
+
+var _ Writer = (*CSVWriter)(nil)
+
+// NewCSVWriter returns a CSVWriter that writes below dir, which is
+// created when needed.
+func NewCSVWriter(dir string) *CSVWriter {
+	return &CSVWriter{dir: dir}
+}
+
+// Path returns the file that values of id at time t are written to.
+// Like collectd, it uses the local date.
+func (w *CSVWriter) Path(id Identifier, t time.Time) string {
+	typ := id.Type
+	if id.TypeInstance != "" {
+		typ += "-" + id.TypeInstance
+	}
+	if !w.NoDate {
+		typ += "-" + t.Local().Format("2006-01-02")
+	}
+	plugin := id.Plugin
+	if id.PluginInstance != "" {
+		plugin += "-" + id.PluginInstance
+	}
+	return filepath.Join(w.dir, csvPathPart(id.Host), csvPathPart(plugin), csvPathPart(typ))
+}
+
+// csvPathPart makes s safe for use as a single path element.
+func csvPathPart(s string) string {
+	s = strings.ReplaceAll(s, "/", "_")
+	if s == "." || s == ".." || s == "" {
+		s = "_" + s
+	}
+	return s
+}
+
+// Write appends vl to its file, creating the file with a header line
+// if it doesn't exist. A zero time means now.
+func (w *CSVWriter) Write(ctx context.Context, vl ValueList) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if vl.Time.IsZero() {
+		vl.Time = time.Now()
+	}
+	err := w.write(vl)
+	w.errs.Track(err)
+	return err
+}
+
+func (w *CSVWriter) write(vl ValueList) error {
+	path := w.Path(vl.Identifier, vl.Time)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	var b []byte
+	if fi, err := f.Stat(); err == nil && fi.Size() == 0 {
+		b = append(b, "epoch"...)
+		for _, name := range w.TypesDB.DSNames(vl) {
+			b = append(b, ',')
+			b = append(b, name...)
+		}
+		b = append(b, '\n')
+	}
+	b = append(b, formatTime(vl.Time, 3)...)
+	for _, v := range vl.Values {
+		b = append(b, ',')
+		b = appendCSVValue(b, v)
+	}
+	b = append(b, '\n')
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// appendCSVValue formats v like the csv plugin's printf formats.
+func appendCSVValue(b []byte, v Value) []byte {
+	switch v := v.(type) {
+	case Gauge:
+		switch f := float64(v); {
+		case math.IsNaN(f):
+			return append(b, "nan"...)
+		case math.IsInf(f, 1):
+			return append(b, "inf"...)
+		case math.IsInf(f, -1):
+			return append(b, "-inf"...)
+		default:
+			return strconv.AppendFloat(b, f, 'f', 6, 64)
+		}
+	case Derive:
+		return strconv.AppendInt(b, int64(v), 10)
+	case Counter:
+		return strconv.AppendUint(b, uint64(v), 10)
+	case Absolute:
+		return strconv.AppendUint(b, uint64(v), 10)
+	default:
+		return b
+	}
+}
+
+// Health reports the writer as healthy and connected, along with the
+// last error of a write.
+func (w *CSVWriter) Health() Health {
+	err, when := w.errs.Last()
+	return Health{
+		Healthy:       true,
+		Connected:     true,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
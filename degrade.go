@@ -0,0 +1,156 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// DegradeConfig controls when and how a Degrader reduces the amount
+// of data it submits.
+type DegradeConfig struct {
+	// Threshold is the number of consecutive failed submissions
+	// after which the Degrader switches to degraded mode. Only
+	// IOErrors count as failures; values that collectd rejects
+	// don't indicate a problem with the connection.
+	Threshold int
+	// Recovery is the number of consecutive successful submissions
+	// in degraded mode after which full fidelity is restored. It
+	// defaults to Threshold.
+	Recovery int
+	// SampleRate causes only every SampleRate-th value to be
+	// submitted while degraded. Values of 0 and 1 disable sampling.
+	SampleRate int
+	// LowPriority lists plugins whose values are dropped entirely
+	// while degraded.
+	LowPriority []string
+	// Notify, if not nil, is called whenever the Degrader enters
+	// or leaves degraded mode. err is the last submission error when
+	// entering degraded mode, and nil when leaving it.
+	Notify func(degraded bool, err error)
+}
+
+// A Degrader wraps a Writer and automatically degrades the
+// submission of values after sustained failures, restoring full
+// fidelity once collectd recovers. If the Writer is a
+// NotificationWriter, recovery is additionally announced to collectd
+// as a notification, on a best effort basis. Entering degraded mode
+// is only reported to DegradeConfig.Notify, as the connection it
+// would be announced over is the one failing.
+type Degrader struct {
+	w   Writer
+	cfg DegradeConfig
+
+	errs health.ErrorTracker
+
+	mu       sync.Mutex
+	degraded bool
+	failures int
+	success  int
+	seen     int
+}
+
+var _ Writer = (*Degrader)(nil)
+
+// NewDegrader returns a Degrader that submits values to w. As a Conn
+// can't recover from I/O errors, w should usually be a Redialer.
+func NewDegrader(w Writer, cfg DegradeConfig) *Degrader {
+	if cfg.Threshold <= 0 {
+		cfg.Threshold = 1
+	}
+	if cfg.Recovery <= 0 {
+		cfg.Recovery = cfg.Threshold
+	}
+	return &Degrader{w: w, cfg: cfg}
+}
+
+// Degraded reports whether the Degrader is currently in degraded
+// mode.
+func (d *Degrader) Degraded() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.degraded
+}
+
+// Write writes vl to the underlying writer. While degraded, value
+// lists of low priority plugins and value lists not selected by
+// sampling are silently dropped.
+func (d *Degrader) Write(ctx context.Context, vl ValueList) error {
+	if !d.admit(vl.Plugin) {
+		return nil
+	}
+	err := d.w.Write(ctx, vl)
+	d.errs.Track(err)
+	d.record(ctx, err)
+	return err
+}
+
+// Health reports the Degrader as connected unless it is degraded.
+func (d *Degrader) Health() Health {
+	err, when := d.errs.Last()
+	return Health{Healthy: true, Connected: !d.Degraded(), LastError: err, LastErrorTime: when}
+}
+
+func (d *Degrader) admit(plugin string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.degraded {
+		return true
+	}
+	for _, p := range d.cfg.LowPriority {
+		if p == plugin {
+			return false
+		}
+	}
+	if d.cfg.SampleRate > 1 {
+		d.seen++
+		return d.seen%d.cfg.SampleRate == 1
+	}
+	return true
+}
+
+// record updates the state with the result of a submission. Errors
+// other than IOErrors are ignored.
+func (d *Degrader) record(ctx context.Context, err error) {
+	var ioErr IOError
+	if err != nil && !errors.As(err, &ioErr) {
+		return
+	}
+	d.mu.Lock()
+	var changed bool
+	if err != nil {
+		d.success = 0
+		d.failures++
+		if !d.degraded && d.failures >= d.cfg.Threshold {
+			d.degraded = true
+			d.seen = 0
+			changed = true
+		}
+	} else {
+		d.failures = 0
+		d.success++
+		if d.degraded && d.success >= d.cfg.Recovery {
+			d.degraded = false
+			changed = true
+		}
+	}
+	degraded := d.degraded
+	d.mu.Unlock()
+
+	if !changed {
+		return
+	}
+	if d.cfg.Notify != nil {
+		d.cfg.Notify(degraded, err)
+	}
+	if nw, ok := d.w.(NotificationWriter); ok && !degraded {
+		nw.WriteNotification(ctx, Notification{
+			Severity: SeverityOkay,
+			Time:     time.Now(),
+			Message:  "collectd submissions recovered, restoring full fidelity",
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// flakyWriter fails with an IOError while down and records the
+// notifications it receives.
+type flakyWriter struct {
+	down          bool
+	notifications []Notification
+}
+
+func (w *flakyWriter) Write(ctx context.Context, vl ValueList) error {
+	if w.down {
+		return IOError{errors.New("connection refused")}
+	}
+	return nil
+}
+
+func (w *flakyWriter) WriteNotification(ctx context.Context, n Notification) error {
+	if w.down {
+		return IOError{errors.New("connection refused")}
+	}
+	w.notifications = append(w.notifications, n)
+	return nil
+}
+
+func TestDegraderRecovers(t *testing.T) {
+	type change struct {
+		degraded bool
+		err      error
+	}
+	var changes []change
+	w := &flakyWriter{}
+	d := NewDegrader(w, DegradeConfig{
+		Threshold:   2,
+		Recovery:    3,
+		LowPriority: []string{"debug"},
+		Notify:      func(degraded bool, err error) { changes = append(changes, change{degraded, err}) },
+	})
+	ctx := context.Background()
+	vl := ValueList{Identifier: Identifier{Host: "example.com", Plugin: "cpu", Type: "gauge"}, Values: []Value{Gauge(1)}}
+	low := ValueList{Identifier: Identifier{Host: "example.com", Plugin: "debug", Type: "gauge"}, Values: []Value{Gauge(1)}}
+
+	w.down = true
+	d.Write(ctx, vl)
+	if d.Degraded() {
+		t.Fatal("degraded after a single failure")
+	}
+	d.Write(ctx, vl)
+	if !d.Degraded() {
+		t.Fatal("not degraded after reaching the threshold")
+	}
+	if len(changes) != 1 || !changes[0].degraded || changes[0].err == nil {
+		t.Fatalf("got changes %v, want one change to degraded mode", changes)
+	}
+	if err := d.Write(ctx, low); err != nil {
+		t.Errorf("low priority value list wasn't dropped: %s", err)
+	}
+
+	w.down = false
+	for i := 0; i < 3; i++ {
+		if !d.Degraded() {
+			t.Fatalf("recovered after %d successes, want 3", i)
+		}
+		if err := d.Write(ctx, vl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d.Degraded() {
+		t.Fatal("still degraded after recovering")
+	}
+	if len(changes) != 2 || changes[1].degraded || changes[1].err != nil {
+		t.Errorf("got changes %v, want a change to degraded mode and back", changes)
+	}
+	if len(w.notifications) != 1 || w.notifications[0].Severity != SeverityOkay {
+		t.Errorf("got notifications %v, want one recovery notification", w.notifications)
+	}
+}
@@ -0,0 +1,198 @@
+package collectd
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// DownsampleFunc is a function that a Downsampler reduces the gauges
+// of an interval with.
+type DownsampleFunc int
+
+// The functions that gauges can be reduced with.
+const (
+	DownsampleAverage DownsampleFunc = iota
+	DownsampleMinimum
+	DownsampleMaximum
+	DownsampleLast
+)
+
+func (f DownsampleFunc) String() string {
+	switch f {
+	case DownsampleAverage:
+		return "average"
+	case DownsampleMinimum:
+		return "minimum"
+	case DownsampleMaximum:
+		return "maximum"
+	case DownsampleLast:
+		return "last"
+	default:
+		return fmt.Sprintf("DownsampleFunc(%d)", int(f))
+	}
+}
+
+// Downsampler is a Writer that buffers the value lists written to it
+// and, while Run is running, writes one value list per identifier and
+// interval to another writer, so that applications can sample at a
+// higher frequency than collectd should receive.
+//
+// Gauges are reduced with the functions in Funcs. Counters and derives
+// are cumulative, so their last value is written. Absolute values are
+// reset whenever they are read, so they are summed up. Identifiers
+// without value lists in an interval are not written.
+type Downsampler struct {
+	// Next receives the downsampled value lists.
+	Next Writer
+	// Interval is the interval at which value lists are written. It
+	// defaults to ten seconds.
+	Interval time.Duration
+	// Funcs are the functions that gauges are reduced with. It
+	// defaults to DownsampleAverage. If there is more than one
+	// function, one value list is written per function, with the
+	// name of the function, such as "maximum", appended to the type
+	// instance. Value lists without gauges are written once, with
+	// their original identifier.
+	Funcs []DownsampleFunc
+
+	errs   health.ErrorTracker
+	failed atomic.Bool
+
+	mu      sync.Mutex
+	windows map[Identifier]*window
+}
+
+var _ Writer = (*Downsampler)(nil)
+
+// window holds the values of an identifier in the current interval.
+type window struct {
+	n    int
+	last ValueList
+	// sum, min and max hold the sums, minimums and maximums of the
+	// values.
+	sum, min, max []float64
+}
+
+// Write adds vl to the current interval of its identifier. If the
+// number or types of values differ from those of the interval's
+// previous value lists, the interval starts over with vl.
+func (d *Downsampler) Write(ctx context.Context, vl ValueList) error {
+	if len(vl.Values) == 0 {
+		return fmt.Errorf("value list of %s has no values", vl.Identifier)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.windows == nil {
+		d.windows = map[Identifier]*window{}
+	}
+	w, ok := d.windows[vl.Identifier]
+	if !ok || !sameDSTypes(w.last.Values, vl.Values) {
+		w = &window{
+			sum: make([]float64, len(vl.Values)),
+			min: make([]float64, len(vl.Values)),
+			max: make([]float64, len(vl.Values)),
+		}
+		d.windows[vl.Identifier] = w
+	}
+	for i, v := range vl.Values {
+		f := valueFloat(v)
+		w.sum[i] += f
+		if w.n == 0 || f < w.min[i] {
+			w.min[i] = f
+		}
+		if w.n == 0 || f > w.max[i] {
+			w.max[i] = f
+		}
+	}
+	w.n++
+	w.last = vl
+	return nil
+}
+
+// Run writes the downsampled value lists every interval until ctx is
+// canceled. They have the scheduled time of the write and the
+// downsampler's interval. Run returns ctx.Err().
+func (d *Downsampler) Run(ctx context.Context) error {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return Schedule{Interval: interval}.Run(ctx, func(ctx context.Context, t time.Time) {
+		for _, vl := range d.collect(t, interval) {
+			err := d.Next.Write(ctx, vl)
+			d.errs.Track(err)
+			d.failed.Store(err != nil)
+		}
+	})
+}
+
+// collect returns the downsampled value lists of the current interval
+// and starts a new one.
+func (d *Downsampler) collect(t time.Time, interval time.Duration) []ValueList {
+	d.mu.Lock()
+	windows := d.windows
+	d.windows = nil
+	d.mu.Unlock()
+
+	funcs := d.Funcs
+	if len(funcs) == 0 {
+		funcs = []DownsampleFunc{DownsampleAverage}
+	}
+	var out []ValueList
+	for id, w := range windows {
+		funcs := funcs
+		if !slices.ContainsFunc(w.last.Values, func(v Value) bool { return v.DSType() == DSTypeGauge }) {
+			funcs = funcs[:1]
+		}
+		for _, fn := range funcs {
+			vl := ValueList{Identifier: id, Time: t, Interval: interval, Meta: w.last.Meta}
+			if len(funcs) > 1 {
+				vl.TypeInstance = joinNonEmpty(vl.TypeInstance, fn.String())
+			}
+			vl.Values = make([]Value, len(w.last.Values))
+			for i, v := range w.last.Values {
+				vl.Values[i] = w.reduce(i, v, fn)
+			}
+			out = append(out, vl)
+		}
+	}
+	return out
+}
+
+// reduce returns the reduced value of the i-th data source, whose last
+// value is last.
+func (w *window) reduce(i int, last Value, fn DownsampleFunc) Value {
+	switch last.(type) {
+	case Gauge:
+		switch fn {
+		case DownsampleAverage:
+			return Gauge(w.sum[i] / float64(w.n))
+		case DownsampleMinimum:
+			return Gauge(w.min[i])
+		case DownsampleMaximum:
+			return Gauge(w.max[i])
+		case DownsampleLast:
+			return last
+		default:
+			return Gauge(math.NaN())
+		}
+	case Absolute:
+		return Absolute(w.sum[i])
+	default:
+		return last
+	}
+}
+
+// Health reports the Downsampler as connected if the most recent write
+// of a value list succeeded.
+func (d *Downsampler) Health() Health {
+	err, when := d.errs.Last()
+	return Health{Healthy: true, Connected: !d.failed.Load(), LastError: err, LastErrorTime: when}
+}
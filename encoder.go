@@ -0,0 +1,53 @@
+package collectd
+
+import "context"
+
+// An Encoder encodes value lists as message payloads, in one of the
+// formats that collectd's write_kafka and amqp plugins produce, for
+// use with any message broker client. CommandEncoder, JSONEncoder and
+// graphite.Formatter are Encoders.
+type Encoder interface {
+	// Encode appends the encoding of vl to dst.
+	Encode(dst []byte, vl ValueList) ([]byte, error)
+}
+
+// CommandEncoder encodes value lists as PUTVAL commands without a
+// trailing newline, like the Command format of write_kafka and amqp.
+type CommandEncoder struct{}
+
+// Encode implements Encoder.
+func (CommandEncoder) Encode(dst []byte, vl ValueList) ([]byte, error) {
+	return append(dst, FormatPutval(vl)...), nil
+}
+
+// JSONEncoder encodes value lists as JSON arrays holding a single
+// value list, like the JSON format of write_kafka and amqp.
+type JSONEncoder struct {
+	// TypesDB provides data source names. If it is nil, they are
+	// named as by TypesDB.DSNames.
+	TypesDB TypesDB
+}
+
+// Encode implements Encoder.
+func (e JSONEncoder) Encode(dst []byte, vl ValueList) ([]byte, error) {
+	dst = append(dst, '[')
+	dst, err := AppendJSON(dst, vl, e.TypesDB)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, ']'), nil
+}
+
+// EncodingWriter returns a Writer that encodes value lists with enc
+// and passes the payloads to publish, for example to produce a Kafka
+// message or publish to an AMQP exchange. The value list is passed
+// along to allow deriving message keys or routing keys from it.
+func EncodingWriter(enc Encoder, publish func(ctx context.Context, vl ValueList, payload []byte) error) Writer {
+	return WriterFunc(func(ctx context.Context, vl ValueList) error {
+		b, err := enc.Encode(nil, vl)
+		if err != nil {
+			return err
+		}
+		return publish(ctx, vl, b)
+	})
+}
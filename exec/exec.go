@@ -0,0 +1,118 @@
+// Package exec helps writing programs for collectd's exec plugin,
+// which runs them and reads PUTVAL and PUTNOTIF commands from their
+// standard output.
+package exec // import "honnef.co/go/collectd/exec"
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// DefaultInterval is the interval used when COLLECTD_INTERVAL is not
+// set, as when running a program outside of collectd.
+const DefaultInterval = 10 * time.Second
+
+// Hostname returns the host name that collectd passes in
+// COLLECTD_HOSTNAME. Outside of collectd, it falls back to
+// collectd.Hostname, which is only called once.
+func Hostname() string {
+	if name := os.Getenv("COLLECTD_HOSTNAME"); name != "" {
+		return name
+	}
+	return fallbackHostname()
+}
+
+var fallbackHostname = sync.OnceValue(func() string {
+	name, err := collectd.Hostname(true)
+	if err != nil {
+		return "localhost"
+	}
+	return name
+})
+
+// Interval returns the interval that collectd passes in
+// COLLECTD_INTERVAL, or DefaultInterval if it is missing or invalid.
+func Interval() time.Duration {
+	f, err := strconv.ParseFloat(os.Getenv("COLLECTD_INTERVAL"), 64)
+	if err != nil || f <= 0 {
+		return DefaultInterval
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+// Putval writes vl to w as a PUTVAL line. An empty host is replaced
+// by Hostname and a zero interval by Interval, so that values are
+// reported like those of collectd's own plugins.
+func Putval(w io.Writer, vl collectd.ValueList) error {
+	if vl.Host == "" {
+		vl.Host = Hostname()
+	}
+	if vl.Interval == 0 {
+		vl.Interval = Interval()
+	}
+	return writeLine(w, collectd.FormatPutval(vl))
+}
+
+// Putnotif writes n to w as a PUTNOTIF line. An empty host is
+// replaced by Hostname.
+func Putnotif(w io.Writer, n collectd.Notification) error {
+	if n.Host == "" {
+		n.Host = Hostname()
+	}
+	return writeLine(w, collectd.FormatPutnotif(n))
+}
+
+// writeLine writes the command line to w. Commands containing line
+// breaks are rejected with collectd.ErrLineBreak, as collectd would
+// read them as several commands.
+func writeLine(w io.Writer, line string) error {
+	if strings.ContainsAny(line, "\r\n") {
+		return fmt.Errorf("%w: %q", collectd.ErrLineBreak, line)
+	}
+	_, err := io.WriteString(w, line+"\n")
+	return err
+}
+
+// Writer is a collectd.Writer that writes PUTVAL and PUTNOTIF lines,
+// such as to standard output. It is safe for concurrent use, and
+// lines of concurrent calls don't interleave.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+var (
+	_ collectd.Writer             = (*Writer)(nil)
+	_ collectd.NotificationWriter = (*Writer)(nil)
+)
+
+// NewWriter returns a Writer that writes to w. If w is nil, it writes
+// to standard output.
+func NewWriter(w io.Writer) *Writer {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &Writer{w: w}
+}
+
+// Write writes vl using Putval.
+func (w *Writer) Write(ctx context.Context, vl collectd.ValueList) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return Putval(w.w, vl)
+}
+
+// WriteNotification writes n using Putnotif.
+func (w *Writer) WriteNotification(ctx context.Context, n collectd.Notification) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return Putnotif(w.w, n)
+}
@@ -0,0 +1,84 @@
+package exec
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// ReadNotification reads a notification in the format that
+// collectd's exec plugin writes to the standard input of
+// NotificationExec programs: header lines such as "Severity: WARNING",
+// an empty line and the message. Headers other than the severity,
+// time and identifier fields, such as those the threshold plugin
+// adds, are returned as meta data.
+func ReadNotification(r io.Reader) (collectd.Notification, map[string]string, error) {
+	var (
+		n       collectd.Notification
+		meta    map[string]string
+		haveSev bool
+	)
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err == io.EOF {
+			// The headers must be followed by an empty line.
+			return collectd.Notification{}, nil, errors.New("exec: notification has no message")
+		} else if err != nil {
+			return collectd.Notification{}, nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return collectd.Notification{}, nil, fmt.Errorf("exec: invalid header line %q", line)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(key) {
+		case "severity":
+			if n.Severity, err = collectd.ParseSeverity(value); err != nil {
+				return collectd.Notification{}, nil, fmt.Errorf("exec: %s", err)
+			}
+			haveSev = true
+		case "time":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return collectd.Notification{}, nil, fmt.Errorf("exec: invalid time %q", value)
+			}
+			n.Time = time.UnixMicro(int64(math.Round(f * 1e6)))
+		case "host":
+			n.Host = value
+		case "plugin":
+			n.Plugin = value
+		case "plugininstance":
+			n.PluginInstance = value
+		case "type":
+			n.Type = value
+		case "typeinstance":
+			n.TypeInstance = value
+		default:
+			if meta == nil {
+				meta = map[string]string{}
+			}
+			meta[key] = value
+		}
+	}
+	if !haveSev {
+		return collectd.Notification{}, nil, errors.New("exec: notification has no severity")
+	}
+	msg, err := io.ReadAll(br)
+	if err != nil {
+		return collectd.Notification{}, nil, err
+	}
+	n.Message = strings.TrimSuffix(strings.TrimSuffix(string(msg), "\n"), "\r")
+	return n, meta, nil
+}
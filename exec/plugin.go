@@ -0,0 +1,164 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// A ReadFunc collects value lists. Value lists without a time are
+// reported with the scheduled time of the read, and those without an
+// interval with the callback's interval.
+type ReadFunc func(ctx context.Context) ([]collectd.ValueList, error)
+
+// Plugin runs read callbacks on their own schedules and writes the
+// value lists they return as PUTVAL lines, much like collectd's
+// plugin.h does for C plugins.
+//
+// Each identifier belongs to the callback that reported it first;
+// other callbacks reporting it are ignored. Value lists that are not
+// newer than the identifier's previous one are dropped, as collectd
+// would reject them anyway.
+type Plugin struct {
+	w *Writer
+
+	mu    sync.Mutex
+	reads []*read
+	ids   map[collectd.Identifier]idState
+}
+
+type read struct {
+	name  string
+	sched collectd.Schedule
+	fn    ReadFunc
+}
+
+type idState struct {
+	owner string
+	last  time.Time
+}
+
+// NewPlugin returns a Plugin that writes to w, or to standard output
+// if w is nil.
+func NewPlugin(w io.Writer) *Plugin {
+	return &Plugin{w: NewWriter(w)}
+}
+
+// DefaultPlugin is the Plugin used by RegisterRead and Main.
+var DefaultPlugin = NewPlugin(nil)
+
+// RegisterRead registers fn as the read callback name, which is called
+// once per interval. If interval is zero, Interval is used. It panics
+// if a callback with the same name exists.
+func (p *Plugin) RegisterRead(name string, interval time.Duration, fn ReadFunc, opts ...RunOption) {
+	s := collectd.Schedule{Interval: interval}
+	if s.Interval <= 0 {
+		s.Interval = Interval()
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, r := range p.reads {
+		if r.name == name {
+			panic(fmt.Sprintf("exec: a read callback named %q already exists", name))
+		}
+	}
+	p.reads = append(p.reads, &read{name: name, sched: s, fn: fn})
+}
+
+// RegisterRead registers a read callback with DefaultPlugin.
+func RegisterRead(name string, interval time.Duration, fn ReadFunc, opts ...RunOption) {
+	DefaultPlugin.RegisterRead(name, interval, fn, opts...)
+}
+
+// Run calls the read callbacks until ctx is canceled or the program
+// receives SIGTERM or an interrupt, like the function Run. Errors of
+// callbacks are printed to standard error.
+func (p *Plugin) Run(ctx context.Context) error {
+	p.mu.Lock()
+	reads := p.reads
+	p.mu.Unlock()
+	if len(reads) == 0 {
+		return errors.New("exec: no read callbacks registered")
+	}
+	sctx, stop := signal.NotifyContext(ctx, stopSignals...)
+	defer stop()
+	var wg sync.WaitGroup
+	for _, r := range reads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.sched.Run(sctx, func(ctx context.Context, t time.Time) {
+				p.read(ctx, r, t)
+			})
+		}()
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+// Main runs DefaultPlugin and exits the program when it stops.
+func Main() {
+	if err := DefaultPlugin.Run(context.Background()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func (p *Plugin) read(ctx context.Context, r *read, t time.Time) {
+	vls, err := r.fn(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "exec: read callback %q failed: %s\n", r.name, err)
+	}
+	for _, vl := range vls {
+		if vl.Time.IsZero() {
+			vl.Time = t
+		}
+		if vl.Interval == 0 {
+			vl.Interval = r.sched.Interval
+		}
+		if !p.claim(r.name, vl) {
+			continue
+		}
+		if err := p.w.Write(ctx, vl); err != nil {
+			fmt.Fprintf(os.Stderr, "exec: %s\n", err)
+			return
+		}
+	}
+}
+
+// claim reports whether vl should be written, recording it as the
+// identifier's most recent value list.
+func (p *Plugin) claim(name string, vl collectd.ValueList) bool {
+	host := vl.Host
+	if host == "" {
+		host = Hostname()
+	}
+	id := vl.Identifier
+	id.Host = host
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st, ok := p.ids[id]
+	if ok && st.owner != name {
+		fmt.Fprintf(os.Stderr, "exec: read callback %q reported %s, which belongs to %q\n", name, id, st.owner)
+		return false
+	}
+	if ok && !vl.Time.After(st.last) {
+		return false
+	}
+	if p.ids == nil {
+		p.ids = map[collectd.Identifier]idState{}
+	}
+	p.ids[id] = idState{owner: name, last: vl.Time}
+	return true
+}
@@ -0,0 +1,59 @@
+package exec
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// A RunOption configures Run.
+type RunOption func(*collectd.Schedule)
+
+// WithJitter delays every run by the same random offset of up to d,
+// so that several programs started at once don't run in lockstep.
+func WithJitter(d time.Duration) RunOption {
+	return func(s *collectd.Schedule) {
+		s.Jitter = d
+	}
+}
+
+// WithAlign makes runs happen at multiples of the interval since the
+// epoch, like collectd's own reads.
+func WithAlign() RunOption {
+	return func(s *collectd.Schedule) {
+		s.Align = true
+	}
+}
+
+// Run calls fn immediately and then once per interval, passing a
+// Writer for standard output. If interval is zero, Interval is used,
+// so that the program reads as often as collectd's own plugins.
+// Every line is written to standard output as soon as it is
+// complete, so collectd receives values without delay.
+//
+// Errors returned by fn are printed to standard error, which collectd
+// logs, and don't stop Run. Run returns nil when the program receives
+// SIGTERM, which collectd sends when shutting down, or an interrupt,
+// and ctx.Err() when ctx is canceled.
+func Run(ctx context.Context, interval time.Duration, fn func(ctx context.Context, w *Writer) error, opts ...RunOption) error {
+	s := collectd.Schedule{Interval: interval}
+	if s.Interval <= 0 {
+		s.Interval = Interval()
+	}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	sctx, stop := signal.NotifyContext(ctx, stopSignals...)
+	defer stop()
+	w := NewWriter(os.Stdout)
+	s.Run(sctx, func(ctx context.Context, _ time.Time) {
+		if err := fn(ctx, w); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+	})
+	return ctx.Err()
+}
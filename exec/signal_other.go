@@ -0,0 +1,8 @@
+//go:build !unix
+
+package exec
+
+import "os"
+
+// stopSignals are the signals that end Run.
+var stopSignals = []os.Signal{os.Interrupt}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package exec
+
+import (
+	"os"
+	"syscall"
+)
+
+// stopSignals are the signals that end Run. collectd sends SIGTERM to
+// stop exec programs.
+var stopSignals = []os.Signal{syscall.SIGTERM, os.Interrupt}
@@ -0,0 +1,197 @@
+package collectd
+
+import (
+	"context"
+	"path"
+)
+
+// Verdict is the result of a Target, determining how the processing
+// of a value list continues.
+type Verdict int
+
+// The verdicts of targets, named after their counterparts in
+// collectd's filter chains.
+const (
+	// TargetContinue continues with the next target or rule.
+	TargetContinue Verdict = iota
+	// TargetStop drops the value list, ending its processing in all
+	// chains.
+	TargetStop
+	// TargetReturn leaves the current chain, continuing in the chain
+	// that jumped to it, or with the pipeline's writer.
+	TargetReturn
+)
+
+// A Target acts on value lists selected by a rule. It may modify the
+// value list it is passed. Because Values and Meta are shared with
+// the producer of the value list, targets must replace them instead of
+// modifying them in place.
+type Target interface {
+	Invoke(ctx context.Context, vl *ValueList) (Verdict, error)
+}
+
+// TargetFunc adapts an ordinary function to the Target interface.
+type TargetFunc func(ctx context.Context, vl *ValueList) (Verdict, error)
+
+// Invoke calls f(ctx, vl).
+func (f TargetFunc) Invoke(ctx context.Context, vl *ValueList) (Verdict, error) {
+	return f(ctx, vl)
+}
+
+var (
+	// StopTarget drops value lists, like collectd's stop target.
+	StopTarget Target = TargetFunc(func(context.Context, *ValueList) (Verdict, error) { return TargetStop, nil })
+	// ReturnTarget leaves the current chain, like collectd's return
+	// target.
+	ReturnTarget Target = TargetFunc(func(context.Context, *ValueList) (Verdict, error) { return TargetReturn, nil })
+)
+
+// WriteTarget returns a target that writes value lists to w and
+// continues, like collectd's write target. Followed by StopTarget, it
+// reroutes value lists away from the pipeline's writer.
+func WriteTarget(w Writer) Target {
+	return TargetFunc(func(ctx context.Context, vl *ValueList) (Verdict, error) {
+		return TargetContinue, w.Write(ctx, *vl)
+	})
+}
+
+// JumpTarget returns a target that processes value lists with c, like
+// collectd's jump target. If c stops a value list, so does the target;
+// otherwise it continues.
+func JumpTarget(c *Chain) Target {
+	return TargetFunc(func(ctx context.Context, vl *ValueList) (Verdict, error) {
+		v, err := c.process(ctx, vl)
+		if v == TargetReturn {
+			v = TargetContinue
+		}
+		return v, err
+	})
+}
+
+// SetTarget returns a target that replaces the non-empty fields of
+// identifiers with those of id, like collectd's set target.
+func SetTarget(id Identifier) Target {
+	return TargetFunc(func(ctx context.Context, vl *ValueList) (Verdict, error) {
+		for _, f := range [...]struct {
+			dst *string
+			src string
+		}{
+			{&vl.Host, id.Host},
+			{&vl.Plugin, id.Plugin},
+			{&vl.PluginInstance, id.PluginInstance},
+			{&vl.Type, id.Type},
+			{&vl.TypeInstance, id.TypeInstance},
+		} {
+			if f.src != "" {
+				*f.dst = f.src
+			}
+		}
+		return TargetContinue, nil
+	})
+}
+
+// A Match selects value lists for the targets of a rule.
+type Match func(vl ValueList) bool
+
+// MatchIdentifier returns a match that selects value lists whose
+// identifiers match pattern, like collectd's regex match but using
+// path.Match for each field. Empty fields match everything.
+func MatchIdentifier(pattern Identifier) Match {
+	return func(vl ValueList) bool {
+		return matchIdentifier(pattern, vl.Identifier)
+	}
+}
+
+func matchIdentifier(pattern, id Identifier) bool {
+	for _, f := range [...][2]string{
+		{pattern.Host, id.Host},
+		{pattern.Plugin, id.Plugin},
+		{pattern.PluginInstance, id.PluginInstance},
+		{pattern.Type, id.Type},
+		{pattern.TypeInstance, id.TypeInstance},
+	} {
+		if f[0] == "" {
+			continue
+		}
+		if ok, _ := path.Match(f[0], f[1]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Rule invokes its targets, in order, on the value lists selected by
+// all of its matches. A rule without matches selects all value lists.
+type Rule struct {
+	Matches []Match
+	Targets []Target
+}
+
+func (r *Rule) match(vl ValueList) bool {
+	for _, m := range r.Matches {
+		if !m(vl) {
+			return false
+		}
+	}
+	return true
+}
+
+// Chain is a list of rules that value lists are processed by, in
+// order, until a target stops them or returns. Chains can be composed
+// with JumpTarget, which must not form cycles.
+type Chain struct {
+	Rules []Rule
+}
+
+// process processes vl with the chain's rules. It returns
+// TargetContinue if vl reached the end of the chain.
+func (c *Chain) process(ctx context.Context, vl *ValueList) (Verdict, error) {
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if !r.match(*vl) {
+			continue
+		}
+		for _, t := range r.Targets {
+			v, err := t.Invoke(ctx, vl)
+			if err != nil {
+				return TargetStop, err
+			}
+			if v != TargetContinue {
+				return v, nil
+			}
+		}
+	}
+	return TargetContinue, nil
+}
+
+// Pipeline is a Writer that processes value lists with a chain before
+// writing them to another writer, like collectd's filter chains sit
+// between plugins that dispatch values and write plugins. Value lists
+// that reach the end of the chain or return from it are written to
+// Next, unless it is nil; stopped value lists are dropped. Pipelines
+// can be nested, as a pipeline can be the writer of another one.
+type Pipeline struct {
+	Chain *Chain
+	Next  Writer
+}
+
+var _ Writer = (*Pipeline)(nil)
+
+// Write processes vl with the chain and writes the result to Next.
+// The first error of a target ends the processing of vl and is
+// returned.
+func (p *Pipeline) Write(ctx context.Context, vl ValueList) error {
+	if p.Chain != nil {
+		v, err := p.Chain.process(ctx, &vl)
+		if err != nil {
+			return err
+		}
+		if v == TargetStop {
+			return nil
+		}
+	}
+	if p.Next == nil {
+		return nil
+	}
+	return p.Next.Write(ctx, vl)
+}
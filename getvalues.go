@@ -0,0 +1,53 @@
+package collectd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GetValuesError reports the identifiers for which GetValues failed.
+type GetValuesError struct {
+	Errors map[Identifier]error
+}
+
+func (e *GetValuesError) Error() string {
+	parts := make([]string, 0, len(e.Errors))
+	for id, err := range e.Errors {
+		parts = append(parts, fmt.Sprintf("%s: %s", id, err))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "; ")
+}
+
+// GetValues returns the values of many identifiers, pipelining the
+// GETVAL commands to avoid one round trip per identifier. The results
+// are keyed by identifier. If fetching some of the identifiers
+// failed, the values of the others are returned together with a
+// *GetValuesError.
+func (c *Conn) GetValues(ids []Identifier) (map[Identifier]map[string]float64, error) {
+	cmds := make([]string, len(ids))
+	for i, id := range ids {
+		cmds[i] = "GETVAL " + quote(id.String())
+	}
+	ret := make(map[Identifier]map[string]float64, len(ids))
+	errs := map[Identifier]error{}
+	for i, r := range c.pipeline(context.Background(), cmds) {
+		err := r.err
+		if err == nil {
+			var vals map[string]float64
+			vals, err = parseGetval(r.lines)
+			if err == nil {
+				ret[ids[i]] = vals
+			}
+		}
+		if err != nil {
+			errs[ids[i]] = err
+		}
+	}
+	if len(errs) > 0 {
+		return ret, &GetValuesError{Errors: errs}
+	}
+	return ret, nil
+}
@@ -0,0 +1,21 @@
+module honnef.co/go/collectd
+
+go 1.22
+
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/golang/snappy v0.0.4
+	github.com/prometheus/client_model v0.6.1
+	go.opentelemetry.io/proto/otlp v1.3.1
+	golang.org/x/net v0.30.0
+	golang.org/x/sys v0.26.0
+	google.golang.org/grpc v1.67.1
+	google.golang.org/protobuf v1.35.1
+)
+
+require (
+	github.com/gorilla/websocket v1.5.3 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	golang.org/x/text v0.19.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+)
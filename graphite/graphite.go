@@ -0,0 +1,176 @@
+// Package graphite formats collectd values as Graphite plaintext
+// lines, naming metrics like collectd's write_graphite plugin, so
+// that they can be relayed to Carbon.
+package graphite // import "honnef.co/go/collectd/graphite"
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+var _ collectd.Encoder = (*Formatter)(nil)
+
+// Formatter formats value lists as Graphite plaintext lines of the
+// form "name value timestamp". Its fields correspond to
+// write_graphite's options of the same names. The zero value formats
+// like write_graphite's defaults.
+type Formatter struct {
+	// Prefix is prepended to the host name.
+	Prefix string
+	// Postfix is appended to the host name.
+	Postfix string
+	// EscapeCharacter replaces dots, whitespace and other special
+	// characters in the parts of names. Zero means '_'.
+	EscapeCharacter byte
+	// SeparateInstances separates plugins and types from their
+	// instances with a dot, making them separate levels of the
+	// hierarchy, instead of with a dash.
+	SeparateInstances bool
+	// AlwaysAppendDS appends the data source name even to types with
+	// a single data source.
+	AlwaysAppendDS bool
+	// PreserveSeparator keeps dots in the parts of names.
+	PreserveSeparator bool
+	// DropDuplicateFields omits the type from names if it equals the
+	// plugin.
+	DropDuplicateFields bool
+	// TypesDB provides data source names. If it is nil, they are
+	// named as by collectd.TypesDB.DSNames.
+	TypesDB collectd.TypesDB
+}
+
+// Name returns the metric name of the data source dsName of id. If
+// dsName is empty, it is not appended.
+func (f *Formatter) Name(id collectd.Identifier, dsName string) string {
+	var b strings.Builder
+	b.WriteString(f.Prefix)
+	f.escape(&b, id.Host)
+	b.WriteString(f.Postfix)
+	b.WriteByte('.')
+	plugin := f.instance(id.Plugin, id.PluginInstance)
+	typ := f.instance(id.Type, id.TypeInstance)
+	b.WriteString(plugin)
+	if !f.DropDuplicateFields || plugin != typ {
+		b.WriteByte('.')
+		b.WriteString(typ)
+	}
+	if dsName != "" {
+		b.WriteByte('.')
+		f.escape(&b, dsName)
+	}
+	return b.String()
+}
+
+func (f *Formatter) instance(name, instance string) string {
+	var b strings.Builder
+	f.escape(&b, name)
+	if instance != "" {
+		if f.SeparateInstances {
+			b.WriteByte('.')
+		} else {
+			b.WriteByte('-')
+		}
+		f.escape(&b, instance)
+	}
+	return b.String()
+}
+
+func (f *Formatter) escape(b *strings.Builder, s string) {
+	esc := f.EscapeCharacter
+	if esc == 0 {
+		esc = '_'
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '.' && !f.PreserveSeparator,
+			ch <= ' ', ch == 0x7f, ch == '"', ch == '\\', ch == '/':
+			b.WriteByte(esc)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+}
+
+// AppendValueList appends a line for each value of vl to dst. Values
+// that are NaN or infinite are skipped, as Carbon can't store them.
+// A zero time means now.
+func (f *Formatter) AppendValueList(dst []byte, vl collectd.ValueList) []byte {
+	names := f.TypesDB.DSNames(vl)
+	appendDS := f.AlwaysAppendDS || len(vl.Values) > 1
+	t := vl.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	for i, v := range vl.Values {
+		var val string
+		switch v := v.(type) {
+		case collectd.Gauge:
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				continue
+			}
+			val = strconv.FormatFloat(float64(v), 'f', -1, 64)
+		case collectd.Derive:
+			val = strconv.FormatInt(int64(v), 10)
+		case collectd.Counter:
+			val = strconv.FormatUint(uint64(v), 10)
+		case collectd.Absolute:
+			val = strconv.FormatUint(uint64(v), 10)
+		default:
+			continue
+		}
+		ds := ""
+		if appendDS {
+			ds = names[i]
+		}
+		dst = appendLine(dst, f.Name(vl.Identifier, ds), val, t)
+	}
+	return dst
+}
+
+// Encode implements collectd.Encoder, producing the Graphite format
+// of write_kafka and amqp.
+func (f *Formatter) Encode(dst []byte, vl collectd.ValueList) ([]byte, error) {
+	return f.AppendValueList(dst, vl), nil
+}
+
+// AppendValues appends a line for each of values, as returned by
+// collectd.Conn.GetValue, to dst. Lines are sorted by data source
+// name.
+func (f *Formatter) AppendValues(dst []byte, id collectd.Identifier, values map[string]float64, t time.Time) []byte {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	appendDS := f.AlwaysAppendDS || len(values) > 1
+	if t.IsZero() {
+		t = time.Now()
+	}
+	for _, name := range names {
+		v := values[name]
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		ds := ""
+		if appendDS {
+			ds = name
+		}
+		dst = appendLine(dst, f.Name(id, ds), strconv.FormatFloat(v, 'f', -1, 64), t)
+	}
+	return dst
+}
+
+func appendLine(dst []byte, name, value string, t time.Time) []byte {
+	dst = append(dst, name...)
+	dst = append(dst, ' ')
+	dst = append(dst, value...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendInt(dst, t.Unix(), 10)
+	return append(dst, '\n')
+}
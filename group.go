@@ -0,0 +1,142 @@
+package collectd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// A Group is a named set of identifiers, so that related values, such
+// as the golden signals of a database host, can be operated on as
+// one unit. Patterns may be plain identifiers or contain the
+// wildcards supported by path.Match. Because wildcards do not match
+// slashes, each of host, plugin and type has to be matched
+// separately, e.g. "db1/cpu-*/*".
+type Group struct {
+	Name     string
+	Patterns []string
+}
+
+// Match reports whether the identifier id belongs to the group.
+func (g Group) Match(id string) bool {
+	for _, p := range g.Patterns {
+		if ok, _ := path.Match(p, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (g Group) literal() bool {
+	for _, p := range g.Patterns {
+		if strings.ContainsAny(p, `*?[\`) {
+			return false
+		}
+	}
+	return true
+}
+
+// Groups maps group names to groups.
+type Groups map[string]Group
+
+// Add adds a group, replacing any existing group of the same name.
+func (gs Groups) Add(name string, patterns ...string) {
+	gs[name] = Group{Name: name, Patterns: patterns}
+}
+
+// LoadGroups reads group definitions from r. Each group starts with
+// its name in square brackets, followed by one identifier or pattern
+// per line. Empty lines and lines starting with # are ignored.
+//
+//	# database host golden signals
+//	[db-golden]
+//	db1/cpu-*/cpu-idle
+//	db1/load/load
+func LoadGroups(r io.Reader) (Groups, error) {
+	gs := Groups{}
+	var cur string
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || line[0] == '#':
+		case line[0] == '[':
+			if line[len(line)-1] != ']' || len(line) < 3 {
+				return nil, fmt.Errorf("line %d: malformed group name %q", n, line)
+			}
+			cur = line[1 : len(line)-1]
+			if _, ok := gs[cur]; !ok {
+				gs[cur] = Group{Name: cur}
+			}
+		default:
+			if cur == "" {
+				return nil, fmt.Errorf("line %d: pattern outside of group", n)
+			}
+			if _, err := path.Match(line, ""); err != nil {
+				return nil, fmt.Errorf("line %d: invalid pattern %q: %s", n, line, err)
+			}
+			g := gs[cur]
+			g.Patterns = append(g.Patterns, line)
+			gs[cur] = g
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// ResolveGroup returns the identifiers that belong to g, sorted. If
+// g contains wildcards, the identifiers known to collectd are
+// matched against it.
+func (c *Conn) ResolveGroup(g Group) ([]string, error) {
+	if g.literal() {
+		ids := append([]string(nil), g.Patterns...)
+		sort.Strings(ids)
+		return ids, nil
+	}
+	vals, err := c.ListValues()
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for id := range vals {
+		if g.Match(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// GetGroup returns the values of all identifiers in g, keyed by
+// identifier. See GetValues.
+func (c *Conn) GetGroup(g Group) (map[Identifier]map[string]float64, error) {
+	names, err := c.ResolveGroup(g)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]Identifier, len(names))
+	for i, name := range names {
+		if ids[i], err = ParseIdentifier(name); err != nil {
+			return nil, err
+		}
+	}
+	return c.GetValues(ids)
+}
+
+// FlushGroup flushes cached data of all identifiers in g that is
+// older than timeout seconds. See Flush.
+func (c *Conn) FlushGroup(timeout int, plugins []string, g Group) error {
+	ids, err := c.ResolveGroup(g)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	return c.Flush(timeout, plugins, ids)
+}
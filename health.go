@@ -0,0 +1,91 @@
+package collectd
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Health describes the status of a long-running component.
+type Health struct {
+	// Healthy reports whether the component is functional at all.
+	// An unhealthy component will not recover by itself.
+	Healthy bool
+	// Connected reports whether the component can currently reach
+	// its backend.
+	Connected bool
+	// LastError is the most recent error the component encountered,
+	// and LastErrorTime when it happened.
+	LastError     error
+	LastErrorTime time.Time
+	// Queued is the number of items waiting to be processed, and Lag
+	// how long the most recently processed item had to wait.
+	Queued int
+	Lag    time.Duration
+}
+
+// Ready reports whether the component is healthy and connected.
+func (h Health) Ready() bool {
+	return h.Healthy && h.Connected
+}
+
+// A HealthReporter is a component that can report its health.
+type HealthReporter interface {
+	Health() Health
+}
+
+type healthJSON struct {
+	Healthy       bool       `json:"healthy"`
+	Connected     bool       `json:"connected"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+	Queued        int        `json:"queued,omitempty"`
+	Lag           string     `json:"lag,omitempty"`
+}
+
+// HealthHandler returns an http.Handler that serves the health of
+// the named components on /healthz and /readyz, suitable for
+// liveness and readiness probes. /healthz fails if any component is
+// unhealthy, /readyz if any component is not ready. Both respond
+// with the status of each component as JSON.
+func HealthHandler(components map[string]HealthReporter) http.Handler {
+	serve := func(ok func(Health) bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			names := make([]string, 0, len(components))
+			for name := range components {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			status := http.StatusOK
+			out := make(map[string]healthJSON, len(components))
+			for _, name := range names {
+				h := components[name].Health()
+				if !ok(h) {
+					status = http.StatusServiceUnavailable
+				}
+				j := healthJSON{
+					Healthy:   h.Healthy,
+					Connected: h.Connected,
+					Queued:    h.Queued,
+				}
+				if h.LastError != nil {
+					j.LastError = h.LastError.Error()
+					j.LastErrorTime = &h.LastErrorTime
+				}
+				if h.Lag > 0 {
+					j.Lag = h.Lag.String()
+				}
+				out[name] = j
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(out)
+		}
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", serve(func(h Health) bool { return h.Healthy }))
+	mux.Handle("/readyz", serve(Health.Ready))
+	return mux
+}
@@ -0,0 +1,32 @@
+package collectd
+
+import (
+	"net"
+	"os"
+	"strings"
+)
+
+// Hostname returns the host name that collectd would use on this
+// machine if its configuration doesn't set Hostname explicitly.
+// Like collectd, it starts with the system's host name and, if
+// fqdnLookup is true (collectd's default for FQDNLookup), replaces
+// it with the canonical name the resolver returns for it. If the
+// lookup fails, the system's host name is used as is.
+func Hostname(fqdnLookup bool) (string, error) {
+	name, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	if !fqdnLookup {
+		return name, nil
+	}
+	cname, err := net.LookupCNAME(name)
+	if err != nil {
+		return name, nil
+	}
+	cname = strings.TrimSuffix(cname, ".")
+	if cname == "" {
+		return name, nil
+	}
+	return cname, nil
+}
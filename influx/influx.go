@@ -0,0 +1,168 @@
+// Package influx formats collectd values in InfluxDB's line protocol.
+package influx // import "honnef.co/go/collectd/influx"
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"honnef.co/go/collectd"
+)
+
+// Formatter formats value lists in InfluxDB's line protocol, with
+// nanosecond timestamps. The zero value maps value lists like
+// InfluxDB's collectd input does: each value becomes a line with a
+// field named "value" in the measurement plugin_dsname, tagged with
+// host, instance, type and type_instance.
+type Formatter struct {
+	// Measurement returns the measurement of the data source dsName
+	// of id. dsName is empty if MultiField is set. If Measurement is
+	// nil, DefaultMeasurement is used.
+	Measurement func(id collectd.Identifier, dsName string) string
+	// Tags returns the tags of id. Empty tag values are omitted. If
+	// Tags is nil, DefaultTags is used.
+	Tags func(id collectd.Identifier) map[string]string
+	// MultiField writes one line per value list, with a field per
+	// data source named after it, instead of one line per value.
+	MultiField bool
+	// Integers writes derives as integer fields and counters and
+	// absolutes as unsigned integer fields, which need InfluxDB 2 or
+	// later. Otherwise, all values are written as floats.
+	Integers bool
+	// TypesDB provides data source names. If it is nil, they are
+	// named as by collectd.TypesDB.DSNames.
+	TypesDB collectd.TypesDB
+}
+
+// DefaultMeasurement returns id's plugin, followed by an underscore
+// and dsName if it isn't empty.
+func DefaultMeasurement(id collectd.Identifier, dsName string) string {
+	if dsName == "" {
+		return id.Plugin
+	}
+	return id.Plugin + "_" + dsName
+}
+
+// DefaultTags returns the tags host, instance, type and
+// type_instance.
+func DefaultTags(id collectd.Identifier) map[string]string {
+	return map[string]string{
+		"host":          id.Host,
+		"instance":      id.PluginInstance,
+		"type":          id.Type,
+		"type_instance": id.TypeInstance,
+	}
+}
+
+// AppendValueList appends the lines of vl to dst. Gauges that are NaN
+// or infinite are skipped, as InfluxDB can't store them. If vl's time
+// is zero, the timestamp is omitted, letting InfluxDB use the current
+// time.
+func (f *Formatter) AppendValueList(dst []byte, vl collectd.ValueList) []byte {
+	names := f.TypesDB.DSNames(vl)
+	measurement := f.Measurement
+	if measurement == nil {
+		measurement = DefaultMeasurement
+	}
+	tags := f.Tags
+	if tags == nil {
+		tags = DefaultTags
+	}
+	tagSet := appendTags(nil, tags(vl.Identifier))
+	if f.MultiField {
+		var fields []byte
+		for i, v := range vl.Values {
+			fields = f.appendField(fields, names[i], v)
+		}
+		return appendLine(dst, measurement(vl.Identifier, ""), tagSet, fields, vl)
+	}
+	for i, v := range vl.Values {
+		fields := f.appendField(nil, "value", v)
+		dst = appendLine(dst, measurement(vl.Identifier, names[i]), tagSet, fields, vl)
+	}
+	return dst
+}
+
+// appendField appends a field to the comma-separated fields in dst.
+func (f *Formatter) appendField(dst []byte, key string, v collectd.Value) []byte {
+	if g, ok := v.(collectd.Gauge); ok && (math.IsNaN(float64(g)) || math.IsInf(float64(g), 0)) {
+		return dst
+	}
+	if len(dst) > 0 {
+		dst = append(dst, ',')
+	}
+	dst = appendEscaped(dst, key, ",= ")
+	dst = append(dst, '=')
+	switch v := v.(type) {
+	case collectd.Gauge:
+		return strconv.AppendFloat(dst, float64(v), 'g', -1, 64)
+	case collectd.Derive:
+		if f.Integers {
+			return append(strconv.AppendInt(dst, int64(v), 10), 'i')
+		}
+		return strconv.AppendFloat(dst, float64(v), 'g', -1, 64)
+	case collectd.Counter:
+		if f.Integers {
+			return append(strconv.AppendUint(dst, uint64(v), 10), 'u')
+		}
+		return strconv.AppendFloat(dst, float64(v), 'g', -1, 64)
+	case collectd.Absolute:
+		if f.Integers {
+			return append(strconv.AppendUint(dst, uint64(v), 10), 'u')
+		}
+		return strconv.AppendFloat(dst, float64(v), 'g', -1, 64)
+	default:
+		return dst
+	}
+}
+
+// appendTags appends the sorted, comma-prefixed tags to dst.
+func appendTags(dst []byte, tags map[string]string) []byte {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		dst = append(dst, ',')
+		dst = appendEscaped(dst, k, ",= ")
+		dst = append(dst, '=')
+		dst = appendEscaped(dst, tags[k], ",= ")
+	}
+	return dst
+}
+
+func appendLine(dst []byte, measurement string, tags, fields []byte, vl collectd.ValueList) []byte {
+	if len(fields) == 0 {
+		return dst
+	}
+	dst = appendEscaped(dst, measurement, ", ")
+	dst = append(dst, tags...)
+	dst = append(dst, ' ')
+	dst = append(dst, fields...)
+	if !vl.Time.IsZero() {
+		dst = append(dst, ' ')
+		dst = strconv.AppendInt(dst, vl.Time.UnixNano(), 10)
+	}
+	return append(dst, '\n')
+}
+
+// appendEscaped appends s to dst, escaping the characters in special
+// with backslashes. Newlines, which can't be escaped, are replaced
+// with spaces.
+func appendEscaped(dst []byte, s string, special string) []byte {
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch == '\n' || ch == '\r' {
+			ch = ' '
+		}
+		if strings.IndexByte(special, ch) >= 0 || ch == '\\' {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, ch)
+	}
+	return dst
+}
@@ -0,0 +1,33 @@
+// Package health provides helpers for implementing the Health methods
+// of components.
+package health // import "honnef.co/go/collectd/internal/health"
+
+import (
+	"sync"
+	"time"
+)
+
+// ErrorTracker records the most recent error of a component. The
+// zero value is ready to use.
+type ErrorTracker struct {
+	mu   sync.Mutex
+	err  error
+	when time.Time
+}
+
+// Track records err, unless it is nil.
+func (t *ErrorTracker) Track(err error) {
+	if err == nil {
+		return
+	}
+	t.mu.Lock()
+	t.err, t.when = err, time.Now()
+	t.mu.Unlock()
+}
+
+// Last returns the most recent error and when it was recorded.
+func (t *ErrorTracker) Last() (error, time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err, t.when
+}
@@ -0,0 +1,284 @@
+package collectd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// jsonValueList is a value list in the JSON format of collectd's
+// write_http plugin and others using utils_format_json.
+type jsonValueList struct {
+	Values         []any          `json:"values"`
+	DSTypes        []string       `json:"dstypes"`
+	DSNames        []string       `json:"dsnames"`
+	Time           json.Number    `json:"time"`
+	Interval       json.Number    `json:"interval"`
+	Host           string         `json:"host"`
+	Plugin         string         `json:"plugin"`
+	PluginInstance string         `json:"plugin_instance"`
+	Type           string         `json:"type"`
+	TypeInstance   string         `json:"type_instance"`
+	Meta           map[string]any `json:"meta,omitempty"`
+}
+
+// MarshalJSON encodes vls as a JSON array in the format of collectd's
+// write_http plugin with Format JSON. Data source names are taken from
+// types, which may be nil; see AppendJSON.
+func MarshalJSON(vls []ValueList, types TypesDB) ([]byte, error) {
+	b := []byte{'['}
+	for i, vl := range vls {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		var err error
+		if b, err = AppendJSON(b, vl, types); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// AppendJSON appends the JSON object that represents vl in collectd's
+// JSON format to dst. Data source names are taken from types if it
+// defines vl's type with the right number of data sources, and are
+// "value" for a single value or "value0", "value1" and so on
+// otherwise. Value lists without a time are encoded with the current
+// time, and undefined or infinite gauges as null.
+func AppendJSON(dst []byte, vl ValueList, types TypesDB) ([]byte, error) {
+	if vl.Time.IsZero() {
+		vl.Time = time.Now()
+	}
+	jvl := jsonValueList{
+		Values:         make([]any, len(vl.Values)),
+		DSTypes:        make([]string, len(vl.Values)),
+		DSNames:        types.DSNames(vl),
+		Time:           json.Number(formatTime(vl.Time, 3)),
+		Interval:       json.Number(strconv.FormatFloat(vl.Interval.Seconds(), 'f', 3, 64)),
+		Host:           vl.Host,
+		Plugin:         vl.Plugin,
+		PluginInstance: vl.PluginInstance,
+		Type:           vl.Type,
+		TypeInstance:   vl.TypeInstance,
+		Meta:           vl.Meta,
+	}
+	for i, v := range vl.Values {
+		jvl.DSTypes[i] = v.DSType().String()
+		switch v := v.(type) {
+		case Gauge:
+			if !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0) {
+				jvl.Values[i] = float64(v)
+			}
+		default:
+			jvl.Values[i] = v
+		}
+	}
+	b, err := json.Marshal(jvl)
+	if err != nil {
+		return dst, err
+	}
+	return append(dst, b...), nil
+}
+
+// UnmarshalJSON decodes a JSON array of value lists in collectd's
+// format. See JSONDecoder for how values are typed.
+func UnmarshalJSON(b []byte, types TypesDB) ([]ValueList, error) {
+	d := NewJSONDecoder(bytes.NewReader(b), types)
+	var vls []ValueList
+	for {
+		vl, err := d.Decode()
+		if err == io.EOF {
+			return vls, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		vls = append(vls, vl)
+	}
+}
+
+// JSONDecoder reads value lists in collectd's JSON format from a
+// stream. It decodes one array element at a time, so that large
+// inputs, such as the bodies of write_http requests, need not be held
+// in memory. The input may consist of several arrays.
+//
+// Values are typed according to their dstypes. If those are absent,
+// the types are looked up in the TypesDB, matching values by their
+// dsnames if present. Without a TypesDB, such values are treated as
+// gauges.
+type JSONDecoder struct {
+	dec     *json.Decoder
+	types   TypesDB
+	inArray bool
+}
+
+// NewJSONDecoder returns a decoder that reads from r, using types to
+// type values without dstypes. types may be nil.
+func NewJSONDecoder(r io.Reader, types TypesDB) *JSONDecoder {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &JSONDecoder{dec: dec, types: types}
+}
+
+// jsonInput is the decoded form of jsonValueList.
+type jsonInput struct {
+	Values         []json.RawMessage `json:"values"`
+	DSTypes        []string          `json:"dstypes"`
+	DSNames        []string          `json:"dsnames"`
+	Time           json.Number       `json:"time"`
+	Interval       json.Number       `json:"interval"`
+	Host           string            `json:"host"`
+	Plugin         string            `json:"plugin"`
+	PluginInstance string            `json:"plugin_instance"`
+	Type           string            `json:"type"`
+	TypeInstance   string            `json:"type_instance"`
+	Meta           map[string]any    `json:"meta"`
+}
+
+// Decode returns the next value list, or io.EOF at the end of the
+// input. After an error other than a syntax error, decoding can
+// continue with the next value list.
+func (d *JSONDecoder) Decode() (ValueList, error) {
+	for {
+		if !d.inArray {
+			tok, err := d.dec.Token()
+			if err != nil {
+				return ValueList{}, err
+			}
+			if tok != json.Delim('[') {
+				return ValueList{}, fmt.Errorf("expected array of value lists, got %v", tok)
+			}
+			d.inArray = true
+		}
+		if d.dec.More() {
+			break
+		}
+		// Consume the closing bracket.
+		if _, err := d.dec.Token(); err != nil {
+			return ValueList{}, err
+		}
+		d.inArray = false
+	}
+	var in jsonInput
+	if err := d.dec.Decode(&in); err != nil {
+		return ValueList{}, err
+	}
+	return in.valueList(d.types)
+}
+
+func (in *jsonInput) valueList(types TypesDB) (ValueList, error) {
+	vl := ValueList{
+		Identifier: Identifier{
+			Host:           in.Host,
+			Plugin:         in.Plugin,
+			PluginInstance: in.PluginInstance,
+			Type:           in.Type,
+			TypeInstance:   in.TypeInstance,
+		},
+		Values: make([]Value, len(in.Values)),
+	}
+	if len(in.Values) == 0 {
+		return ValueList{}, fmt.Errorf("%s: no values", vl.Identifier)
+	}
+	dsTypes, err := in.dsTypes(types)
+	if err != nil {
+		return ValueList{}, fmt.Errorf("%s: %s", vl.Identifier, err)
+	}
+	for i, raw := range in.Values {
+		s := string(raw)
+		if s == "null" {
+			s = "U"
+		}
+		if vl.Values[i], err = parseValue(s, dsTypes[i]); err != nil {
+			return ValueList{}, fmt.Errorf("%s: %s", vl.Identifier, err)
+		}
+	}
+	if in.Time != "" {
+		if vl.Time, err = parseTime(string(in.Time)); err != nil {
+			return ValueList{}, fmt.Errorf("%s: %s", vl.Identifier, err)
+		}
+	}
+	if in.Interval != "" {
+		f, err := in.Interval.Float64()
+		if err != nil || f < 0 {
+			return ValueList{}, fmt.Errorf("%s: invalid interval %q", vl.Identifier, in.Interval)
+		}
+		vl.Interval = time.Duration(f * float64(time.Second))
+	}
+	for k, v := range in.Meta {
+		if n, ok := v.(json.Number); ok {
+			in.Meta[k] = jsonMetaNumber(n)
+		}
+	}
+	vl.Meta = in.Meta
+	return vl, nil
+}
+
+// dsTypes returns the data source types of the values.
+func (in *jsonInput) dsTypes(types TypesDB) ([]DSType, error) {
+	out := make([]DSType, len(in.Values))
+	if in.DSTypes != nil {
+		if len(in.DSTypes) != len(in.Values) {
+			return nil, errors.New("number of dstypes doesn't match number of values")
+		}
+		for i, s := range in.DSTypes {
+			t, ok := parseDSType(s)
+			if !ok {
+				return nil, fmt.Errorf("invalid data source type %q", s)
+			}
+			out[i] = t
+		}
+		return out, nil
+	}
+	if types == nil {
+		for i := range out {
+			out[i] = DSTypeGauge
+		}
+		return out, nil
+	}
+	dss, ok := types[in.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", in.Type)
+	}
+	if len(dss) != len(in.Values) {
+		return nil, fmt.Errorf("type %s has %d data sources, got %d values", in.Type, len(dss), len(in.Values))
+	}
+	if in.DSNames == nil {
+		for i, ds := range dss {
+			out[i] = ds.Type
+		}
+		return out, nil
+	}
+	if len(in.DSNames) != len(in.Values) {
+		return nil, errors.New("number of dsnames doesn't match number of values")
+	}
+names:
+	for i, name := range in.DSNames {
+		for _, ds := range dss {
+			if ds.Name == name {
+				out[i] = ds.Type
+				continue names
+			}
+		}
+		return nil, fmt.Errorf("type %s has no data source %q", in.Type, name)
+	}
+	return out, nil
+}
+
+// jsonMetaNumber converts a number in meta data to the narrowest
+// type collectd supports.
+func jsonMetaNumber(n json.Number) any {
+	if i, err := strconv.ParseInt(string(n), 10, 64); err == nil {
+		return i
+	}
+	if u, err := strconv.ParseUint(string(n), 10, 64); err == nil {
+		return u
+	}
+	f, _ := n.Float64()
+	return f
+}
@@ -0,0 +1,35 @@
+package collectd
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ListEntry is an identifier known to collectd together with the
+// time of its last update.
+type ListEntry struct {
+	Identifier
+	LastUpdate time.Time
+}
+
+// ListIdentifiers is like ListValues but parses the listed names into
+// identifiers. The entries are sorted by identifier.
+func (c *Conn) ListIdentifiers() ([]ListEntry, error) {
+	vals, err := c.ListValues()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ListEntry, 0, len(vals))
+	for name, t := range vals {
+		id, err := ParseIdentifier(name)
+		if err != nil {
+			return nil, Error{Err: fmt.Errorf("could not parse identifier: %s", err)}
+		}
+		out = append(out, ListEntry{Identifier: id, LastUpdate: t})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Identifier.String() < out[j].Identifier.String()
+	})
+	return out, nil
+}
@@ -0,0 +1,64 @@
+package collectd
+
+import (
+	"context"
+	"time"
+)
+
+// MetricWriter submits values for a single plugin, filling in the
+// host, plugin and interval it was configured with, so that callers
+// only have to name the type and type instance.
+//
+//	w := &collectd.MetricWriter{Writer: conn, Host: "web1", Plugin: "myapp", Interval: 10 * time.Second}
+//	w.Gauge("queue_length", "jobs", 42)
+type MetricWriter struct {
+	Writer         Writer
+	Host           string
+	Plugin         string
+	PluginInstance string
+	Interval       time.Duration
+}
+
+// Submit submits values for the given type and type instance, using
+// the current time.
+func (w *MetricWriter) Submit(ctx context.Context, typ, instance string, values ...Value) error {
+	return w.Writer.Write(ctx, ValueList{
+		Identifier: Identifier{
+			Host:           w.Host,
+			Plugin:         w.Plugin,
+			PluginInstance: w.PluginInstance,
+			Type:           typ,
+			TypeInstance:   instance,
+		},
+		Time:     time.Now(),
+		Interval: w.Interval,
+		Values:   values,
+	})
+}
+
+// Gauge submits gauge values.
+func (w *MetricWriter) Gauge(typ, instance string, values ...float64) error {
+	vs := make([]Value, len(values))
+	for i, v := range values {
+		vs[i] = Gauge(v)
+	}
+	return w.Submit(context.Background(), typ, instance, vs...)
+}
+
+// Derive submits derive values.
+func (w *MetricWriter) Derive(typ, instance string, values ...int64) error {
+	vs := make([]Value, len(values))
+	for i, v := range values {
+		vs[i] = Derive(v)
+	}
+	return w.Submit(context.Background(), typ, instance, vs...)
+}
+
+// Counter submits counter values.
+func (w *MetricWriter) Counter(typ, instance string, values ...uint64) error {
+	vs := make([]Value, len(values))
+	for i, v := range values {
+		vs[i] = Counter(v)
+	}
+	return w.Submit(context.Background(), typ, instance, vs...)
+}
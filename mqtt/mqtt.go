@@ -0,0 +1,187 @@
+// Package mqtt exchanges value lists with collectd's mqtt plugin over
+// an MQTT broker. Value lists are published to the topic
+// prefix/host/plugin-instance/type-instance, with a payload of the
+// time and values separated by colons, as in the PUTVAL command.
+//
+// Connecting to the broker is left to the caller, who creates and
+// connects a paho client, configuring authentication, TLS and
+// reconnects as needed.
+package mqtt // import "honnef.co/go/collectd/mqtt"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// unsubscribeTimeout bounds how long Subscriber.Run waits for the
+// broker to acknowledge unsubscribing.
+const unsubscribeTimeout = 5 * time.Second
+
+// DefaultPrefix is the default topic prefix of collectd's mqtt
+// plugin.
+const DefaultPrefix = "collectd"
+
+// Topic returns the topic that collectd publishes value lists of id
+// to.
+func Topic(prefix string, id collectd.Identifier) string {
+	if prefix == "" {
+		return id.String()
+	}
+	return prefix + "/" + id.String()
+}
+
+// ParseTopic returns the identifier of a topic. Like collectd, it
+// uses the last three levels of the topic, ignoring the prefix.
+func ParseTopic(topic string) (collectd.Identifier, error) {
+	levels := strings.Split(topic, "/")
+	if len(levels) < 3 {
+		return collectd.Identifier{}, fmt.Errorf("mqtt: invalid topic %q", topic)
+	}
+	return collectd.ParseIdentifier(strings.Join(levels[len(levels)-3:], "/"))
+}
+
+// wait waits for t to complete or ctx to be canceled.
+func wait(ctx context.Context, t paho.Token) error {
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publisher publishes value lists like a Publish block of collectd's
+// mqtt plugin. Values are published as they are; collectd's
+// StoreRates option is not supported.
+type Publisher struct {
+	// Client is a connected client.
+	Client paho.Client
+	// Prefix is the topic prefix. It defaults to DefaultPrefix.
+	Prefix string
+	// QoS is the quality of service level of published messages.
+	QoS byte
+	// Retain makes the broker retain published messages.
+	Retain bool
+
+	errs health.ErrorTracker
+}
+
+var _ collectd.Writer = (*Publisher)(nil)
+
+// Write publishes vl and waits for the publication to complete, as
+// determined by QoS.
+func (p *Publisher) Write(ctx context.Context, vl collectd.ValueList) error {
+	prefix := p.Prefix
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	err := wait(ctx, p.Client.Publish(Topic(prefix, vl.Identifier), p.QoS, p.Retain, collectd.FormatValues(vl)))
+	p.errs.Track(err)
+	return err
+}
+
+// Health reports the publisher as healthy, and as connected while its
+// client is.
+func (p *Publisher) Health() collectd.Health {
+	err, when := p.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     p.Client.IsConnectionOpen(),
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+// Subscriber receives value lists like a Subscribe block of
+// collectd's mqtt plugin.
+type Subscriber struct {
+	// Client is a connected client.
+	Client paho.Client
+	// Topic is the topic filter to subscribe to. It defaults to
+	// DefaultPrefix followed by "/#".
+	Topic string
+	// QoS is the maximum quality of service level of received
+	// messages.
+	QoS byte
+	// Writer receives all value lists.
+	Writer collectd.Writer
+	// TypesDB is used to type and check values. If it is nil, all
+	// values are treated as gauges.
+	TypesDB collectd.TypesDB
+	// Logger, if not nil, receives malformed messages and errors
+	// returned by Writer.
+	Logger *slog.Logger
+
+	errs health.ErrorTracker
+}
+
+// Run subscribes to s.Topic and writes received value lists until ctx
+// is canceled. It then unsubscribes and returns ctx.Err().
+func (s *Subscriber) Run(ctx context.Context) error {
+	topic := s.Topic
+	if topic == "" {
+		topic = DefaultPrefix + "/#"
+	}
+	handler := func(_ paho.Client, msg paho.Message) {
+		vl, err := s.parse(msg)
+		if err != nil {
+			s.log(ctx, "malformed message", err, msg.Topic())
+			return
+		}
+		if err := s.Writer.Write(ctx, vl); err != nil {
+			s.log(ctx, "could not write value list", err, msg.Topic())
+		}
+	}
+	if err := wait(ctx, s.Client.Subscribe(topic, s.QoS, handler)); err != nil {
+		s.errs.Track(err)
+		return err
+	}
+	<-ctx.Done()
+	// Unsubscribing must not wait forever if the broker is gone.
+	t := s.Client.Unsubscribe(topic)
+	t.WaitTimeout(unsubscribeTimeout)
+	return ctx.Err()
+}
+
+func (s *Subscriber) parse(msg paho.Message) (collectd.ValueList, error) {
+	id, err := ParseTopic(msg.Topic())
+	if err != nil {
+		return collectd.ValueList{}, err
+	}
+	payload := strings.TrimSpace(string(msg.Payload()))
+	if payload == "" {
+		return collectd.ValueList{}, errors.New("mqtt: empty payload")
+	}
+	vl, err := collectd.ParseValues(payload, id, s.TypesDB)
+	if err != nil {
+		return collectd.ValueList{}, fmt.Errorf("mqtt: %s", err)
+	}
+	return vl, nil
+}
+
+// Health reports the subscriber as healthy, and as connected while
+// its client is.
+func (s *Subscriber) Health() collectd.Health {
+	err, when := s.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     s.Client.IsConnectionOpen(),
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (s *Subscriber) log(ctx context.Context, msg string, err error, topic string) {
+	s.errs.Track(err)
+	if s.Logger != nil {
+		s.Logger.WarnContext(ctx, msg, "error", err, "topic", topic)
+	}
+}
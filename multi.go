@@ -0,0 +1,88 @@
+package collectd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// MultiWriter is a Writer that dispatches each value list to several
+// writers concurrently, for example to a local collectd and a remote
+// one while migrating between the two.
+type MultiWriter struct {
+	writers []Writer
+
+	errs   health.ErrorTracker
+	failed atomic.Bool
+}
+
+var _ Writer = (*MultiWriter)(nil)
+
+// NewMultiWriter returns a MultiWriter that writes to ws.
+func NewMultiWriter(ws ...Writer) *MultiWriter {
+	return &MultiWriter{writers: ws}
+}
+
+// Write writes vl to all writers and waits for them to finish. If any
+// of them fail, the returned error is a *MultiError.
+func (m *MultiWriter) Write(ctx context.Context, vl ValueList) error {
+	errs := make([]error, len(m.writers))
+	var wg sync.WaitGroup
+	for i, w := range m.writers {
+		wg.Add(1)
+		go func(i int, w Writer) {
+			defer wg.Done()
+			errs[i] = w.Write(ctx, vl)
+		}(i, w)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			err := &MultiError{Errors: errs}
+			m.errs.Track(err)
+			m.failed.Store(true)
+			return err
+		}
+	}
+	m.failed.Store(false)
+	return nil
+}
+
+// Health reports the MultiWriter as connected if the most recent
+// write succeeded on all writers.
+func (m *MultiWriter) Health() Health {
+	err, when := m.errs.Last()
+	return Health{Healthy: true, Connected: !m.failed.Load(), LastError: err, LastErrorTime: when}
+}
+
+// MultiError reports the errors of individual writers of a
+// MultiWriter. Errors is indexed like the writers passed to
+// NewMultiWriter; writers that succeeded have a nil error.
+type MultiError struct {
+	Errors []error
+}
+
+func (e *MultiError) Error() string {
+	var parts []string
+	for i, err := range e.Errors {
+		if err != nil {
+			parts = append(parts, fmt.Sprintf("writer %d: %s", i, err))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Unwrap returns the non-nil errors.
+func (e *MultiError) Unwrap() []error {
+	var out []error
+	for _, err := range e.Errors {
+		if err != nil {
+			out = append(out, err)
+		}
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A PasswordLookup returns the password of a user.
+type PasswordLookup interface {
+	Password(username string) (string, error)
+}
+
+// Passwords is a PasswordLookup that maps user names to passwords.
+type Passwords map[string]string
+
+// Password implements PasswordLookup.
+func (p Passwords) Password(username string) (string, error) {
+	password, ok := p[username]
+	if !ok {
+		return "", fmt.Errorf("unknown user %q", username)
+	}
+	return password, nil
+}
+
+// ParseAuthFile parses collectd's auth file format, which consists of
+// lines of the form "user: password". Empty lines and lines starting
+// with # are ignored.
+func ParseAuthFile(r io.Reader) (Passwords, error) {
+	p := Passwords{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		user, password, ok := strings.Cut(line, ":")
+		user, password = strings.TrimSpace(user), strings.TrimSpace(password)
+		if !ok || user == "" || password == "" {
+			return nil, fmt.Errorf("line %d: expected \"user: password\"", n)
+		}
+		p[user] = password
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AuthFile is a PasswordLookup backed by an auth file. Like collectd,
+// it reads the file again whenever it has been modified.
+type AuthFile struct {
+	path string
+
+	mu        sync.Mutex
+	modTime   time.Time
+	passwords Passwords
+}
+
+var _ PasswordLookup = (*AuthFile)(nil)
+
+// NewAuthFile reads the auth file at path.
+func NewAuthFile(path string) (*AuthFile, error) {
+	a := &AuthFile{path: path}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuthFile) reload() error {
+	fi, err := os.Stat(a.path)
+	if err != nil {
+		return err
+	}
+	if a.passwords != nil && fi.ModTime().Equal(a.modTime) {
+		return nil
+	}
+	f, err := os.Open(a.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	p, err := ParseAuthFile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %s", a.path, err)
+	}
+	a.passwords, a.modTime = p, fi.ModTime()
+	return nil
+}
+
+// Password implements PasswordLookup. If the file has been modified
+// but can't be read, the previously read passwords are used.
+func (a *AuthFile) Password(username string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reload()
+	return a.passwords.Password(username)
+}
@@ -0,0 +1,299 @@
+package network
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/cdtime"
+)
+
+// ErrNotEnoughSpace is returned when a value list doesn't fit into the
+// remaining space of a Buffer.
+var ErrNotEnoughSpace = errors.New("network: not enough space")
+
+var (
+	errNoValues        = errors.New("network: value list has no values")
+	errTooManyValues   = errors.New("network: too many values")
+	errStringTooLong   = errors.New("network: string too long")
+	errUnsupportedType = errors.New("network: unsupported value type")
+)
+
+// Buffer encodes value lists and notifications into a single packet
+// of the binary protocol. Parts that are the same as for the previous
+// item, such as the host, are only encoded once, so that many value
+// lists fit into one packet.
+type Buffer struct {
+	// Legacy makes the buffer encode times and intervals with
+	// second resolution, for receivers older than collectd 5. By
+	// default, the high resolution parts are used, which collectd 4
+	// ignores.
+	Legacy bool
+
+	buf      []byte
+	size     int
+	state    collectd.ValueList
+	severity collectd.Severity
+	// valid reports whether state holds the parts of a previous
+	// value list or notification.
+	valid bool
+	err   error
+}
+
+var (
+	_ collectd.Writer             = (*Buffer)(nil)
+	_ collectd.NotificationWriter = (*Buffer)(nil)
+)
+
+// NewBuffer returns a Buffer for packets of at most size bytes.
+func NewBuffer(size int) *Buffer {
+	return &Buffer{buf: make([]byte, 0, size), size: size}
+}
+
+// Write encodes vl into the buffer. If it doesn't fit, the buffer is
+// left unchanged and ErrNotEnoughSpace is returned. Value lists
+// without a time are encoded with the current time.
+func (b *Buffer) Write(_ context.Context, vl collectd.ValueList) error {
+	if vl.Time.IsZero() {
+		vl.Time = time.Now()
+	}
+	if err := checkValues(vl.Values); err != nil {
+		return err
+	}
+	return b.encode(func() error {
+		b.appendIdentifier(vl.Identifier, vl.Time, vl.Interval)
+		var err error
+		b.buf, err = appendValues(b.buf, vl.Values)
+		return err
+	}, func() {
+		b.state = vl
+	})
+}
+
+// WriteNotification encodes n into the buffer. Like Write, it returns
+// ErrNotEnoughSpace if n doesn't fit.
+func (b *Buffer) WriteNotification(_ context.Context, n collectd.Notification) error {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	switch n.Severity {
+	case collectd.SeverityFailure, collectd.SeverityWarning, collectd.SeverityOkay:
+	default:
+		return fmt.Errorf("network: invalid severity %d", n.Severity)
+	}
+	return b.encode(func() error {
+		b.appendIdentifier(n.Identifier, n.Time, 0)
+		if n.Severity != b.severity {
+			b.buf = appendNumber(b.buf, TypeSeverity, uint64(n.Severity))
+		}
+		var err error
+		b.buf, err = appendString(b.buf, TypeMessage, n.Message)
+		return err
+	}, func() {
+		b.state.Identifier, b.state.Time = n.Identifier, n.Time
+		b.severity = n.Severity
+	})
+}
+
+// encode calls fn to append parts to the buffer. If that fails or
+// the parts don't fit, it restores the buffer. Otherwise it calls
+// update to record the new state.
+func (b *Buffer) encode(fn func() error, update func()) error {
+	n := len(b.buf)
+	b.err = nil
+	err := fn()
+	if err == nil {
+		err = b.err
+	}
+	if err == nil && len(b.buf) > b.size {
+		err = ErrNotEnoughSpace
+	}
+	if err != nil {
+		b.buf = b.buf[:n]
+		return err
+	}
+	update()
+	b.valid = true
+	return nil
+}
+
+// appendIdentifier appends the parts that differ from the previous
+// value list or notification. Errors are recorded in b.err.
+func (b *Buffer) appendIdentifier(id collectd.Identifier, t time.Time, interval time.Duration) {
+	first := !b.valid
+	str := func(typ PartType, s, old string) {
+		if b.err == nil && (first || s != old) {
+			b.buf, b.err = appendString(b.buf, typ, s)
+		}
+	}
+	str(TypeHost, id.Host, b.state.Host)
+	if first || !t.Equal(b.state.Time) {
+		b.buf = appendTime(b.buf, t, b.Legacy)
+	}
+	if interval > 0 && (first || interval != b.state.Interval) {
+		b.buf = appendInterval(b.buf, interval, b.Legacy)
+	}
+	str(TypePlugin, id.Plugin, b.state.Plugin)
+	str(TypePluginInstance, id.PluginInstance, b.state.PluginInstance)
+	str(TypeType, id.Type, b.state.Type)
+	str(TypeTypeInstance, id.TypeInstance, b.state.TypeInstance)
+}
+
+// Bytes returns the encoded packet. The slice is only valid until the
+// next modification of the buffer.
+func (b *Buffer) Bytes() []byte {
+	return b.buf
+}
+
+// Len returns the size of the encoded packet.
+func (b *Buffer) Len() int {
+	return len(b.buf)
+}
+
+// Reset empties the buffer so that it can be used for a new packet.
+func (b *Buffer) Reset() {
+	b.buf = b.buf[:0]
+	b.state, b.severity, b.valid = collectd.ValueList{}, 0, false
+}
+
+// EncodePackets encodes vls into as few packets of at most size bytes
+// as possible. Each packet repeats the parts it needs, so that it can
+// be decoded on its own. It returns ErrNotEnoughSpace if a single
+// value list doesn't fit into a packet.
+func EncodePackets(size int, vls []collectd.ValueList) ([][]byte, error) {
+	var packets [][]byte
+	b := NewBuffer(size)
+	for _, vl := range vls {
+		err := b.Write(context.Background(), vl)
+		if err == ErrNotEnoughSpace && b.Len() > 0 {
+			packets = append(packets, append([]byte(nil), b.Bytes()...))
+			b.Reset()
+			err = b.Write(context.Background(), vl)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if b.Len() > 0 {
+		packets = append(packets, append([]byte(nil), b.Bytes()...))
+	}
+	return packets, nil
+}
+
+// AppendValueList appends the parts encoding vl to dst and returns
+// the extended slice. Unlike Buffer, it always encodes all parts, so
+// the results of several calls can be concatenated to form a packet.
+// It doesn't allocate, unless dst has to grow.
+func AppendValueList(dst []byte, vl collectd.ValueList) ([]byte, error) {
+	if vl.Time.IsZero() {
+		vl.Time = time.Now()
+	}
+	if err := checkValues(vl.Values); err != nil {
+		return dst, err
+	}
+	n := len(dst)
+	dst, err := appendString(dst, TypeHost, vl.Host)
+	if err != nil {
+		return dst[:n], err
+	}
+	dst = appendTime(dst, vl.Time, false)
+	if vl.Interval > 0 {
+		dst = appendInterval(dst, vl.Interval, false)
+	}
+	for _, p := range [...]struct {
+		typ PartType
+		s   string
+	}{
+		{TypePlugin, vl.Plugin},
+		{TypePluginInstance, vl.PluginInstance},
+		{TypeType, vl.Type},
+		{TypeTypeInstance, vl.TypeInstance},
+	} {
+		if dst, err = appendString(dst, p.typ, p.s); err != nil {
+			return dst[:n], err
+		}
+	}
+	if dst, err = appendValues(dst, vl.Values); err != nil {
+		return dst[:n], err
+	}
+	return dst, nil
+}
+
+// maxValues is the number of values that fit into a values part,
+// whose length, including a 4 byte header, the 2 byte number of
+// values and 9 bytes per value, is a uint16.
+const maxValues = (math.MaxUint16 - 6) / 9
+
+func checkValues(values []collectd.Value) error {
+	if len(values) == 0 {
+		return errNoValues
+	}
+	if len(values) > maxValues {
+		return errTooManyValues
+	}
+	return nil
+}
+
+func appendTime(dst []byte, t time.Time, legacy bool) []byte {
+	if legacy {
+		return appendNumber(dst, TypeTime, uint64(t.Unix()))
+	}
+	return appendNumber(dst, TypeTimeHR, uint64(cdtime.New(t)))
+}
+
+func appendInterval(dst []byte, d time.Duration, legacy bool) []byte {
+	if legacy {
+		// collectd 4 can't represent intervals below one second.
+		secs := max(d.Round(time.Second), time.Second) / time.Second
+		return appendNumber(dst, TypeInterval, uint64(secs))
+	}
+	return appendNumber(dst, TypeIntervalHR, uint64(cdtime.NewDuration(d)))
+}
+
+func appendHeader(dst []byte, typ PartType, length int) []byte {
+	dst = binary.BigEndian.AppendUint16(dst, uint16(typ))
+	return binary.BigEndian.AppendUint16(dst, uint16(length))
+}
+
+func appendString(dst []byte, typ PartType, s string) ([]byte, error) {
+	length := 4 + len(s) + 1
+	if length > math.MaxUint16 {
+		return dst, errStringTooLong
+	}
+	dst = appendHeader(dst, typ, length)
+	dst = append(dst, s...)
+	return append(dst, 0), nil
+}
+
+func appendNumber(dst []byte, typ PartType, n uint64) []byte {
+	dst = appendHeader(dst, typ, 12)
+	return binary.BigEndian.AppendUint64(dst, n)
+}
+
+func appendValues(dst []byte, values []collectd.Value) ([]byte, error) {
+	dst = appendHeader(dst, TypeValues, 6+9*len(values))
+	dst = binary.BigEndian.AppendUint16(dst, uint16(len(values)))
+	for _, v := range values {
+		dst = append(dst, byte(v.DSType()))
+	}
+	for _, v := range values {
+		switch v := v.(type) {
+		case collectd.Gauge:
+			// Gauges are the only little endian values.
+			dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(float64(v)))
+		case collectd.Derive:
+			dst = binary.BigEndian.AppendUint64(dst, uint64(v))
+		case collectd.Counter:
+			dst = binary.BigEndian.AppendUint64(dst, uint64(v))
+		case collectd.Absolute:
+			dst = binary.BigEndian.AppendUint64(dst, uint64(v))
+		default:
+			return dst, errUnsupportedType
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,62 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// Cache remembers the time of the most recent value list of each
+// identifier, like collectd's value cache, so that a Server can drop
+// value lists that are retransmitted or arrive out of order. The zero
+// value is ready to use.
+type Cache struct {
+	mu        sync.Mutex
+	entries   map[collectd.Identifier]cacheEntry
+	lastSweep time.Time
+}
+
+type cacheEntry struct {
+	time    time.Time
+	expires time.Time
+}
+
+// Like collectd, forget identifiers that haven't been updated for two
+// intervals.
+const cacheTimeout = 2
+
+// Update records vl and reports whether it is newer than the previous
+// value list with the same identifier.
+func (c *Cache) Update(vl collectd.ValueList) bool {
+	now := time.Now()
+	interval := vl.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[collectd.Identifier]cacheEntry{}
+	}
+	if now.Sub(c.lastSweep) > time.Minute {
+		for id, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, id)
+			}
+		}
+		c.lastSweep = now
+	}
+	if e, ok := c.entries[vl.Identifier]; ok && now.Before(e.expires) && !vl.Time.After(e.time) {
+		return false
+	}
+	c.entries[vl.Identifier] = cacheEntry{time: vl.Time, expires: now.Add(cacheTimeout * interval)}
+	return true
+}
+
+// Len returns the number of identifiers in the cache.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
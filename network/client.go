@@ -0,0 +1,378 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// A ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithFlushInterval sets the maximum time a value list is buffered
+// before it is sent. The default is ten seconds.
+func WithFlushInterval(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.flushInterval = d
+	}
+}
+
+// WithSecurity signs or encrypts all packets, using the credentials
+// of the user username.
+func WithSecurity(level SecurityLevel, username, password string) ClientOption {
+	return WithPasswordLookup(level, username, Passwords{username: password})
+}
+
+// WithPasswordLookup is like WithSecurity, but looks up the user's
+// password in passwords whenever a packet is sent. This allows
+// sharing an AuthFile with a Server.
+func WithPasswordLookup(level SecurityLevel, username string, passwords PasswordLookup) ClientOption {
+	return func(c *Client) {
+		c.level, c.username, c.passwords = level, username, passwords
+	}
+}
+
+// WithTTL sets the time to live, or hop limit, of sent packets. When
+// sending to a multicast group, it sets the multicast TTL instead.
+// The default is the operating system's default.
+func WithTTL(ttl int) ClientOption {
+	return func(c *Client) {
+		c.ttl = ttl
+	}
+}
+
+// WithPacketSize sets the maximum size of sent packets, which must be
+// between MinPacketSize and MaxPacketSize. It must not exceed the
+// receiver's MaxPacketSize. The default is DefaultBufferSize.
+func WithPacketSize(n int) ClientOption {
+	return func(c *Client) {
+		c.packetSize = n
+	}
+}
+
+// WithLegacyParts makes the client encode times and intervals with
+// second resolution, for receivers older than collectd 5.
+func WithLegacyParts() ClientOption {
+	return func(c *Client) {
+		c.legacy = true
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that
+// occur when the client sends a packet in the background, which would
+// otherwise only be reported by Health.
+func WithErrorHandler(fn func(c *Client, err error)) ClientOption {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
+
+// WithResolveInterval sets how often the client resolves a host name
+// again, switching to the new address if it changed. The default is
+// five minutes; zero disables resolving again. It has no effect if
+// the client was given an IP address.
+func WithResolveInterval(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.resolveInterval = d
+	}
+}
+
+// Client sends value lists and notifications to a collectd network
+// plugin over UDP. They are buffered and sent when a packet is full
+// or when the flush interval has passed, whichever happens first.
+type Client struct {
+	flushInterval   time.Duration
+	resolveInterval time.Duration
+	ttl             int
+	packetSize      int
+	legacy          bool
+	onError         func(*Client, error)
+	level           SecurityLevel
+	username        string
+	passwords       PasswordLookup
+
+	address string
+	done    chan struct{}
+	wg      sync.WaitGroup
+
+	errs health.ErrorTracker
+
+	mu      sync.Mutex
+	conn    net.Conn
+	buf     *Buffer
+	closed  bool
+	failing bool
+}
+
+var (
+	_ collectd.Writer             = (*Client)(nil)
+	_ collectd.NotificationWriter = (*Client)(nil)
+	_ collectd.BatchWriter        = (*Client)(nil)
+)
+
+// Dial returns a Client that sends to address, which may be a
+// multicast group. If address has no port, collectd's default port is
+// used. If address is empty, the client sends to collectd's default
+// IPv4 multicast group.
+func Dial(address string, opts ...ClientOption) (*Client, error) {
+	if address == "" {
+		address = DefaultIPv4Address
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, collectd.DefaultNetworkPort)
+	}
+	c := &Client{
+		flushInterval:   10 * time.Second,
+		resolveInterval: 5 * time.Minute,
+		packetSize:      DefaultBufferSize,
+		address:         address,
+		done:            make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if err := checkPacketSize(c.packetSize); err != nil {
+		return nil, err
+	}
+	if c.flushInterval <= 0 {
+		return nil, errors.New("network: flush interval must be positive")
+	}
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.buf = NewBuffer(c.packetSize - securityOverhead(c.level, c.username))
+	c.buf.Legacy = c.legacy
+	c.wg.Add(1)
+	go c.flusher()
+	return c, nil
+}
+
+func (c *Client) dial() (net.Conn, error) {
+	conn, err := net.Dial("udp", c.address)
+	if err != nil {
+		return nil, err
+	}
+	if c.ttl > 0 {
+		if err := setTTL(conn.(*net.UDPConn), c.ttl); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// isHostname reports whether address refers to a host by name.
+func isHostname(address string) bool {
+	host, _, _ := net.SplitHostPort(address)
+	host, _, _ = strings.Cut(host, "%")
+	return net.ParseIP(host) == nil
+}
+
+// reresolve dials the client's address again and switches to the new
+// connection if the address resolves differently.
+func (c *Client) reresolve() {
+	conn, err := c.dial()
+	if err != nil {
+		c.errs.Track(err)
+		if c.onError != nil {
+			c.onError(c, err)
+		}
+		return
+	}
+	c.mu.Lock()
+	if c.closed || conn.RemoteAddr().String() == c.conn.RemoteAddr().String() {
+		c.mu.Unlock()
+		conn.Close()
+		return
+	}
+	old := c.conn
+	c.conn = conn
+	c.mu.Unlock()
+	old.Close()
+}
+
+func setTTL(conn *net.UDPConn, ttl int) error {
+	ip := conn.RemoteAddr().(*net.UDPAddr).IP
+	switch {
+	case ip.To4() != nil && ip.IsMulticast():
+		return ipv4.NewPacketConn(conn).SetMulticastTTL(ttl)
+	case ip.To4() != nil:
+		return ipv4.NewConn(conn).SetTTL(ttl)
+	case ip.IsMulticast():
+		return ipv6.NewPacketConn(conn).SetMulticastHopLimit(ttl)
+	default:
+		return ipv6.NewConn(conn).SetHopLimit(ttl)
+	}
+}
+
+func (c *Client) flusher() {
+	defer c.wg.Done()
+	t := time.NewTicker(c.flushInterval)
+	defer t.Stop()
+	var resolve <-chan time.Time
+	if c.resolveInterval > 0 && isHostname(c.address) {
+		rt := time.NewTicker(c.resolveInterval)
+		defer rt.Stop()
+		resolve = rt.C
+	}
+	for {
+		select {
+		case <-resolve:
+			c.reresolve()
+		case <-t.C:
+			if err := c.Flush(context.Background()); err != nil && c.onError != nil {
+				c.onError(c, err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Write adds vl to the current packet. If the packet is full, it is
+// sent first.
+func (c *Client) Write(ctx context.Context, vl collectd.ValueList) error {
+	return c.write(func() error { return c.buf.Write(ctx, vl) })
+}
+
+// WriteNotification adds n to the current packet. If the packet is
+// full, it is sent first.
+func (c *Client) WriteNotification(ctx context.Context, n collectd.Notification) error {
+	return c.write(func() error { return c.buf.WriteNotification(ctx, n) })
+}
+
+// WriteBatch adds vls to the current packet, sending packets as they
+// fill up. Parts such as the host are repeated at the start of each
+// packet, so every packet can be decoded on its own. If any of the
+// value lists fail, the returned error is a *collectd.BatchError.
+func (c *Client) WriteBatch(ctx context.Context, vls []collectd.ValueList) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return collectd.ErrClosed
+	}
+	var errs []error
+	for i, vl := range vls {
+		if err := c.add(func() error { return c.buf.Write(ctx, vl) }); err != nil {
+			if errs == nil {
+				errs = make([]error, len(vls))
+			}
+			errs[i] = err
+		}
+	}
+	if errs != nil {
+		return &collectd.BatchError{Errors: errs}
+	}
+	return nil
+}
+
+func (c *Client) write(fn func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return collectd.ErrClosed
+	}
+	return c.add(fn)
+}
+
+// add calls fn to encode an item, sending the current packet first
+// if the item doesn't fit. Items that don't even fit into an empty
+// packet fail with ErrNotEnoughSpace.
+func (c *Client) add(fn func() error) error {
+	err := fn()
+	if err != ErrNotEnoughSpace || c.buf.Len() == 0 {
+		return err
+	}
+	if err := c.flush(); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// Flush sends the current packet, if it isn't empty.
+func (c *Client) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.flush()
+}
+
+func (c *Client) flush() error {
+	if c.buf.Len() == 0 {
+		return nil
+	}
+	b, err := c.secure(c.buf.Bytes())
+	if err == nil {
+		_, err = c.conn.Write(b)
+	}
+	c.buf.Reset()
+	c.failing = err != nil
+	c.errs.Track(err)
+	return err
+}
+
+func (c *Client) secure(b []byte) ([]byte, error) {
+	if c.level == None {
+		return b, nil
+	}
+	password, err := lookup(c.passwords, c.username)
+	if err != nil {
+		return nil, fmt.Errorf("network: %s", err)
+	}
+	if c.level == Sign {
+		return sign(b, c.username, password), nil
+	}
+	return encrypt(b, c.username, password)
+}
+
+// RemoteAddr returns the address the client currently sends to.
+func (c *Client) RemoteAddr() net.Addr {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.RemoteAddr()
+}
+
+// Health reports the client as healthy until it is closed. UDP is
+// connectionless, so the client counts as connected unless its last
+// send failed.
+func (c *Client) Health() collectd.Health {
+	c.mu.Lock()
+	closed, failing := c.closed, c.failing
+	c.mu.Unlock()
+	err, when := c.errs.Last()
+	return collectd.Health{
+		Healthy:       !closed,
+		Connected:     !closed && !failing,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+// Close sends the current packet and closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return collectd.ErrClosed
+	}
+	c.closed = true
+	err := c.flush()
+	c.mu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+	if cerr := c.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package network
+
+import (
+	"context"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// Forwarder forwards value lists and notifications to collectd's
+// unixsock plugin. Value lists are submitted in batches, and the
+// connection is reestablished after errors. Used as the Writer of a
+// Server, it lets a collectd without the network plugin receive
+// network packets.
+type Forwarder struct {
+	redial *collectd.Redialer
+	batch  *collectd.Batcher
+}
+
+var (
+	_ collectd.Writer             = (*Forwarder)(nil)
+	_ collectd.NotificationWriter = (*Forwarder)(nil)
+)
+
+// NewForwarder returns a Forwarder that connects to collectd by
+// calling dial, e.g. a function calling collectd.DialUnix. Value lists
+// are submitted in batches of up to batchSize, and at least every
+// interval. Errors of batches are reported by calling onError, which
+// may be nil.
+func NewForwarder(dial func() (*collectd.Conn, error), batchSize int, interval time.Duration, onError func([]collectd.ValueList, error)) *Forwarder {
+	r := &collectd.Redialer{Dial: dial}
+	return &Forwarder{
+		redial: r,
+		batch:  collectd.NewBatcher(r, batchSize, interval, onError),
+	}
+}
+
+// Write adds vl to the current batch.
+func (f *Forwarder) Write(ctx context.Context, vl collectd.ValueList) error {
+	return f.batch.Write(ctx, vl)
+}
+
+// WriteNotification submits the current batch, then n.
+func (f *Forwarder) WriteNotification(ctx context.Context, n collectd.Notification) error {
+	// Keep notifications in order with the value lists that preceded
+	// them.
+	f.batch.Flush(ctx)
+	return f.redial.WriteNotification(ctx, n)
+}
+
+// Health reports the health of the connection to collectd, together
+// with the number of value lists in the current batch.
+func (f *Forwarder) Health() collectd.Health {
+	return f.batch.Health()
+}
+
+// Close submits the current batch and closes the connection.
+func (f *Forwarder) Close() error {
+	err := f.batch.Close()
+	if cerr := f.redial.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+// Package network implements collectd's binary network protocol, as
+// spoken by collectd's network plugin.
+package network // import "honnef.co/go/collectd/network"
+
+import "fmt"
+
+// DefaultBufferSize is the default maximum size of a packet. It
+// matches collectd's default and fits an Ethernet frame after IPv6
+// and UDP headers.
+const DefaultBufferSize = 1452
+
+// The smallest and largest packet sizes collectd supports.
+const (
+	MinPacketSize = 1024
+	MaxPacketSize = 65535
+)
+
+func checkPacketSize(n int) error {
+	if n < MinPacketSize || n > MaxPacketSize {
+		return fmt.Errorf("network: packet size %d out of range [%d, %d]", n, MinPacketSize, MaxPacketSize)
+	}
+	return nil
+}
+
+// Default multicast groups of collectd's network plugin.
+const (
+	DefaultIPv4Address = "239.192.74.66"
+	DefaultIPv6Address = "ff18::efc0:4a42"
+)
+
+// A PartType identifies the kind of a part of a packet.
+type PartType uint16
+
+// Part types of the binary protocol, named like in collectd.
+const (
+	TypeHost           PartType = 0x0000
+	TypeTime           PartType = 0x0001
+	TypePlugin         PartType = 0x0002
+	TypePluginInstance PartType = 0x0003
+	TypeType           PartType = 0x0004
+	TypeTypeInstance   PartType = 0x0005
+	TypeValues         PartType = 0x0006
+	TypeInterval       PartType = 0x0007
+	TypeTimeHR         PartType = 0x0008
+	TypeIntervalHR     PartType = 0x0009
+	TypeMessage        PartType = 0x0100
+	TypeSeverity       PartType = 0x0101
+	TypeSignSHA256     PartType = 0x0200
+	TypeEncrAES256     PartType = 0x0210
+)
@@ -0,0 +1,200 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/cdtime"
+)
+
+// Parse decodes a packet into the value lists and notifications it
+// contains. Unknown parts are skipped, as are signatures, which Parse
+// cannot verify; use PartIterator to access all parts. If the packet
+// is malformed, Parse returns the items decoded before the error
+// along with the error.
+//
+// Parse is safe to use on untrusted input; its allocations are
+// bounded by the size of b.
+func Parse(b []byte) ([]collectd.ValueList, []collectd.Notification, error) {
+	var p parser
+	err := p.parse(b, None)
+	return p.vls, p.ns, err
+}
+
+// SecurityError is returned for packets whose signature is invalid,
+// that can't be decrypted, or that don't meet the required security
+// level.
+type SecurityError struct {
+	Err error
+}
+
+func (e *SecurityError) Error() string { return "network: " + e.Err.Error() }
+
+// Unwrap returns e.Err.
+func (e *SecurityError) Unwrap() error { return e.Err }
+
+// parser decodes packets, enforcing a security level.
+type parser struct {
+	level     SecurityLevel
+	passwords PasswordLookup
+	// unknown, if not nil, is called for parts of unknown types.
+	unknown func(Part)
+
+	vls []collectd.ValueList
+	ns  []collectd.Notification
+}
+
+// parse decodes b, which is secured by at least the level secured.
+func (p *parser) parse(b []byte, secured SecurityLevel) error {
+	var (
+		state collectd.ValueList
+		sev   collectd.Severity
+	)
+	it := PartIterator{b: b}
+	for it.Next() {
+		typ, payload := it.part.Type, it.part.Payload
+
+		if (typ == TypeSignSHA256 || typ == TypeEncrAES256) && secured != None {
+			// collectd never nests these, and allowing it would let
+			// hostile packets make us recurse deeply.
+			return fmt.Errorf("network: nested %s part", typ)
+		}
+		switch typ {
+		case TypeSignSHA256:
+			if p.level == None && p.passwords == nil {
+				// Like collectd, accept signed packets that we
+				// can't verify.
+				continue
+			}
+			if err := verify(payload, it.b, p.passwords); err != nil {
+				return &SecurityError{err}
+			}
+			// The signature covers the rest of the packet.
+			return p.parse(it.b, Sign)
+		case TypeEncrAES256:
+			plain, err := decrypt(payload, p.passwords)
+			if err != nil {
+				return &SecurityError{err}
+			}
+			if err := p.parse(plain, Encrypt); err != nil {
+				return err
+			}
+			continue
+		}
+		if secured < p.level {
+			return &SecurityError{fmt.Errorf("packet does not meet security level %s", p.level)}
+		}
+
+		var err error
+		switch typ {
+		case TypeHost:
+			state.Host, err = parseString(payload)
+		case TypePlugin:
+			state.Plugin, err = parseString(payload)
+		case TypePluginInstance:
+			state.PluginInstance, err = parseString(payload)
+		case TypeType:
+			state.Type, err = parseString(payload)
+		case TypeTypeInstance:
+			state.TypeInstance, err = parseString(payload)
+		case TypeTime, TypeTimeHR, TypeInterval, TypeIntervalHR, TypeSeverity:
+			var n uint64
+			n, err = parseNumber(payload)
+			switch typ {
+			case TypeTime:
+				state.Time = time.Unix(int64(n), 0)
+			case TypeTimeHR:
+				state.Time = cdtime.Time(n).Time()
+			case TypeInterval:
+				state.Interval = time.Duration(n) * time.Second
+			case TypeIntervalHR:
+				state.Interval = cdtime.Time(n).Duration()
+			case TypeSeverity:
+				sev = collectd.Severity(n)
+			}
+		case TypeValues:
+			var values []collectd.Value
+			values, err = parseValues(payload)
+			if err == nil {
+				vl := state
+				vl.Values = values
+				p.vls = append(p.vls, vl)
+			}
+		case TypeMessage:
+			var msg string
+			msg, err = parseString(payload)
+			switch sev {
+			case collectd.SeverityFailure, collectd.SeverityWarning, collectd.SeverityOkay:
+			default:
+				// Like collectd, ignore notifications without a
+				// valid severity.
+				continue
+			}
+			if err == nil {
+				// Like collectd, dispatch a notification for every
+				// message, using the most recent severity.
+				p.ns = append(p.ns, collectd.Notification{
+					Identifier: state.Identifier,
+					Severity:   sev,
+					Time:       state.Time,
+					Message:    msg,
+				})
+			}
+		default:
+			if p.unknown != nil {
+				p.unknown(it.part)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("network: %s part: %s", typ, err)
+		}
+	}
+	return it.Err()
+}
+
+func parseString(b []byte) (string, error) {
+	if len(b) == 0 || b[len(b)-1] != 0 {
+		return "", errors.New("string is not null-terminated")
+	}
+	return string(b[:len(b)-1]), nil
+}
+
+func parseNumber(b []byte) (uint64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("invalid number length %d", len(b))
+	}
+	return binary.BigEndian.Uint64(b), nil
+}
+
+func parseValues(b []byte) ([]collectd.Value, error) {
+	if len(b) < 2 {
+		return nil, errors.New("missing number of values")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if n == 0 || len(b) != 9*n {
+		return nil, fmt.Errorf("invalid length for %d values", n)
+	}
+	types, data := b[:n], b[n:]
+	values := make([]collectd.Value, n)
+	for i, t := range types {
+		raw := data[8*i : 8*i+8]
+		switch collectd.DSType(t) {
+		case collectd.DSTypeGauge:
+			values[i] = collectd.Gauge(math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+		case collectd.DSTypeDerive:
+			values[i] = collectd.Derive(binary.BigEndian.Uint64(raw))
+		case collectd.DSTypeCounter:
+			values[i] = collectd.Counter(binary.BigEndian.Uint64(raw))
+		case collectd.DSTypeAbsolute:
+			values[i] = collectd.Absolute(binary.BigEndian.Uint64(raw))
+		default:
+			return nil, fmt.Errorf("invalid data source type %d", t)
+		}
+	}
+	return values, nil
+}
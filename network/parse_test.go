@@ -0,0 +1,85 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+func FuzzParse(f *testing.F) {
+	vl := collectd.ValueList{
+		Identifier: collectd.Identifier{Host: "example.com", Plugin: "cpu", PluginInstance: "0", Type: "cpu", TypeInstance: "idle"},
+		Time:       time.Unix(1700000000, 0),
+		Interval:   10 * time.Second,
+		Values:     []collectd.Value{collectd.Derive(42)},
+	}
+	plain, _ := AppendValueList(nil, vl)
+	signed := sign(plain, "user", "secret")
+	encrypted, _ := encrypt(plain, "user", "secret")
+	b := NewBuffer(DefaultBufferSize)
+	b.Legacy = true
+	b.Write(context.Background(), vl)
+	b.WriteNotification(context.Background(), collectd.Notification{Identifier: vl.Identifier, Severity: collectd.SeverityWarning, Message: "hot"})
+	for _, seed := range [][]byte{plain, signed, encrypted, b.Bytes(), {0, 6, 0, 4}, {0, 0, 0xff, 0xff}} {
+		f.Add(seed)
+	}
+
+	passwords := Passwords{"user": "secret"}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		Parse(b)
+		for _, level := range []SecurityLevel{None, Sign, Encrypt} {
+			p := parser{level: level, passwords: passwords}
+			p.parse(b, None)
+		}
+	})
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add("example.com", "cpu", "0", "cpu", "idle", int64(1700000000), int64(10e9), 1.5, int64(-3), uint64(7))
+	f.Fuzz(func(t *testing.T, host, plugin, pinst, typ, tinst string, sec, interval int64, g float64, d int64, c uint64) {
+		if sec <= 0 || sec >= 1<<33 || interval < 0 {
+			t.Skip()
+		}
+		vl := collectd.ValueList{
+			Identifier: collectd.Identifier{Host: host, Plugin: plugin, PluginInstance: pinst, Type: typ, TypeInstance: tinst},
+			Time:       time.Unix(sec, 0),
+			Interval:   time.Duration(interval),
+			Values:     []collectd.Value{collectd.Gauge(g), collectd.Derive(d), collectd.Counter(c), collectd.Absolute(c)},
+		}
+		b, err := AppendValueList(nil, vl)
+		if err != nil {
+			return
+		}
+		vls, _, err := Parse(b)
+		if err != nil {
+			t.Fatalf("could not parse encoded value list: %s", err)
+		}
+		if len(vls) != 1 {
+			t.Fatalf("got %d value lists, want 1", len(vls))
+		}
+		got := vls[0]
+		if got.Identifier != vl.Identifier || !got.Time.Equal(vl.Time) {
+			t.Errorf("got %v at %v, want %v at %v", got.Identifier, got.Time, vl.Identifier, vl.Time)
+		}
+		if want := vl.Interval.Round(time.Nanosecond); vl.Interval > 0 && (got.Interval-want).Abs() > time.Nanosecond {
+			t.Errorf("got interval %v, want %v", got.Interval, want)
+		}
+		gg, ok := got.Values[0].(collectd.Gauge)
+		if !ok || math.Float64bits(float64(gg)) != math.Float64bits(g) {
+			t.Errorf("got gauge %v, want %v", got.Values[0], g)
+		}
+		for i, v := range vl.Values[1:] {
+			if got.Values[i+1] != v {
+				t.Errorf("got value %v, want %v", got.Values[i+1], v)
+			}
+		}
+		b2, _ := AppendValueList(nil, got)
+		if !bytes.Equal(b, b2) {
+			t.Errorf("re-encoding differs")
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+func (t PartType) String() string {
+	switch t {
+	case TypeHost:
+		return "host"
+	case TypeTime:
+		return "time"
+	case TypePlugin:
+		return "plugin"
+	case TypePluginInstance:
+		return "plugin_instance"
+	case TypeType:
+		return "type"
+	case TypeTypeInstance:
+		return "type_instance"
+	case TypeValues:
+		return "values"
+	case TypeInterval:
+		return "interval"
+	case TypeTimeHR:
+		return "time_hr"
+	case TypeIntervalHR:
+		return "interval_hr"
+	case TypeMessage:
+		return "message"
+	case TypeSeverity:
+		return "severity"
+	case TypeSignSHA256:
+		return "sign_sha256"
+	case TypeEncrAES256:
+		return "encr_aes256"
+	default:
+		return fmt.Sprintf("PartType(0x%04x)", uint16(t))
+	}
+}
+
+// Part is a single part of a packet: a type, followed by a payload
+// whose meaning depends on the type.
+type Part struct {
+	Type    PartType
+	Payload []byte
+}
+
+// EncodePart returns the encoding of a part with the given type and
+// payload. Use it to add parts that this package doesn't know about
+// to a packet.
+func EncodePart(typ PartType, payload []byte) ([]byte, error) {
+	return AppendPart(nil, typ, payload)
+}
+
+// AppendPart is like EncodePart, but appends to dst and returns the
+// extended slice.
+func AppendPart(dst []byte, typ PartType, payload []byte) ([]byte, error) {
+	if 4+len(payload) > math.MaxUint16 {
+		return dst, errors.New("network: part too large")
+	}
+	dst = appendHeader(dst, typ, 4+len(payload))
+	return append(dst, payload...), nil
+}
+
+// PartIterator iterates over the parts of a packet, without
+// interpreting them.
+//
+//	it := NewPartIterator(packet)
+//	for it.Next() {
+//		p := it.Part()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type PartIterator struct {
+	b    []byte
+	part Part
+	err  error
+}
+
+// NewPartIterator returns an iterator over the parts of the packet b.
+func NewPartIterator(b []byte) *PartIterator {
+	return &PartIterator{b: b}
+}
+
+// Next advances to the next part. It returns false at the end of the
+// packet or if the packet is malformed.
+func (it *PartIterator) Next() bool {
+	if it.err != nil || len(it.b) == 0 {
+		return false
+	}
+	if len(it.b) < 4 {
+		it.err = errors.New("network: truncated part header")
+		return false
+	}
+	typ := PartType(binary.BigEndian.Uint16(it.b))
+	length := int(binary.BigEndian.Uint16(it.b[2:]))
+	if length < 4 || length > len(it.b) {
+		it.err = fmt.Errorf("network: invalid length %d of %s part", length, typ)
+		return false
+	}
+	it.part = Part{Type: typ, Payload: it.b[4:length]}
+	it.b = it.b[length:]
+	return true
+}
+
+// Part returns the current part. Its payload refers to the packet
+// passed to NewPartIterator.
+func (it *PartIterator) Part() Part {
+	return it.part
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *PartIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,133 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"honnef.co/go/collectd"
+)
+
+// Relay forwards value lists and notifications to several Clients,
+// each of which may use its own security level and packet size.
+// Together with collectd.Server and collectd.WriterHandler, it relays
+// from the unixsock protocol to the network protocol.
+type Relay struct {
+	clients []*Client
+}
+
+var (
+	_ collectd.Writer             = (*Relay)(nil)
+	_ collectd.NotificationWriter = (*Relay)(nil)
+)
+
+// NewRelay returns a Relay that forwards to clients.
+func NewRelay(clients ...*Client) *Relay {
+	return &Relay{clients: clients}
+}
+
+// DialEndpoint returns a Client for a Server block of collectd's
+// network plugin, using its address and security settings. opts are
+// applied after the block's settings.
+func DialEndpoint(ep collectd.NetworkEndpoint, opts ...ClientOption) (*Client, error) {
+	level, err := ParseSecurityLevel(ep.SecurityLevel)
+	if err != nil {
+		return nil, err
+	}
+	var epOpts []ClientOption
+	if level != None {
+		epOpts = append(epOpts, WithSecurity(level, ep.Username, ep.Password))
+	}
+	if ep.ResolveInterval > 0 {
+		epOpts = append(epOpts, WithResolveInterval(ep.ResolveInterval))
+	}
+	opts = append(epOpts, opts...)
+	port := ep.Port
+	if port == "" {
+		port = collectd.DefaultNetworkPort
+	}
+	return Dial(net.JoinHostPort(ep.Host, port), opts...)
+}
+
+// DialEndpoints returns a Relay with one Client per endpoint, like
+// collectd's network plugin with several Server blocks. See
+// DialEndpoint.
+func DialEndpoints(eps []collectd.NetworkEndpoint, opts ...ClientOption) (*Relay, error) {
+	r := &Relay{}
+	for _, ep := range eps {
+		c, err := DialEndpoint(ep, opts...)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("server %s: %w", ep.Host, err)
+		}
+		r.clients = append(r.clients, c)
+	}
+	return r, nil
+}
+
+// Clients returns the clients of the relay, indexed like the errors
+// of a *collectd.MultiError returned by the relay.
+func (r *Relay) Clients() []*Client {
+	return r.clients
+}
+
+// ListenUnix serves the unixsock protocol on the unix socket path,
+// forwarding all value lists and notifications that it receives. See
+// collectd.Listen.
+func (r *Relay) ListenUnix(path string) (*collectd.Server, error) {
+	return collectd.Listen(path, collectd.WriterHandler(r))
+}
+
+// each calls fn for every client. If any of them fail, the returned
+// error is a *collectd.MultiError, indexed like the clients.
+func (r *Relay) each(fn func(c *Client) error) error {
+	var errs []error
+	for i, c := range r.clients {
+		if err := fn(c); err != nil {
+			if errs == nil {
+				errs = make([]error, len(r.clients))
+			}
+			errs[i] = err
+		}
+	}
+	if errs != nil {
+		return &collectd.MultiError{Errors: errs}
+	}
+	return nil
+}
+
+// Write writes vl to all clients.
+func (r *Relay) Write(ctx context.Context, vl collectd.ValueList) error {
+	return r.each(func(c *Client) error { return c.Write(ctx, vl) })
+}
+
+// WriteNotification writes n to all clients.
+func (r *Relay) WriteNotification(ctx context.Context, n collectd.Notification) error {
+	return r.each(func(c *Client) error { return c.WriteNotification(ctx, n) })
+}
+
+// Flush sends the current packets of all clients.
+func (r *Relay) Flush(ctx context.Context) error {
+	return r.each(func(c *Client) error { return c.Flush(ctx) })
+}
+
+// Health reports the relay as healthy if all clients are healthy, and
+// as connected if all clients are connected. The last error is that
+// of the client that failed most recently.
+func (r *Relay) Health() collectd.Health {
+	h := collectd.Health{Healthy: true, Connected: true}
+	for _, c := range r.clients {
+		ch := c.Health()
+		h.Healthy = h.Healthy && ch.Healthy
+		h.Connected = h.Connected && ch.Connected
+		if ch.LastErrorTime.After(h.LastErrorTime) {
+			h.LastError, h.LastErrorTime = ch.LastError, ch.LastErrorTime
+		}
+	}
+	return h
+}
+
+// Close closes all clients.
+func (r *Relay) Close() error {
+	return r.each(func(c *Client) error { return c.Close() })
+}
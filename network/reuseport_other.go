@@ -0,0 +1,14 @@
+//go:build !unix || solaris
+
+package network
+
+import (
+	"errors"
+	"syscall"
+)
+
+const reusePortSupported = false
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("network: SO_REUSEPORT is not supported on this platform")
+}
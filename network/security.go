@@ -0,0 +1,181 @@
+package network
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// SecurityLevel determines whether packets are signed or encrypted.
+type SecurityLevel int
+
+const (
+	// None sends plain packets. Servers accept all packets, but
+	// verify signatures if they know the user's password.
+	None SecurityLevel = iota
+	// Sign signs packets with HMAC-SHA256. Servers only accept
+	// signed or encrypted packets.
+	Sign
+	// Encrypt encrypts packets with AES-256. Servers only accept
+	// encrypted packets.
+	Encrypt
+)
+
+func (l SecurityLevel) String() string {
+	switch l {
+	case None:
+		return "None"
+	case Sign:
+		return "Sign"
+	case Encrypt:
+		return "Encrypt"
+	default:
+		return fmt.Sprintf("SecurityLevel(%d)", int(l))
+	}
+}
+
+// ParseSecurityLevel parses a security level as used in collectd's
+// configuration. The empty string is parsed as None.
+func ParseSecurityLevel(s string) (SecurityLevel, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return None, nil
+	case "sign":
+		return Sign, nil
+	case "encrypt":
+		return Encrypt, nil
+	default:
+		return 0, errors.New("network: invalid security level " + s)
+	}
+}
+
+const (
+	signatureSize  = 4 + sha256.Size
+	encryptionSize = 4 + 2 + aes.BlockSize + sha1.Size
+)
+
+// securityOverhead returns the number of bytes that securing a packet
+// adds to it.
+func securityOverhead(level SecurityLevel, username string) int {
+	switch level {
+	case Sign:
+		return signatureSize + len(username)
+	case Encrypt:
+		return encryptionSize + len(username)
+	default:
+		return 0
+	}
+}
+
+// sign returns the packet b, prefixed with a signature part.
+func sign(b []byte, username, password string) []byte {
+	out := make([]byte, 0, signatureSize+len(username)+len(b))
+	out = appendHeader(out, TypeSignSHA256, signatureSize+len(username))
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(username))
+	mac.Write(b)
+	out = mac.Sum(out)
+	out = append(out, username...)
+	return append(out, b...)
+}
+
+// encrypt returns the packet b, wrapped in an encryption part.
+func encrypt(b []byte, username, password string) ([]byte, error) {
+	length := encryptionSize + len(username) + len(b)
+	if length > math.MaxUint16 {
+		return nil, errors.New("network: packet too large to encrypt")
+	}
+	out := make([]byte, 0, length)
+	out = appendHeader(out, TypeEncrAES256, length)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(username)))
+	out = append(out, username...)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	out = append(out, iv...)
+	start := len(out)
+	sum := sha1.Sum(b)
+	out = append(out, sum[:]...)
+	out = append(out, b...)
+	stream, err := newStream(password, iv)
+	if err != nil {
+		return nil, err
+	}
+	stream.XORKeyStream(out[start:], out[start:])
+	return out, nil
+}
+
+// verify checks the signature part payload sig against the rest of
+// the packet.
+func verify(sig, rest []byte, passwords PasswordLookup) error {
+	if len(sig) < sha256.Size {
+		return errors.New("signature too short")
+	}
+	hash, username := sig[:sha256.Size], string(sig[sha256.Size:])
+	password, err := lookup(passwords, username)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, []byte(password))
+	mac.Write([]byte(username))
+	mac.Write(rest)
+	if !hmac.Equal(mac.Sum(nil), hash) {
+		return fmt.Errorf("invalid signature of user %q", username)
+	}
+	return nil
+}
+
+// decrypt returns the packet contained in the encryption part
+// payload b.
+func decrypt(b []byte, passwords PasswordLookup) ([]byte, error) {
+	if len(b) < 2 {
+		return nil, errors.New("missing user name")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	b = b[2:]
+	if len(b) < n+aes.BlockSize+sha1.Size {
+		return nil, errors.New("encrypted part too short")
+	}
+	username := string(b[:n])
+	password, err := lookup(passwords, username)
+	if err != nil {
+		return nil, err
+	}
+	iv := b[n : n+aes.BlockSize]
+	data := append([]byte(nil), b[n+aes.BlockSize:]...)
+	stream, err := newStream(password, iv)
+	if err != nil {
+		return nil, err
+	}
+	stream.XORKeyStream(data, data)
+	sum := sha1.Sum(data[sha1.Size:])
+	if !hmac.Equal(sum[:], data[:sha1.Size]) {
+		return nil, fmt.Errorf("could not decrypt packet of user %q", username)
+	}
+	return data[sha1.Size:], nil
+}
+
+func lookup(passwords PasswordLookup, username string) (string, error) {
+	if passwords == nil {
+		return "", fmt.Errorf("no password for user %q", username)
+	}
+	return passwords.Password(username)
+}
+
+func newStream(password string, iv []byte) (cipher.Stream, error) {
+	key := sha256.Sum256([]byte(password))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewOFB(block, iv), nil
+}
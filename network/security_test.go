@@ -0,0 +1,179 @@
+package network
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"honnef.co/go/collectd"
+)
+
+// The reference packets were built independently of this package,
+// with Python's hmac and hashlib modules and openssl enc
+// -aes-256-ofb, following the layout of collectd's network plugin.
+// They contain the value lists of referenceValueLists, secured for
+// user alice with password secret; the encrypted packet uses the IV
+// 00 01 … 0f.
+const (
+	referencePlain     = "000000106578616d706c652e636f6d000008000c1954fc40000000000009000c0000000280000000000200086370750000030006300000040008637075000005000969646c65000006000f000102000000000000002a000200096c6f61640000030005000004000a67617567650000050005000006000f000101000000000000e03f"
+	referenceSigned    = "02000029541383cb66f37569a67a920662ab4168695073c754830042d99c4993647b15a7616c696365" + referencePlain
+	referenceEncrypted = "021000b10005616c696365000102030405060708090a0b0c0d0e0fc73332bd26c12ce110388a1eb7572fc7c3ab3e54805ac9230e7f563a8912e209f3618ecdacc6ea06ebbd77e7407caae2b4af7c131ac25bc14fbf2a75a7fbd42a5692478fa13bb2f4acf2ae78117b6e71548ccf7c8d507b05cbeee4f2a872cf886e4e1494896706c4e64d097909469fa8b3c8054c9fe52300a9903c87b1bcfb13ef615104a5ab039b6bc52a7c4106a7f8b4b6a5f1c83a"
+)
+
+var referenceValueLists = []collectd.ValueList{
+	{
+		Identifier: collectd.Identifier{Host: "example.com", Plugin: "cpu", PluginInstance: "0", Type: "cpu", TypeInstance: "idle"},
+		Time:       time.Unix(1700000000, 0),
+		Interval:   10 * time.Second,
+		Values:     []collectd.Value{collectd.Derive(42)},
+	},
+	{
+		Identifier: collectd.Identifier{Host: "example.com", Plugin: "load", Type: "gauge"},
+		Time:       time.Unix(1700000000, 0),
+		Interval:   10 * time.Second,
+		Values:     []collectd.Value{collectd.Gauge(0.5)},
+	},
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func parseSecured(b []byte, level SecurityLevel, passwords PasswordLookup) ([]collectd.ValueList, error) {
+	p := parser{level: level, passwords: passwords}
+	err := p.parse(b, None)
+	return p.vls, err
+}
+
+func checkValueLists(t *testing.T, got, want []collectd.ValueList) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d value lists, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.Identifier != w.Identifier || !g.Time.Equal(w.Time) || g.Interval != w.Interval ||
+			len(g.Values) != len(w.Values) || g.Values[0] != w.Values[0] {
+			t.Errorf("value list %d: got %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func TestSecurityRoundTrip(t *testing.T) {
+	plain := mustDecodeHex(t, referencePlain)
+	encrypted, err := encrypt(plain, "alice", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passwords := Passwords{"alice": "secret"}
+	for _, tt := range []struct {
+		name   string
+		packet []byte
+		level  SecurityLevel
+	}{
+		{"sign", sign(plain, "alice", "secret"), Sign},
+		{"encrypt", encrypted, Encrypt},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			vls, err := parseSecured(tt.packet, tt.level, passwords)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkValueLists(t, vls, referenceValueLists)
+		})
+	}
+}
+
+func TestSecurityReference(t *testing.T) {
+	// Signing is deterministic, so our signature must match.
+	plain := mustDecodeHex(t, referencePlain)
+	if got := hex.EncodeToString(sign(plain, "alice", "secret")); got != referenceSigned {
+		t.Errorf("got signed packet\n%s\nwant\n%s", got, referenceSigned)
+	}
+
+	passwords := Passwords{"alice": "secret"}
+	for _, tt := range []struct {
+		name   string
+		packet string
+		level  SecurityLevel
+	}{
+		{"plain", referencePlain, None},
+		{"signed", referenceSigned, Sign},
+		{"encrypted", referenceEncrypted, Encrypt},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			vls, err := parseSecured(mustDecodeHex(t, tt.packet), tt.level, passwords)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkValueLists(t, vls, referenceValueLists)
+		})
+	}
+}
+
+func TestSecurityRejects(t *testing.T) {
+	corrupt := func(s string, i int) []byte {
+		b := mustDecodeHex(t, s)
+		b[i] ^= 0xff
+		return b
+	}
+	// The MAC starts after the part header, the ciphertext after the
+	// header, user name length, user name and IV.
+	badMAC := corrupt(referenceSigned, 4)
+	badChecksum := corrupt(referenceEncrypted, 4+2+len("alice")+16)
+	badPayload := corrupt(referenceSigned, len(referenceSigned)/2-1)
+
+	tests := []struct {
+		name      string
+		packet    []byte
+		passwords PasswordLookup
+	}{
+		{"bad MAC", badMAC, Passwords{"alice": "secret"}},
+		{"signed payload modified", badPayload, Passwords{"alice": "secret"}},
+		{"bad checksum", badChecksum, Passwords{"alice": "secret"}},
+		{"signed by unknown user", mustDecodeHex(t, referenceSigned), Passwords{"bob": "secret"}},
+		{"encrypted by unknown user", mustDecodeHex(t, referenceEncrypted), Passwords{"bob": "secret"}},
+		{"signed with wrong password", mustDecodeHex(t, referenceSigned), Passwords{"alice": "hunter2"}},
+		{"encrypted with wrong password", mustDecodeHex(t, referenceEncrypted), Passwords{"alice": "hunter2"}},
+	}
+	for _, tt := range tests {
+		for _, level := range []SecurityLevel{None, Sign, Encrypt} {
+			t.Run(tt.name+"/"+level.String(), func(t *testing.T) {
+				vls, err := parseSecured(tt.packet, level, tt.passwords)
+				var serr *SecurityError
+				if !errors.As(err, &serr) {
+					t.Errorf("got error %v, want *SecurityError", err)
+				}
+				if len(vls) != 0 {
+					t.Errorf("got %d value lists from rejected packet", len(vls))
+				}
+			})
+		}
+	}
+
+	// Packets must meet the required level.
+	passwords := Passwords{"alice": "secret"}
+	for _, tt := range []struct {
+		name   string
+		packet string
+		level  SecurityLevel
+	}{
+		{"plain at Sign", referencePlain, Sign},
+		{"plain at Encrypt", referencePlain, Encrypt},
+		{"signed at Encrypt", referenceSigned, Encrypt},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			vls, err := parseSecured(mustDecodeHex(t, tt.packet), tt.level, passwords)
+			var serr *SecurityError
+			if !errors.As(err, &serr) || len(vls) != 0 {
+				t.Errorf("got %d value lists and error %v, want *SecurityError", len(vls), err)
+			}
+		})
+	}
+}
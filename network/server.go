@@ -0,0 +1,331 @@
+package network
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// Server receives packets of the binary protocol and dispatches the
+// value lists and notifications they contain.
+type Server struct {
+	// Addr is the UDP address to listen on. It defaults to
+	// collectd's default port on all interfaces. If it is a
+	// multicast group, the server joins the group.
+	Addr string
+	// Interface is the name of the network interface on which to
+	// join a multicast group. If it is empty, the zone of Addr is
+	// used, as in "[ff18::efc0:4a42%eth0]:25826", and otherwise the
+	// system's default interface.
+	Interface string
+	// Writer receives all value lists. If it implements
+	// collectd.NotificationWriter, it also receives all
+	// notifications; otherwise notifications are dropped.
+	Writer collectd.Writer
+	// SecurityLevel is the minimum security level of accepted
+	// packets. Packets below it are dropped.
+	SecurityLevel SecurityLevel
+	// Passwords provides the passwords for verifying and decrypting
+	// packets.
+	Passwords PasswordLookup
+	// MaxPacketSize is the size of the largest accepted packet. It
+	// defaults to DefaultBufferSize and must be at least as large as
+	// the packet size of all clients. Larger packets are dropped.
+	MaxPacketSize int
+	// Cache, if not nil, is used to drop value lists that are not
+	// newer than the previous one with the same identifier.
+	Cache *Cache
+	// UnknownPart, if not nil, is called for parts of types that the
+	// server doesn't know, which are otherwise skipped. The payload
+	// is only valid during the call.
+	UnknownPart func(peer net.Addr, p Part)
+	// Sockets is the number of sockets that ListenAndDispatch opens
+	// on Addr, using SO_REUSEPORT, each served by its own goroutine.
+	// This lets the kernel spread packets across CPUs, which on
+	// Linux raises the packet rate a server can handle. Values above
+	// one are only supported on Unix systems other than Solaris, and
+	// not for multicast groups. With several sockets, Writer is
+	// called concurrently.
+	Sockets int
+	// Workers is the number of goroutines per socket that decode
+	// and dispatch packets. If it is zero, packets are handled by
+	// the goroutine that receives them, and a slow Writer delays
+	// receiving, which can overflow the socket's receive buffer.
+	// With workers, received packets are queued instead, and
+	// dropped if the queue is full. With more than one worker,
+	// Writer is called concurrently.
+	Workers int
+	// QueueSize is the number of packets per socket that may wait
+	// for a worker. It defaults to 1024.
+	QueueSize int
+	// Logger, if not nil, receives malformed packets and errors
+	// returned by Writer.
+	Logger *slog.Logger
+
+	errs      health.ErrorTracker
+	peers     peerTable
+	listening atomic.Int32
+	stopped   atomic.Bool
+	queued    atomic.Int64
+	dropped   atomic.Uint64
+}
+
+// packet is a received packet waiting for a worker.
+type packet struct {
+	buf  *[]byte
+	n    int
+	addr net.Addr
+}
+
+// ListenAndDispatch listens on the UDP address addr and writes all
+// received value lists and notifications to w. It only returns on
+// error.
+func ListenAndDispatch(addr string, w collectd.Writer) error {
+	s := &Server{Addr: addr, Writer: w}
+	return s.ListenAndDispatch(context.Background())
+}
+
+// ListenAndDispatch listens on s.Addr and dispatches received packets
+// until ctx is canceled.
+func (s *Server) ListenAndDispatch(ctx context.Context) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":" + collectd.DefaultNetworkPort
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, collectd.DefaultNetworkPort)
+	}
+	n := max(s.Sockets, 1)
+	if n > 1 && !reusePortSupported {
+		return errors.New("network: multiple sockets are not supported on this platform")
+	}
+	conns := make([]net.PacketConn, 0, n)
+	for range n {
+		conn, err := s.listen(ctx, addr, n > 1)
+		if err != nil {
+			for _, c := range conns {
+				c.Close()
+			}
+			s.errs.Track(err)
+			return err
+		}
+		conns = append(conns, conn)
+	}
+	if n == 1 {
+		return s.Dispatch(ctx, conns[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, n)
+	for _, conn := range conns {
+		go func() { errs <- s.Dispatch(ctx, conn) }()
+	}
+	// Stop all sockets when one of them fails.
+	err := <-errs
+	cancel()
+	for range n - 1 {
+		<-errs
+	}
+	return err
+}
+
+func (s *Server) listen(ctx context.Context, addr string, reuse bool) (net.PacketConn, error) {
+	uaddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var lc net.ListenConfig
+	if reuse {
+		lc.Control = reusePort
+	}
+	if !uaddr.IP.IsMulticast() {
+		return lc.ListenPacket(ctx, "udp", addr)
+	}
+	if reuse {
+		// Every socket would receive every packet.
+		return nil, errors.New("network: multiple sockets are not supported for multicast groups")
+	}
+	var ifi *net.Interface
+	switch name := cmp.Or(s.Interface, uaddr.Zone); {
+	case name == "":
+	case isNumeric(name):
+		// Zones may also be interface indices.
+		idx, _ := strconv.Atoi(name)
+		ifi, err = net.InterfaceByIndex(idx)
+	default:
+		ifi, err = net.InterfaceByName(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	network := "udp6"
+	if uaddr.IP.To4() != nil {
+		network = "udp4"
+	}
+	return net.ListenMulticastUDP(network, ifi, uaddr)
+}
+
+func isNumeric(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Dispatch reads packets from conn and dispatches them until ctx is
+// canceled. It closes conn before returning.
+func (s *Server) Dispatch(ctx context.Context, conn net.PacketConn) error {
+	size := cmp.Or(s.MaxPacketSize, DefaultBufferSize)
+	if err := checkPacketSize(size); err != nil {
+		conn.Close()
+		return err
+	}
+	s.listening.Add(1)
+	defer s.listening.Add(-1)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	// One extra byte to detect packets that are too large.
+	buf := make([]byte, size+1)
+	handle := func(n int, addr net.Addr) { s.handlePacket(ctx, buf[:n], addr) }
+	if s.Workers > 0 {
+		// The packets are only copied into queued buffers once
+		// we know their size.
+		pool := sync.Pool{New: func() any { b := make([]byte, size); return &b }}
+		queue := make(chan packet, cmp.Or(s.QueueSize, 1024))
+		var wg sync.WaitGroup
+		for range s.Workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for p := range queue {
+					s.queued.Add(-1)
+					s.handlePacket(ctx, (*p.buf)[:p.n], p.addr)
+					pool.Put(p.buf)
+				}
+			}()
+		}
+		defer wg.Wait()
+		defer close(queue)
+		handle = func(n int, addr net.Addr) {
+			b := pool.Get().(*[]byte)
+			copy(*b, buf[:n])
+			select {
+			case queue <- packet{b, n, addr}:
+				s.queued.Add(1)
+			default:
+				pool.Put(b)
+				s.dropped.Add(1)
+				s.peers.update(addr, func(ps *PeerStats) {
+					ps.Packets++
+					ps.Bytes += uint64(n)
+					ps.QueueDrops++
+				})
+			}
+		}
+	}
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.errs.Track(err)
+			s.stopped.Store(true)
+			return err
+		}
+		if n > size {
+			s.peers.update(addr, func(ps *PeerStats) {
+				ps.Packets++
+				ps.Bytes += uint64(n)
+				ps.Dropped++
+			})
+			s.log("dropping packet", fmt.Errorf("network: packet larger than MaxPacketSize %d", size), addr)
+			continue
+		}
+		handle(n, addr)
+	}
+}
+
+func (s *Server) handlePacket(ctx context.Context, b []byte, addr net.Addr) {
+	p := parser{level: s.SecurityLevel, passwords: s.Passwords}
+	if s.UnknownPart != nil {
+		p.unknown = func(part Part) { s.UnknownPart(addr, part) }
+	}
+	err := p.parse(b, None)
+	vls, ns := p.vls, p.ns
+	if err != nil {
+		s.log("malformed packet", err, addr)
+	}
+	var dropped, duplicates uint64
+	for _, vl := range vls {
+		if s.Cache != nil && !s.Cache.Update(vl) {
+			duplicates++
+			continue
+		}
+		if err := s.Writer.Write(ctx, vl); err != nil {
+			dropped++
+			s.log("could not write value list", err, addr)
+		}
+	}
+	if nw, ok := s.Writer.(collectd.NotificationWriter); ok {
+		for _, n := range ns {
+			if err := nw.WriteNotification(ctx, n); err != nil {
+				dropped++
+				s.log("could not write notification", err, addr)
+			}
+		}
+	} else {
+		dropped += uint64(len(ns))
+	}
+	s.peers.update(addr, func(ps *PeerStats) {
+		ps.Packets++
+		ps.Bytes += uint64(len(b))
+		ps.ValueLists += uint64(len(vls))
+		ps.Notifications += uint64(len(ns))
+		ps.Dropped += dropped
+		ps.Duplicates += duplicates
+		if err != nil {
+			countError(ps, err)
+		}
+	})
+}
+
+func (s *Server) log(msg string, err error, addr net.Addr) {
+	s.errs.Track(err)
+	if s.Logger != nil {
+		s.Logger.Warn(msg, "error", err, "peer", addr.String())
+	}
+}
+
+// Dropped returns the number of packets that were dropped because
+// the queue of the workers was full.
+func (s *Server) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Health reports the server as healthy unless it stopped because of
+// an error, and as connected while it is listening. Queued is the
+// number of packets waiting for a worker.
+func (s *Server) Health() collectd.Health {
+	err, when := s.errs.Last()
+	return collectd.Health{
+		Healthy:       !s.stopped.Load(),
+		Connected:     s.listening.Load() > 0,
+		LastError:     err,
+		LastErrorTime: when,
+		Queued:        int(s.queued.Load()),
+	}
+}
@@ -0,0 +1,98 @@
+package network
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// PeerStats are the statistics of a single sender.
+type PeerStats struct {
+	Packets uint64
+	Bytes   uint64
+	// ValueLists and Notifications count the decoded items.
+	ValueLists    uint64
+	Notifications uint64
+	// DecodeErrors counts malformed packets, and SecurityErrors
+	// packets that failed verification or decryption, or didn't
+	// meet the server's security level.
+	DecodeErrors   uint64
+	SecurityErrors uint64
+	// Dropped counts items that the server's Writer failed to
+	// handle or doesn't support, and packets larger than the
+	// server's MaxPacketSize.
+	Dropped uint64
+	// Duplicates counts value lists dropped by the server's Cache.
+	Duplicates uint64
+	// QueueDrops counts packets that were dropped because the queue
+	// of the server's workers was full.
+	QueueDrops uint64
+	LastSeen   time.Time
+}
+
+// maxPeers limits the number of peers that are tracked individually,
+// so that senders with spoofed addresses can't exhaust memory.
+const maxPeers = 1024
+
+// OtherPeers is the key under which Server.Stats reports senders
+// beyond the first 1024.
+const OtherPeers = "other"
+
+type peerTable struct {
+	mu    sync.Mutex
+	peers map[string]*PeerStats
+}
+
+// update calls fn with the statistics of the peer addr.
+func (t *peerTable) update(addr net.Addr, fn func(ps *PeerStats)) {
+	key := addr.String()
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		key = host
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.peers == nil {
+		t.peers = map[string]*PeerStats{}
+	}
+	ps, ok := t.peers[key]
+	if !ok {
+		if len(t.peers) >= maxPeers {
+			key = OtherPeers
+			ps = t.peers[key]
+		}
+		if ps == nil {
+			ps = &PeerStats{}
+			t.peers[key] = ps
+		}
+	}
+	ps.LastSeen = time.Now()
+	fn(ps)
+}
+
+func (t *peerTable) snapshot() map[string]PeerStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make(map[string]PeerStats, len(t.peers))
+	for k, ps := range t.peers {
+		out[k] = *ps
+	}
+	return out
+}
+
+// Stats returns the statistics of all senders, keyed by their IP
+// address. Senders beyond the first 1024 are combined under the key
+// OtherPeers.
+func (s *Server) Stats() map[string]PeerStats {
+	return s.peers.snapshot()
+}
+
+// countError records err, as returned by the parser, in ps.
+func countError(ps *PeerStats, err error) {
+	var serr *SecurityError
+	if errors.As(err, &serr) {
+		ps.SecurityErrors++
+	} else {
+		ps.DecodeErrors++
+	}
+}
@@ -0,0 +1,212 @@
+package collectd
+
+import (
+	"context"
+	"path"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// NotificationRoute selects the notifications that a handler of a
+// NotificationRouter receives.
+type NotificationRoute struct {
+	// Pattern is matched against the identifiers of notifications
+	// using path.Match. Empty fields of notifications' identifiers
+	// are empty in the string as well, as in "host/plugin/". An
+	// empty pattern matches all notifications.
+	Pattern string
+	// Severities are the severities of notifications that are
+	// routed. If it is empty, all severities are.
+	Severities []Severity
+	// Handler receives the matching notifications.
+	Handler NotificationWriter
+	// QueueSize is the number of notifications that may wait for
+	// Handler. It defaults to 64. Notifications that don't fit are
+	// dropped.
+	QueueSize int
+}
+
+func (rt *NotificationRoute) match(n Notification) bool {
+	if len(rt.Severities) > 0 && !slices.Contains(rt.Severities, n.Severity) {
+		return false
+	}
+	if rt.Pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(rt.Pattern, n.Identifier.String())
+	return ok
+}
+
+type routeHandler struct {
+	NotificationRoute
+	queue chan Notification
+	done  chan struct{}
+}
+
+// NotificationRouter is a NotificationWriter that dispatches
+// notifications from any source, such as a Server, a network.Server or
+// an exec plugin, to the handlers of all matching routes. Every
+// handler has its own queue and goroutine, so that a slow or failing
+// handler does not delay or affect the others.
+//
+// NotificationRouter is also a Writer, so that it can be used as the
+// writer of servers that receive both value lists and notifications.
+type NotificationRouter struct {
+	next    Writer
+	onError func(Notification, error)
+
+	errs    health.ErrorTracker
+	failed  atomic.Bool
+	dropped atomic.Uint64
+
+	mu       sync.RWMutex
+	handlers []*routeHandler
+	closed   bool
+}
+
+var (
+	_ Writer             = (*NotificationRouter)(nil)
+	_ NotificationWriter = (*NotificationRouter)(nil)
+)
+
+// NewNotificationRouter returns a NotificationRouter that passes
+// value lists to next, which may be nil to discard them. Because
+// handlers run in the background, their errors are reported by
+// calling onError, which may be nil. onError may be called
+// concurrently.
+func NewNotificationRouter(next Writer, onError func(Notification, error)) *NotificationRouter {
+	return &NotificationRouter{next: next, onError: onError}
+}
+
+// Add adds a route and starts its handler. Calling remove removes the
+// route and waits until the handler has processed its queue.
+func (r *NotificationRouter) Add(rt NotificationRoute) (remove func()) {
+	size := rt.QueueSize
+	if size <= 0 {
+		size = 64
+	}
+	h := &routeHandler{
+		NotificationRoute: rt,
+		queue:             make(chan Notification, size),
+		done:              make(chan struct{}),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		close(h.done)
+		return func() {}
+	}
+	r.handlers = append(r.handlers, h)
+	go r.run(h)
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			r.mu.Lock()
+			i := slices.Index(r.handlers, h)
+			if i >= 0 {
+				r.handlers = slices.Delete(r.handlers, i, i+1)
+				close(h.queue)
+			}
+			r.mu.Unlock()
+			<-h.done
+		})
+	}
+}
+
+func (r *NotificationRouter) run(h *routeHandler) {
+	defer close(h.done)
+	for n := range h.queue {
+		err := h.Handler.WriteNotification(context.Background(), n)
+		r.errs.Track(err)
+		r.failed.Store(err != nil)
+		if err != nil && r.onError != nil {
+			r.onError(n, err)
+		}
+	}
+}
+
+// WriteNotification queues n for the handlers of all matching
+// routes. It never blocks. Handlers whose queue is full miss n, which
+// is reported to onError as ErrQueueFull.
+func (r *NotificationRouter) WriteNotification(ctx context.Context, n Notification) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return ErrClosed
+	}
+	for _, h := range r.handlers {
+		if !h.match(n) {
+			continue
+		}
+		select {
+		case h.queue <- n:
+		default:
+			r.dropped.Add(1)
+			r.errs.Track(ErrQueueFull)
+			if r.onError != nil {
+				r.onError(n, ErrQueueFull)
+			}
+		}
+	}
+	return nil
+}
+
+// Write passes vl to the writer given to NewNotificationRouter.
+func (r *NotificationRouter) Write(ctx context.Context, vl ValueList) error {
+	if r.next == nil {
+		return nil
+	}
+	return r.next.Write(ctx, vl)
+}
+
+// Dropped returns the number of notifications that handlers missed
+// because their queue was full.
+func (r *NotificationRouter) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// Health reports the router as healthy until it is closed, and as
+// connected if the most recent handler call succeeded. Queued is
+// the number of notifications waiting for handlers.
+func (r *NotificationRouter) Health() Health {
+	r.mu.RLock()
+	closed := r.closed
+	queued := 0
+	for _, h := range r.handlers {
+		queued += len(h.queue)
+	}
+	r.mu.RUnlock()
+	err, when := r.errs.Last()
+	return Health{
+		Healthy:       !closed,
+		Connected:     !r.failed.Load(),
+		LastError:     err,
+		LastErrorTime: when,
+		Queued:        queued,
+	}
+}
+
+// Close stops accepting notifications and waits until all handlers
+// have processed their queues. It does not close the handlers or the
+// writer of value lists.
+func (r *NotificationRouter) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	r.closed = true
+	handlers := r.handlers
+	r.handlers = nil
+	for _, h := range handlers {
+		close(h.queue)
+	}
+	r.mu.Unlock()
+	for _, h := range handlers {
+		<-h.done
+	}
+	return nil
+}
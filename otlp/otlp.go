@@ -0,0 +1,314 @@
+// Package otlp converts between collectd value lists and OpenTelemetry
+// metrics, as carried by OTLP, so that collectd values can flow into
+// OpenTelemetry pipelines and back.
+//
+// A value list becomes one metric per data source, named
+// collectd.plugin.type, with the data source name appended if the
+// value list has several values. The host becomes the host.name
+// resource attribute, and the plugin and type instances become the
+// plugin_instance and type_instance attributes of data points.
+// Gauges become gauges. Derives become non-monotonic cumulative sums,
+// counters monotonic cumulative sums and absolutes monotonic delta
+// sums.
+package otlp // import "honnef.co/go/collectd/otlp"
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"honnef.co/go/collectd"
+)
+
+// ScopeName is the name of the instrumentation scope of converted
+// metrics.
+const ScopeName = "honnef.co/go/collectd/otlp"
+
+const (
+	hostAttr           = "host.name"
+	pluginInstanceAttr = "plugin_instance"
+	typeInstanceAttr   = "type_instance"
+)
+
+// FromValueLists converts vls to metrics, grouped by host. types
+// provides data source names; if it is nil, they are named as by
+// collectd.TypesDB.DSNames. Counters larger than math.MaxInt64
+// wrap around, as OTLP has no unsigned integers.
+func FromValueLists(vls []collectd.ValueList, types collectd.TypesDB) []*metricspb.ResourceMetrics {
+	var out []*metricspb.ResourceMetrics
+	byHost := map[string]*metricspb.ScopeMetrics{}
+	metrics := map[string]*metricspb.Metric{}
+	now := time.Now()
+	for _, vl := range vls {
+		sm, ok := byHost[vl.Host]
+		if !ok {
+			sm = &metricspb.ScopeMetrics{Scope: &commonpb.InstrumentationScope{Name: ScopeName}}
+			byHost[vl.Host] = sm
+			out = append(out, &metricspb.ResourceMetrics{
+				Resource:     &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr(hostAttr, vl.Host)}},
+				ScopeMetrics: []*metricspb.ScopeMetrics{sm},
+			})
+		}
+		t := vl.Time
+		if t.IsZero() {
+			t = now
+		}
+		var attrs []*commonpb.KeyValue
+		if vl.PluginInstance != "" {
+			attrs = append(attrs, stringAttr(pluginInstanceAttr, vl.PluginInstance))
+		}
+		if vl.TypeInstance != "" {
+			attrs = append(attrs, stringAttr(typeInstanceAttr, vl.TypeInstance))
+		}
+		names := types.DSNames(vl)
+		for i, v := range vl.Values {
+			name := "collectd." + vl.Plugin + "." + vl.Type
+			if len(vl.Values) > 1 {
+				name += "." + names[i]
+			}
+			dp := &metricspb.NumberDataPoint{Attributes: attrs, TimeUnixNano: uint64(t.UnixNano())}
+			key := vl.Host + "\x00" + name + "\x00" + v.DSType().String()
+			m, ok := metrics[key]
+			if !ok {
+				m = newMetric(name, v.DSType())
+				metrics[key] = m
+				sm.Metrics = append(sm.Metrics, m)
+			}
+			switch v := v.(type) {
+			case collectd.Gauge:
+				dp.Value = &metricspb.NumberDataPoint_AsDouble{AsDouble: float64(v)}
+				g := m.Data.(*metricspb.Metric_Gauge).Gauge
+				g.DataPoints = append(g.DataPoints, dp)
+				continue
+			case collectd.Derive:
+				dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(v)}
+			case collectd.Counter:
+				dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(v)}
+			case collectd.Absolute:
+				dp.Value = &metricspb.NumberDataPoint_AsInt{AsInt: int64(v)}
+			}
+			s := m.Data.(*metricspb.Metric_Sum).Sum
+			s.DataPoints = append(s.DataPoints, dp)
+		}
+	}
+	return out
+}
+
+func newMetric(name string, t collectd.DSType) *metricspb.Metric {
+	m := &metricspb.Metric{Name: name}
+	switch t {
+	case collectd.DSTypeGauge:
+		m.Data = &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{}}
+	case collectd.DSTypeDerive:
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}}
+	case collectd.DSTypeCounter:
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+	case collectd.DSTypeAbsolute:
+		m.Data = &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+			AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+			IsMonotonic:            true,
+		}}
+	}
+	return m
+}
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// ToValueLists converts gauges and sums to value lists; other kinds
+// of metrics are skipped.
+//
+// Metrics named like those of FromValueLists are mapped back to their
+// identifiers, and data points of the data sources of one value list
+// are joined again, ordered according to types if it knows the type.
+// Other metrics become value lists of plugin "otlp", of type "gauge",
+// "derive", "counter" or "absolute", and with the metric name and
+// the values of attributes other than plugin_instance, sorted by key
+// and separated by underscores, as type instance. Dots in metric
+// names and slashes are replaced by underscores.
+//
+// Sums with floating point values are rounded.
+func ToValueLists(rms []*metricspb.ResourceMetrics, types collectd.TypesDB) []collectd.ValueList {
+	var out []collectd.ValueList
+	// Value lists of several data sources, keyed by identifier and
+	// time.
+	type multiKey struct {
+		id collectd.Identifier
+		t  int64
+	}
+	type multi struct {
+		index int
+		names []string
+	}
+	multis := map[multiKey]*multi{}
+	for _, rm := range rms {
+		host := attrString(rm.GetResource().GetAttributes(), hostAttr)
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				var dps []*metricspb.NumberDataPoint
+				dsType := collectd.DSTypeGauge
+				switch data := m.Data.(type) {
+				case *metricspb.Metric_Gauge:
+					dps = data.Gauge.GetDataPoints()
+				case *metricspb.Metric_Sum:
+					dps = data.Sum.GetDataPoints()
+					switch {
+					case data.Sum.AggregationTemporality == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+						dsType = collectd.DSTypeAbsolute
+					case data.Sum.IsMonotonic:
+						dsType = collectd.DSTypeCounter
+					default:
+						dsType = collectd.DSTypeDerive
+					}
+				default:
+					continue
+				}
+				for _, dp := range dps {
+					id := collectd.Identifier{
+						Host:           host,
+						PluginInstance: attrString(dp.Attributes, pluginInstanceAttr),
+						TypeInstance:   attrString(dp.Attributes, typeInstanceAttr),
+					}
+					var dsName string
+					if rest, ok := strings.CutPrefix(m.Name, "collectd."); ok && strings.Count(rest, ".") <= 2 && strings.Contains(rest, ".") {
+						parts := strings.SplitN(rest, ".", 3)
+						id.Plugin, id.Type = parts[0], parts[1]
+						if len(parts) == 3 {
+							dsName = parts[2]
+						}
+					} else {
+						id.Plugin = "otlp"
+						id.Type = dsType.String()
+						id.TypeInstance = otherInstance(m.Name, dp.Attributes)
+					}
+					v := dataPointValue(dp, dsType)
+					var t time.Time
+					if dp.TimeUnixNano != 0 {
+						t = time.Unix(0, int64(dp.TimeUnixNano))
+					}
+					if dsName == "" {
+						out = append(out, collectd.ValueList{Identifier: id, Time: t, Values: []collectd.Value{v}})
+						continue
+					}
+					key := multiKey{id, int64(dp.TimeUnixNano)}
+					mv, ok := multis[key]
+					if !ok {
+						mv = &multi{index: len(out)}
+						multis[key] = mv
+						out = append(out, collectd.ValueList{Identifier: id, Time: t})
+					}
+					mv.names = append(mv.names, dsName)
+					out[mv.index].Values = append(out[mv.index].Values, v)
+				}
+			}
+		}
+	}
+	for _, mv := range multis {
+		dss, ok := types[out[mv.index].Type]
+		if !ok {
+			continue
+		}
+		order := map[string]int{}
+		for i, ds := range dss {
+			order[ds.Name] = i
+		}
+		vl := out[mv.index]
+		idx := make([]int, len(vl.Values))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(i, j int) bool { return order[mv.names[idx[i]]] < order[mv.names[idx[j]]] })
+		values := make([]collectd.Value, len(idx))
+		for i, j := range idx {
+			values[i] = vl.Values[j]
+		}
+		out[mv.index].Values = values
+	}
+	return out
+}
+
+func dataPointValue(dp *metricspb.NumberDataPoint, t collectd.DSType) collectd.Value {
+	if t == collectd.DSTypeGauge {
+		switch v := dp.Value.(type) {
+		case *metricspb.NumberDataPoint_AsInt:
+			return collectd.Gauge(v.AsInt)
+		case *metricspb.NumberDataPoint_AsDouble:
+			return collectd.Gauge(v.AsDouble)
+		default:
+			return collectd.Gauge(math.NaN())
+		}
+	}
+	var n int64
+	switch v := dp.Value.(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		n = v.AsInt
+	case *metricspb.NumberDataPoint_AsDouble:
+		n = int64(math.Round(v.AsDouble))
+	}
+	switch t {
+	case collectd.DSTypeDerive:
+		return collectd.Derive(n)
+	case collectd.DSTypeCounter:
+		return collectd.Counter(n)
+	default:
+		return collectd.Absolute(n)
+	}
+}
+
+func attrString(attrs []*commonpb.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return anyString(kv.Value)
+		}
+	}
+	return ""
+}
+
+func anyString(v *commonpb.AnyValue) string {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue)
+	case *commonpb.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10)
+	case *commonpb.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+// otherInstance returns the type instance of a metric that was not
+// converted by FromValueLists.
+func otherInstance(name string, attrs []*commonpb.KeyValue) string {
+	keys := make([]string, 0, len(attrs))
+	values := map[string]string{}
+	for _, kv := range attrs {
+		if kv.Key == pluginInstanceAttr {
+			continue
+		}
+		keys = append(keys, kv.Key)
+		values[kv.Key] = anyString(kv.Value)
+	}
+	sort.Strings(keys)
+	parts := []string{strings.ReplaceAll(name, ".", "_")}
+	for _, k := range keys {
+		parts = append(parts, values[k])
+	}
+	return strings.ReplaceAll(strings.Join(parts, "_"), "/", "_")
+}
@@ -0,0 +1,351 @@
+package collectd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// splitFields splits a command line into whitespace separated fields.
+// Double quotes group text containing whitespace; within them,
+// backslash escapes the next character. The quotes themselves are
+// removed.
+func splitFields(line string) ([]string, error) {
+	var out []string
+	var cur strings.Builder
+	inField, quoted := false, false
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case quoted && ch == '\\':
+			if i+1 == len(line) {
+				return nil, errors.New("unterminated escape sequence")
+			}
+			i++
+			cur.WriteByte(line[i])
+		case ch == '"':
+			quoted = !quoted
+			inField = true
+		case !quoted && (ch == ' ' || ch == '\t'):
+			if inField {
+				out = append(out, cur.String())
+				cur.Reset()
+				inField = false
+			}
+		default:
+			cur.WriteByte(ch)
+			inField = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quoted string")
+	}
+	if inField {
+		out = append(out, cur.String())
+	}
+	return out, nil
+}
+
+// parseTime parses a timestamp as used by the plain text protocol:
+// either N, meaning now, or (fractional) seconds since the epoch. N
+// is returned as the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "N" {
+		return time.Time{}, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9))), nil
+}
+
+// parseValue parses a single value of the given type. U stands for
+// an undefined gauge.
+func parseValue(s string, t DSType) (Value, error) {
+	var v Value
+	var err error
+	switch t {
+	case DSTypeGauge:
+		if s == "U" {
+			return Gauge(math.NaN()), nil
+		}
+		var f float64
+		f, err = strconv.ParseFloat(s, 64)
+		v = Gauge(f)
+	case DSTypeDerive:
+		var i int64
+		i, err = strconv.ParseInt(s, 10, 64)
+		v = Derive(i)
+	case DSTypeCounter:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, 64)
+		v = Counter(u)
+	case DSTypeAbsolute:
+		var u uint64
+		u, err = strconv.ParseUint(s, 10, 64)
+		v = Absolute(u)
+	default:
+		err = errors.New("unknown type")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s value %q", t, s)
+	}
+	return v, nil
+}
+
+// parsePutval parses the arguments of a PUTVAL command. Each value
+// set results in one value list. Values are typed according to
+// types; without type information, all values are treated as gauges.
+func parsePutval(args []string, types TypesDB) ([]ValueList, error) {
+	if len(args) < 2 {
+		return nil, errors.New("PUTVAL: missing identifier or values")
+	}
+	id, err := ParseIdentifier(args[0])
+	if err != nil {
+		return nil, err
+	}
+	var dss []DataSource
+	if types != nil {
+		var ok bool
+		dss, ok = types[id.Type]
+		if !ok {
+			return nil, fmt.Errorf("PUTVAL: unknown type %q", id.Type)
+		}
+	}
+	var interval time.Duration
+	var out []ValueList
+	for _, arg := range args[1:] {
+		if k, v, ok := strings.Cut(arg, "="); ok {
+			switch k {
+			case "interval":
+				f, err := strconv.ParseFloat(v, 64)
+				if err != nil || f <= 0 {
+					return nil, fmt.Errorf("PUTVAL: invalid interval %q", v)
+				}
+				interval = time.Duration(f * float64(time.Second))
+			default:
+				// collectd ignores unknown options, and so do we.
+			}
+			continue
+		}
+		vl, err := parseValueSet(arg, id, dss)
+		if err != nil {
+			return nil, fmt.Errorf("PUTVAL: %s", err)
+		}
+		vl.Interval = interval
+		out = append(out, vl)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("PUTVAL: missing values")
+	}
+	return out, nil
+}
+
+// parseValueSet parses a value set of the form time:value:value. If
+// dss is not nil, the values are typed and checked according to it.
+func parseValueSet(s string, id Identifier, dss []DataSource) (ValueList, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 {
+		return ValueList{}, fmt.Errorf("invalid value set %q", s)
+	}
+	if dss != nil && len(parts)-1 != len(dss) {
+		return ValueList{}, fmt.Errorf("type %s has %d data sources, got %d values", id.Type, len(dss), len(parts)-1)
+	}
+	t, err := parseTime(parts[0])
+	if err != nil {
+		return ValueList{}, err
+	}
+	vl := ValueList{Identifier: id, Time: t}
+	for i, p := range parts[1:] {
+		typ := DSTypeGauge
+		if dss != nil {
+			typ = dss[i].Type
+		}
+		v, err := parseValue(p, typ)
+		if err != nil {
+			return ValueList{}, err
+		}
+		vl.Values = append(vl.Values, v)
+	}
+	return vl, nil
+}
+
+// ParseValues parses the time and values of a value list of
+// identifier id, in the format returned by FormatValues. If types is
+// not nil, the values are typed and checked according to it, and the
+// type must be known. Otherwise, all values are treated as gauges.
+func ParseValues(s string, id Identifier, types TypesDB) (ValueList, error) {
+	var dss []DataSource
+	if types != nil {
+		var ok bool
+		if dss, ok = types[id.Type]; !ok {
+			return ValueList{}, fmt.Errorf("unknown type %q", id.Type)
+		}
+	}
+	return parseValueSet(s, id, dss)
+}
+
+// parsePutnotif parses the arguments of a PUTNOTIF command.
+func parsePutnotif(args []string) (Notification, error) {
+	var n Notification
+	var haveMsg bool
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			return Notification{}, fmt.Errorf("PUTNOTIF: invalid option %q", arg)
+		}
+		var err error
+		switch k {
+		case "message":
+			n.Message = v
+			haveMsg = true
+		case "severity":
+			n.Severity, err = ParseSeverity(v)
+		case "time":
+			n.Time, err = parseTime(v)
+		case "host":
+			n.Host = v
+		case "plugin":
+			n.Plugin = v
+		case "plugin_instance":
+			n.PluginInstance = v
+		case "type":
+			n.Type = v
+		case "type_instance":
+			n.TypeInstance = v
+		}
+		if err != nil {
+			return Notification{}, fmt.Errorf("PUTNOTIF: %s", err)
+		}
+	}
+	if !haveMsg {
+		return Notification{}, errors.New("PUTNOTIF: missing message")
+	}
+	if n.Severity == 0 {
+		return Notification{}, errors.New("PUTNOTIF: missing severity")
+	}
+	return n, nil
+}
+
+// A Command is a parsed command of the plain text protocol. It is one
+// of *PutvalCommand, *PutnotifCommand, *GetvalCommand,
+// *ListvalCommand or *FlushCommand.
+type Command interface {
+	command()
+}
+
+// PutvalCommand is a PUTVAL command. A single command may carry
+// several value sets, each resulting in a value list.
+type PutvalCommand struct {
+	ValueLists []ValueList
+}
+
+// PutnotifCommand is a PUTNOTIF command.
+type PutnotifCommand struct {
+	Notification Notification
+}
+
+// GetvalCommand is a GETVAL command.
+type GetvalCommand struct {
+	Identifier Identifier
+}
+
+// ListvalCommand is a LISTVAL command.
+type ListvalCommand struct{}
+
+// FlushCommand is a FLUSH command.
+type FlushCommand struct {
+	// Timeout is negative if no timeout was given.
+	Timeout     time.Duration
+	Plugins     []string
+	Identifiers []Identifier
+}
+
+func (*PutvalCommand) command()   {}
+func (*PutnotifCommand) command() {}
+func (*GetvalCommand) command()   {}
+func (*ListvalCommand) command()  {}
+func (*FlushCommand) command()    {}
+
+// ParseCommand parses a line of the plain text protocol, without the
+// trailing newline. If types is not nil, PUTVAL values are typed and
+// checked according to it, like collectd does. Otherwise, all values
+// are treated as gauges.
+func ParseCommand(line string, types TypesDB) (Command, error) {
+	fields, err := splitFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("empty command")
+	}
+	args := fields[1:]
+	switch strings.ToUpper(fields[0]) {
+	case "PUTVAL":
+		vls, err := parsePutval(args, types)
+		if err != nil {
+			return nil, err
+		}
+		return &PutvalCommand{ValueLists: vls}, nil
+	case "PUTNOTIF":
+		n, err := parsePutnotif(args)
+		if err != nil {
+			return nil, err
+		}
+		return &PutnotifCommand{Notification: n}, nil
+	case "GETVAL":
+		if len(args) != 1 {
+			return nil, errors.New("GETVAL: expected exactly one identifier")
+		}
+		id, err := ParseIdentifier(args[0])
+		if err != nil {
+			return nil, fmt.Errorf("GETVAL: %s", err)
+		}
+		return &GetvalCommand{Identifier: id}, nil
+	case "LISTVAL":
+		if len(args) != 0 {
+			return nil, errors.New("LISTVAL: unexpected arguments")
+		}
+		return &ListvalCommand{}, nil
+	case "FLUSH":
+		return parseFlush(args)
+	default:
+		return nil, fmt.Errorf("unknown command %q", fields[0])
+	}
+}
+
+func parseFlush(args []string) (*FlushCommand, error) {
+	cmd := &FlushCommand{Timeout: -1}
+	for _, arg := range args {
+		k, v, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, fmt.Errorf("FLUSH: invalid option %q", arg)
+		}
+		switch k {
+		case "timeout":
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("FLUSH: invalid timeout %q", v)
+			}
+			if f >= 0 {
+				cmd.Timeout = time.Duration(f * float64(time.Second))
+			}
+		case "plugin":
+			cmd.Plugins = append(cmd.Plugins, v)
+		case "identifier":
+			id, err := ParseIdentifier(v)
+			if err != nil {
+				return nil, fmt.Errorf("FLUSH: %s", err)
+			}
+			cmd.Identifiers = append(cmd.Identifiers, id)
+		default:
+			return nil, fmt.Errorf("FLUSH: unknown option %q", k)
+		}
+	}
+	return cmd, nil
+}
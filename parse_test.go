@@ -0,0 +1,126 @@
+package collectd
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCommand(t *testing.T) {
+	types := TypesDB{
+		"if_octets": {{Name: "rx", Type: DSTypeDerive, Min: 0, Max: math.NaN()}, {Name: "tx", Type: DSTypeDerive, Min: 0, Max: math.NaN()}},
+		"gauge":     {{Name: "value", Type: DSTypeGauge, Min: math.NaN(), Max: math.NaN()}},
+	}
+	id := Identifier{Host: "example.com", Plugin: "interface", PluginInstance: "eth0", Type: "if_octets"}
+	tests := []struct {
+		line  string
+		types TypesDB
+		want  Command
+		err   string
+	}{
+		{
+			line:  `PUTVAL "example.com/interface-eth0/if_octets" interval=10 1700000000.5:1:2`,
+			types: types,
+			want: &PutvalCommand{ValueLists: []ValueList{{
+				Identifier: id,
+				Time:       time.Unix(1700000000, 5e8),
+				Interval:   10 * time.Second,
+				Values:     []Value{Derive(1), Derive(2)},
+			}}},
+		},
+		{
+			line: `putval example.com/interface-eth0/if_octets N:1:U 1700000000:3:4`,
+			want: &PutvalCommand{ValueLists: []ValueList{
+				{Identifier: id, Values: []Value{Gauge(1), Gauge(math.NaN())}},
+				{Identifier: id, Time: time.Unix(1700000000, 0), Values: []Value{Gauge(3), Gauge(4)}},
+			}},
+		},
+		{line: `PUTVAL example.com/interface-eth0/if_octets N:1`, types: types, err: "2 data sources, got 1 values"},
+		{line: `PUTVAL example.com/interface-eth0/if_octets N:1.5:2`, types: types, err: `invalid derive value "1.5"`},
+		{line: `PUTVAL example.com/cpu/unknown N:1`, types: types, err: `unknown type "unknown"`},
+		{line: `PUTVAL example.com/interface-eth0/if_octets interval=0 N:1`, err: "invalid interval"},
+		{line: `PUTVAL example.com/interface-eth0/if_octets interval=10`, err: "missing values"},
+		{line: `PUTVAL example.com/if_octets N:1`, err: "invalid identifier"},
+		{line: `PUTVAL`, err: "missing identifier or values"},
+		{
+			line: `PUTNOTIF severity=warning time=1700000000 host=example.com plugin=interface plugin_instance=eth0 type=if_octets message="link is \"down\""`,
+			want: &PutnotifCommand{Notification: Notification{
+				Identifier: id,
+				Severity:   SeverityWarning,
+				Time:       time.Unix(1700000000, 0),
+				Message:    `link is "down"`,
+			}},
+		},
+		{line: `PUTNOTIF severity=warning time=N`, err: "missing message"},
+		{line: `PUTNOTIF message=hi`, err: "missing severity"},
+		{line: `PUTNOTIF severity=bad message=hi`, err: "invalid severity"},
+		{line: `PUTNOTIF severity`, err: "invalid option"},
+		{line: `GETVAL "example.com/interface-eth0/if_octets"`, want: &GetvalCommand{Identifier: id}},
+		{line: `GETVAL`, err: "expected exactly one identifier"},
+		{line: `GETVAL a/b/c d/e/f`, err: "expected exactly one identifier"},
+		{line: `GETVAL a/b`, err: "invalid identifier"},
+		{line: `LISTVAL`, want: &ListvalCommand{}},
+		{line: `LISTVAL now`, err: "unexpected arguments"},
+		{line: `FLUSH`, want: &FlushCommand{Timeout: -1}},
+		{
+			line: `FLUSH timeout=1.5 plugin=rrdtool identifier="example.com/interface-eth0/if_octets"`,
+			want: &FlushCommand{Timeout: 1500 * time.Millisecond, Plugins: []string{"rrdtool"}, Identifiers: []Identifier{id}},
+		},
+		{line: `FLUSH timeout=soon`, err: "invalid timeout"},
+		{line: `FLUSH force=true`, err: "unknown option"},
+		{line: `FLUSH identifier=a/b`, err: "invalid identifier"},
+		{line: ``, err: "empty command"},
+		{line: `   `, err: "empty command"},
+		{line: `STOP`, err: "unknown command"},
+		{line: `GETVAL "a/b/c`, err: "unterminated quoted string"},
+		{line: `GETVAL "a/b/c\`, err: "unterminated escape sequence"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got, err := ParseCommand(tt.line, tt.types)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalCommands(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// equalCommands compares commands, treating NaN gauges as equal.
+func equalCommands(a, b Command) bool {
+	pa, ok1 := a.(*PutvalCommand)
+	pb, ok2 := b.(*PutvalCommand)
+	if !ok1 || !ok2 {
+		return reflect.DeepEqual(a, b)
+	}
+	if len(pa.ValueLists) != len(pb.ValueLists) {
+		return false
+	}
+	for i, va := range pa.ValueLists {
+		vb := pb.ValueLists[i]
+		if va.Identifier != vb.Identifier || !va.Time.Equal(vb.Time) || va.Interval != vb.Interval || len(va.Values) != len(vb.Values) {
+			return false
+		}
+		for j, v := range va.Values {
+			g1, ok1 := v.(Gauge)
+			g2, ok2 := vb.Values[j].(Gauge)
+			if ok1 && ok2 && math.IsNaN(float64(g1)) && math.IsNaN(float64(g2)) {
+				continue
+			}
+			if v != vb.Values[j] {
+				return false
+			}
+		}
+	}
+	return true
+}
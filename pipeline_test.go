@@ -0,0 +1,78 @@
+package collectd_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/collectdtest"
+)
+
+// manyValueLists returns n value lists with distinct identifiers.
+func manyValueLists(n int) []collectd.ValueList {
+	vls := make([]collectd.ValueList, n)
+	for i := range vls {
+		vls[i] = collectd.ValueList{
+			Identifier: collectd.Identifier{Host: "example.com", Plugin: "test", Type: "gauge", TypeInstance: fmt.Sprint(i)},
+			Time:       time.Unix(1700000000, 0),
+			Interval:   10 * time.Second,
+			Values:     []collectd.Value{collectd.Gauge(i)},
+		}
+	}
+	return vls
+}
+
+func dial(t *testing.T, srv *collectdtest.Server) *collectd.Conn {
+	t.Helper()
+	c, err := collectd.DialUnix(srv.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestWriteBatchLarge(t *testing.T) {
+	srv := collectdtest.NewServer(nil)
+	defer srv.Close()
+	c := dial(t, srv)
+
+	// Writing all commands before reading any response used to
+	// deadlock once the socket buffers were full.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	vls := manyValueLists(20000)
+	if err := c.WriteBatch(ctx, vls); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(srv.Commands()); got != len(vls) {
+		t.Errorf("server received %d commands, want %d", got, len(vls))
+	}
+}
+
+func TestGetValuesLarge(t *testing.T) {
+	srv := collectdtest.NewServer(nil)
+	defer srv.Close()
+	vls := manyValueLists(20000)
+	srv.Put(vls...)
+	c := dial(t, srv)
+
+	ids := make([]collectd.Identifier, len(vls))
+	for i, vl := range vls {
+		ids[i] = vl.Identifier
+	}
+	got, err := c.GetValues(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(ids) {
+		t.Fatalf("got values of %d identifiers, want %d", len(got), len(ids))
+	}
+	for i, id := range ids {
+		if v := got[id]["value"]; v != float64(i) {
+			t.Errorf("%s: got %v, want %d", id, v, i)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Package prometheus exports collectd values to Prometheus.
+package prometheus // import "honnef.co/go/collectd/prometheus"
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// DefaultInterval is the interval assumed for value lists that have
+// none.
+const DefaultInterval = 10 * time.Second
+
+// Exporter caches collectd values and serves them in Prometheus' text
+// format, like collectd_exporter. Values are received by writing
+// value lists to it, for example from a network.Server, or by polling
+// a unixsock plugin with Poll. Mount it at /metrics to be scraped.
+//
+// Metrics are named collectd_plugin_type_dsname, omitting the type if
+// it equals the plugin and the data source name if it is "value".
+// Derives and counters are exported as counters with a _total suffix,
+// all other values as gauges. The host becomes the instance label,
+// the plugin instance a label named after the plugin, and the type
+// instance the type label.
+//
+// The zero value is ready to use.
+type Exporter struct {
+	// TypesDB provides data source names and types of polled values.
+	// If it is nil, written value lists are named as by
+	// collectd.TypesDB.DSNames.
+	TypesDB collectd.TypesDB
+	// Timeout is how long values are exported after their last
+	// update. Zero means twice their interval.
+	Timeout time.Duration
+	// Logger, if not nil, receives errors of Poll.
+	Logger *slog.Logger
+
+	errs health.ErrorTracker
+
+	mu      sync.Mutex
+	entries map[collectd.Identifier]entry
+}
+
+var (
+	_ collectd.Writer = (*Exporter)(nil)
+	_ http.Handler    = (*Exporter)(nil)
+)
+
+// entry is the most recent state of an identifier.
+type entry struct {
+	names   []string
+	values  []float64
+	counter []bool
+	expires time.Time
+}
+
+func (e *Exporter) expiry(interval time.Duration) time.Time {
+	if e.Timeout > 0 {
+		return time.Now().Add(e.Timeout)
+	}
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return time.Now().Add(2 * interval)
+}
+
+func (e *Exporter) store(id collectd.Identifier, ent entry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.entries == nil {
+		e.entries = map[collectd.Identifier]entry{}
+	}
+	e.entries[id] = ent
+}
+
+// Write caches vl, replacing the previous values of its identifier.
+func (e *Exporter) Write(ctx context.Context, vl collectd.ValueList) error {
+	ent := entry{
+		names:   e.TypesDB.DSNames(vl),
+		values:  make([]float64, len(vl.Values)),
+		counter: make([]bool, len(vl.Values)),
+		expires: e.expiry(vl.Interval),
+	}
+	for i, v := range vl.Values {
+		ent.values[i], ent.counter[i] = metricValue(v)
+	}
+	e.store(vl.Identifier, ent)
+	return nil
+}
+
+// metricValue returns v as a float64, and whether it is exported as a
+// counter.
+func metricValue(v collectd.Value) (float64, bool) {
+	switch v := v.(type) {
+	case collectd.Gauge:
+		return float64(v), false
+	case collectd.Derive:
+		return float64(v), true
+	case collectd.Counter:
+		return float64(v), true
+	case collectd.Absolute:
+		return float64(v), false
+	default:
+		return math.NaN(), false
+	}
+}
+
+// Poll fetches all values from c every interval, using LISTVAL and
+// GETVAL, until ctx is canceled. collectd reports derives and counters
+// as rates, so all polled values are exported as gauges. Errors are
+// logged and reported by Health. Poll returns ctx.Err().
+func (e *Exporter) Poll(ctx context.Context, c *collectd.Conn, interval time.Duration) error {
+	poll := func(ctx context.Context, t time.Time) {
+		if err := e.poll(c, interval); err != nil {
+			e.errs.Track(err)
+			if e.Logger != nil {
+				e.Logger.WarnContext(ctx, "could not poll values", "error", err)
+			}
+		}
+	}
+	return collectd.Schedule{Interval: interval}.Run(ctx, poll)
+}
+
+func (e *Exporter) poll(c *collectd.Conn, interval time.Duration) error {
+	list, err := c.ListIdentifiers()
+	if err != nil {
+		return err
+	}
+	ids := make([]collectd.Identifier, len(list))
+	for i, le := range list {
+		ids[i] = le.Identifier
+	}
+	vals, err := c.GetValues(ids)
+	for id, m := range vals {
+		ent := entry{expires: e.expiry(interval)}
+		if dss, ok := e.TypesDB[id.Type]; ok && len(dss) == len(m) {
+			// Keep the order of types.db.
+			for _, ds := range dss {
+				ent.names = append(ent.names, ds.Name)
+			}
+		} else {
+			for name := range m {
+				ent.names = append(ent.names, name)
+			}
+			sort.Strings(ent.names)
+		}
+		ent.values = make([]float64, len(ent.names))
+		ent.counter = make([]bool, len(ent.names))
+		for i, name := range ent.names {
+			ent.values[i] = m[name]
+		}
+		e.store(id, ent)
+	}
+	return err
+}
+
+// sample is a single line of the exposition format.
+type sample struct {
+	labels string
+	value  float64
+}
+
+// ServeHTTP serves the cached values in Prometheus' text format,
+// dropping values that have expired.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families := map[string][]sample{}
+	counters := map[string]bool{}
+	now := time.Now()
+	e.mu.Lock()
+	for id, ent := range e.entries {
+		if now.After(ent.expires) {
+			delete(e.entries, id)
+			continue
+		}
+		labels := formatLabels(id)
+		for i, name := range ent.names {
+			metric := metricName(id, name, ent.counter[i])
+			if _, ok := counters[metric]; !ok {
+				counters[metric] = ent.counter[i]
+			}
+			families[metric] = append(families[metric], sample{labels, ent.values[i]})
+		}
+	}
+	e.mu.Unlock()
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		typ := "gauge"
+		if counters[name] {
+			typ = "counter"
+		}
+		buf.WriteString("# HELP " + name + " Collectd exporter: " + name + "\n")
+		buf.WriteString("# TYPE " + name + " " + typ + "\n")
+		samples := families[name]
+		sort.Slice(samples, func(i, j int) bool { return samples[i].labels < samples[j].labels })
+		for _, s := range samples {
+			buf.WriteString(name)
+			buf.WriteString(s.labels)
+			buf.WriteByte(' ')
+			buf.WriteString(formatFloat(s.value))
+			buf.WriteByte('\n')
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// Health reports the exporter as healthy and connected, along with the
+// last error of Poll, and the number of cached identifiers as queued.
+func (e *Exporter) Health() collectd.Health {
+	e.mu.Lock()
+	n := len(e.entries)
+	e.mu.Unlock()
+	err, when := e.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     true,
+		Queued:        n,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+// metricName returns the name of the metric of the data source
+// dsName of id.
+func metricName(id collectd.Identifier, dsName string, counter bool) string {
+	name := "collectd_" + id.Plugin
+	if id.Type != id.Plugin {
+		name += "_" + id.Type
+	}
+	if dsName != "value" {
+		name += "_" + dsName
+	}
+	if counter {
+		name += "_total"
+	}
+	return sanitize(name)
+}
+
+// label is a label of a metric.
+type label struct{ name, value string }
+
+// labels returns the labels of id, sorted by name.
+func labels(id collectd.Identifier) []label {
+	ls := []label{{"instance", id.Host}}
+	if id.PluginInstance != "" {
+		ls = append(ls, label{sanitize(id.Plugin), id.PluginInstance})
+	}
+	if id.TypeInstance != "" {
+		ls = append(ls, label{"type", id.TypeInstance})
+	}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].name < ls[j].name })
+	return ls
+}
+
+// formatLabels returns the label set of id, including the braces.
+func formatLabels(id collectd.Identifier) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, l := range labels(id) {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(l.name)
+		b.WriteString(`="`)
+		for _, r := range l.value {
+			switch r {
+			case '\\':
+				b.WriteString(`\\`)
+			case '"':
+				b.WriteString(`\"`)
+			case '\n':
+				b.WriteString(`\n`)
+			default:
+				b.WriteRune(r)
+			}
+		}
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// sanitize replaces characters that are invalid in metric and label
+// names with underscores.
+func sanitize(s string) string {
+	b := []byte(s)
+	for i, ch := range b {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch == '_':
+		case ch >= '0' && ch <= '9' && i > 0:
+		default:
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,148 @@
+package prometheus
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// A Gatherer gathers metric families. It is implemented by the
+// registries of github.com/prometheus/client_golang, including
+// prometheus.DefaultGatherer.
+type Gatherer interface {
+	Gather() ([]*dto.MetricFamily, error)
+}
+
+// Pusher periodically gathers the metrics of a Gatherer and submits
+// them to collectd, so that programs instrumented with client_golang
+// can report to collectd without being scraped.
+//
+// Samples are mapped to value lists like those of Scraper: counters,
+// and the bucket counts and counts of histograms and summaries, become
+// derives, all other samples gauges. The buckets of histograms and the
+// quantiles of summaries become separate type instances, as their
+// upper bound or quantile is a label.
+type Pusher struct {
+	// Gatherer provides the metrics.
+	Gatherer Gatherer
+	// Writer receives the value lists, for example a collectd.Conn
+	// or a network.Client.
+	Writer collectd.Writer
+	// Rules map samples to identifiers.
+	Rules []Rule
+	// Host is the default host of value lists. If it is empty, the
+	// host name is looked up with collectd.Hostname.
+	Host string
+	// Interval is the time between pushes. It defaults to
+	// DefaultInterval.
+	Interval time.Duration
+	// Logger, if not nil, receives gather and write errors.
+	Logger *slog.Logger
+
+	errs health.ErrorTracker
+}
+
+// Run gathers and submits the metrics every interval until ctx is
+// canceled. Run returns ctx.Err().
+func (p *Pusher) Run(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	push := func(ctx context.Context, t time.Time) {
+		vls, err := p.Gather()
+		if err != nil {
+			p.log(ctx, "could not gather metrics", err)
+		}
+		for _, vl := range vls {
+			vl.Time = t
+			vl.Interval = interval
+			if err := p.Writer.Write(ctx, vl); err != nil {
+				p.log(ctx, "could not write value list", err)
+			}
+		}
+	}
+	return collectd.Schedule{Interval: interval}.Run(ctx, push)
+}
+
+// Gather gathers the metrics once and returns them as value lists,
+// with the current time and no interval. Like client_golang, it
+// returns the metrics that could be gathered together with an error.
+func (p *Pusher) Gather() ([]collectd.ValueList, error) {
+	mfs, err := p.Gatherer.Gather()
+	var samples []scrapedSample
+	for _, mf := range mfs {
+		samples = appendFamily(samples, mf)
+	}
+	return mapSamples(samples, defaultHost(p.Host), p.Rules), err
+}
+
+// appendFamily appends the samples of mf, in the form they have in the
+// text format, to samples.
+func appendFamily(samples []scrapedSample, mf *dto.MetricFamily) []scrapedSample {
+	name := mf.GetName()
+	for _, m := range mf.GetMetric() {
+		labels := make([]label, 0, len(m.GetLabel())+1)
+		for _, lp := range m.GetLabel() {
+			labels = append(labels, label{lp.GetName(), lp.GetValue()})
+		}
+		add := func(suffix string, v float64, counter bool, extra ...label) {
+			ls := append(labels[:len(labels):len(labels)], extra...)
+			sort.Slice(ls, func(i, j int) bool { return ls[i].name < ls[j].name })
+			samples = append(samples, scrapedSample{name: name + suffix, labels: ls, value: v, counter: counter})
+		}
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			add("", m.GetCounter().GetValue(), true)
+		case dto.MetricType_GAUGE:
+			add("", m.GetGauge().GetValue(), false)
+		case dto.MetricType_UNTYPED:
+			add("", m.GetUntyped().GetValue(), false)
+		case dto.MetricType_SUMMARY:
+			s := m.GetSummary()
+			for _, q := range s.GetQuantile() {
+				add("", q.GetValue(), false, label{"quantile", formatFloat(q.GetQuantile())})
+			}
+			add("_sum", s.GetSampleSum(), false)
+			add("_count", float64(s.GetSampleCount()), true)
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			h := m.GetHistogram()
+			inf := false
+			for _, b := range h.GetBucket() {
+				inf = inf || math.IsInf(b.GetUpperBound(), 1)
+				add("_bucket", float64(b.GetCumulativeCount()), true, label{"le", formatFloat(b.GetUpperBound())})
+			}
+			if !inf {
+				add("_bucket", float64(h.GetSampleCount()), true, label{"le", "+Inf"})
+			}
+			add("_sum", h.GetSampleSum(), false)
+			add("_count", float64(h.GetSampleCount()), true)
+		}
+	}
+	return samples
+}
+
+// Health reports the pusher as healthy and connected, along with the
+// last gather or write error.
+func (p *Pusher) Health() collectd.Health {
+	err, when := p.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     true,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (p *Pusher) log(ctx context.Context, msg string, err error) {
+	p.errs.Track(err)
+	if p.Logger != nil {
+		p.Logger.WarnContext(ctx, msg, "error", err)
+	}
+}
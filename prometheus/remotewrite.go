@@ -0,0 +1,188 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// RemoteWriter pushes value lists to a Prometheus remote-write
+// endpoint, such as those of Mimir, Thanos or Prometheus itself.
+// Metrics are named and labeled like those of Exporter, except that
+// derives and counters keep their raw values.
+//
+// Every call to Write or WriteBatch sends one request. Wrap a
+// RemoteWriter in a collectd.Batcher to send value lists in batches.
+// Failed requests are not retried.
+type RemoteWriter struct {
+	// URL is the remote-write endpoint.
+	URL string
+	// Client sends requests. If it is nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+	// Header is added to all requests, for example for
+	// authentication or to set a tenant.
+	Header http.Header
+	// TypesDB provides data source names. If it is nil, they are
+	// named as by collectd.TypesDB.DSNames.
+	TypesDB collectd.TypesDB
+
+	errs    health.ErrorTracker
+	failing atomic.Bool
+}
+
+var (
+	_ collectd.Writer      = (*RemoteWriter)(nil)
+	_ collectd.BatchWriter = (*RemoteWriter)(nil)
+)
+
+// StatusError is returned when a remote-write endpoint responds with a
+// status other than 2xx.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	// Message is the beginning of the response body.
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	if e.Message == "" {
+		return "prometheus: server responded with " + e.Status
+	}
+	return "prometheus: server responded with " + e.Status + ": " + e.Message
+}
+
+// Write sends vl.
+func (w *RemoteWriter) Write(ctx context.Context, vl collectd.ValueList) error {
+	return w.WriteBatch(ctx, []collectd.ValueList{vl})
+}
+
+// WriteBatch sends vls in a single request.
+func (w *RemoteWriter) WriteBatch(ctx context.Context, vls []collectd.ValueList) error {
+	err := w.send(ctx, w.encode(vls))
+	w.failing.Store(err != nil)
+	w.errs.Track(err)
+	return err
+}
+
+// series is a time series of a write request.
+type series struct {
+	labels  []label
+	samples []remoteSample
+}
+
+type remoteSample struct {
+	value float64
+	ms    int64
+}
+
+// encode returns the protobuf encoding of a WriteRequest containing
+// vls.
+func (w *RemoteWriter) encode(vls []collectd.ValueList) []byte {
+	byKey := map[string]*series{}
+	var keys []string
+	now := time.Now()
+	for _, vl := range vls {
+		t := vl.Time
+		if t.IsZero() {
+			t = now
+		}
+		ls := labels(vl.Identifier)
+		names := w.TypesDB.DSNames(vl)
+		for i, v := range vl.Values {
+			value, counter := metricValue(v)
+			sls := append([]label{{"__name__", metricName(vl.Identifier, names[i], counter)}}, ls...)
+			sort.Slice(sls, func(i, j int) bool { return sls[i].name < sls[j].name })
+			var key strings.Builder
+			for _, l := range sls {
+				key.WriteString(l.name + "\x00" + l.value + "\x00")
+			}
+			s, ok := byKey[key.String()]
+			if !ok {
+				s = &series{labels: sls}
+				byKey[key.String()] = s
+				keys = append(keys, key.String())
+			}
+			s.samples = append(s.samples, remoteSample{value, t.UnixMilli()})
+		}
+	}
+
+	var req []byte
+	for _, key := range keys {
+		s := byKey[key]
+		sort.SliceStable(s.samples, func(i, j int) bool { return s.samples[i].ms < s.samples[j].ms })
+		var ts []byte
+		for _, l := range s.labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			ts = protowire.AppendTag(ts, 1, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, lb)
+		}
+		for _, smp := range s.samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(smp.value))
+			sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(smp.ms))
+			ts = protowire.AppendTag(ts, 2, protowire.BytesType)
+			ts = protowire.AppendBytes(ts, sb)
+		}
+		req = protowire.AppendTag(req, 1, protowire.BytesType)
+		req = protowire.AppendBytes(req, ts)
+	}
+	return req
+}
+
+func (w *RemoteWriter) send(ctx context.Context, req []byte) error {
+	hr, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(snappy.Encode(nil, req)))
+	if err != nil {
+		return err
+	}
+	for k, vs := range w.Header {
+		hr.Header[k] = vs
+	}
+	hr.Header.Set("Content-Encoding", "snappy")
+	hr.Header.Set("Content-Type", "application/x-protobuf")
+	hr.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	hc := w.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(hr)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode/100 != 2 {
+		return &StatusError{StatusCode: res.StatusCode, Status: res.Status, Message: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+// Health reports the writer as healthy, and as connected unless its
+// last request failed.
+func (w *RemoteWriter) Health() collectd.Health {
+	err, when := w.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     !w.failing.Load(),
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
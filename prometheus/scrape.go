@@ -0,0 +1,383 @@
+package prometheus
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// A Rule maps scraped samples to collectd identifiers.
+//
+// The identifier fields are templates in which {name} is replaced
+// by the value of the sample's label name, {__name__} by the metric
+// name, and {1}, {2} and so on by the submatches of Metric. Empty
+// fields keep the values of the default mapping.
+type Rule struct {
+	// Metric matches the names of the metrics the rule applies to.
+	// If it is nil, the rule applies to all metrics.
+	Metric *regexp.Regexp
+	// Drop discards matching samples.
+	Drop bool
+	// Scale multiplies the values of counters before they are
+	// rounded to derives, so that fractional counters keep their
+	// precision. For example, a Scale of 1e6 turns
+	// process_cpu_seconds_total into microseconds, the unit of
+	// ps_cputime. Zero means 1.
+	Scale float64
+
+	Host           string
+	Plugin         string
+	PluginInstance string
+	Type           string
+	TypeInstance   string
+}
+
+// Scraper scrapes Prometheus endpoints and submits their samples to
+// collectd, so that collectd can remain the only way values leave a
+// host. Both Prometheus' text format and OpenMetrics are supported.
+//
+// By default, a sample becomes a value list of plugin "prometheus"
+// with the metric name and its label values, separated by
+// underscores, as type instance; slashes are replaced by underscores.
+// Samples of counters, and the buckets and counts of histograms and
+// summaries, become derives of type "derive"; all others become gauges
+// of type "gauge". As derives are integers, counters are rounded,
+// which makes the rates of fractional counters, such as
+// process_cpu_seconds_total, coarse; use a Rule's Scale to preserve
+// their precision. The first Rule whose Metric matches changes this
+// mapping.
+type Scraper struct {
+	// Targets are the URLs to scrape.
+	Targets []string
+	// Writer receives the value lists, for example a collectd.Conn
+	// or a network.Client.
+	Writer collectd.Writer
+	// Rules map samples to identifiers.
+	Rules []Rule
+	// Host is the default host of value lists. If it is empty, the
+	// host name is looked up with collectd.Hostname.
+	Host string
+	// Interval is the time between scrapes. It defaults to
+	// DefaultInterval.
+	Interval time.Duration
+	// Client sends requests. If it is nil, http.DefaultClient is
+	// used.
+	Client *http.Client
+	// Logger, if not nil, receives scrape and write errors.
+	Logger *slog.Logger
+
+	errs health.ErrorTracker
+}
+
+// Run scrapes all targets every interval until ctx is canceled. Run
+// returns ctx.Err().
+func (s *Scraper) Run(ctx context.Context) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	scrape := func(ctx context.Context, t time.Time) {
+		for _, target := range s.Targets {
+			vls, err := s.Scrape(ctx, target)
+			if err != nil {
+				s.log(ctx, "could not scrape target", err, target)
+			}
+			for _, vl := range vls {
+				vl.Time = t
+				vl.Interval = interval
+				if err := s.Writer.Write(ctx, vl); err != nil {
+					s.log(ctx, "could not write value list", err, target)
+				}
+			}
+		}
+	}
+	return collectd.Schedule{Interval: interval}.Run(ctx, scrape)
+}
+
+// Scrape scrapes target once and returns its samples as value lists,
+// with the current time and no interval.
+func (s *Scraper) Scrape(ctx context.Context, target string) ([]collectd.ValueList, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/openmetrics-text;version=1.0.0,text/plain;version=0.0.4;q=0.5")
+	hc := s.Client
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return nil, &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+	samples, err := parseText(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("prometheus: %s: %s", target, err)
+	}
+	return mapSamples(samples, defaultHost(s.Host), s.Rules), nil
+}
+
+// defaultHost returns host, or if it is empty, the host name.
+func defaultHost(host string) string {
+	if host != "" {
+		return host
+	}
+	host, err := collectd.Hostname(false)
+	if err != nil {
+		return "localhost"
+	}
+	return host
+}
+
+// mapSamples maps samples to value lists with the current time,
+// according to rules.
+func mapSamples(samples []scrapedSample, host string, rules []Rule) []collectd.ValueList {
+	now := time.Now()
+	vls := make([]collectd.ValueList, 0, len(samples))
+	for _, smp := range samples {
+		vl, ok := mapSample(smp, host, rules)
+		if ok {
+			vl.Time = now
+			vls = append(vls, vl)
+		}
+	}
+	return vls
+}
+
+func mapSample(smp scrapedSample, host string, rules []Rule) (collectd.ValueList, bool) {
+	parts := []string{smp.name}
+	for _, l := range smp.labels {
+		parts = append(parts, l.value)
+	}
+	vl := collectd.ValueList{
+		Identifier: collectd.Identifier{
+			Host:         host,
+			Plugin:       "prometheus",
+			Type:         "gauge",
+			TypeInstance: strings.ReplaceAll(strings.Join(parts, "_"), "/", "_"),
+		},
+	}
+	if smp.counter {
+		vl.Type = "derive"
+	}
+	scale := 1.0
+	for _, r := range rules {
+		var m []string
+		if r.Metric != nil {
+			if m = r.Metric.FindStringSubmatch(smp.name); m == nil {
+				continue
+			}
+		}
+		if r.Drop {
+			return collectd.ValueList{}, false
+		}
+		if r.Scale != 0 {
+			scale = r.Scale
+		}
+		for _, f := range [...]struct {
+			dst  *string
+			tmpl string
+		}{
+			{&vl.Host, r.Host},
+			{&vl.Plugin, r.Plugin},
+			{&vl.PluginInstance, r.PluginInstance},
+			{&vl.Type, r.Type},
+			{&vl.TypeInstance, r.TypeInstance},
+		} {
+			if f.tmpl != "" {
+				*f.dst = expand(f.tmpl, smp, m)
+			}
+		}
+		break
+	}
+	if smp.counter {
+		vl.Values = []collectd.Value{collectd.Derive(math.Round(smp.value * scale))}
+	} else {
+		vl.Values = []collectd.Value{collectd.Gauge(smp.value)}
+	}
+	return vl, true
+}
+
+var placeholder = regexp.MustCompile(`\{[^{}]+\}`)
+
+// expand expands the placeholders of a Rule template.
+func expand(tmpl string, smp scrapedSample, submatches []string) string {
+	return placeholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		key := p[1 : len(p)-1]
+		if key == "__name__" {
+			return smp.name
+		}
+		if n, err := strconv.Atoi(key); err == nil {
+			if n < len(submatches) {
+				return submatches[n]
+			}
+			return ""
+		}
+		for _, l := range smp.labels {
+			if l.name == key {
+				return l.value
+			}
+		}
+		return ""
+	})
+}
+
+// Health reports the scraper as healthy and connected, along with the
+// last scrape or write error.
+func (s *Scraper) Health() collectd.Health {
+	err, when := s.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     true,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (s *Scraper) log(ctx context.Context, msg string, err error, target string) {
+	s.errs.Track(err)
+	if s.Logger != nil {
+		s.Logger.WarnContext(ctx, msg, "error", err, "target", target)
+	}
+}
+
+// scrapedSample is a sample of a scraped metric. Its labels are
+// sorted by name.
+type scrapedSample struct {
+	name    string
+	labels  []label
+	value   float64
+	counter bool
+}
+
+// parseText parses Prometheus' text format or OpenMetrics, ignoring
+// timestamps.
+func parseText(r io.Reader) ([]scrapedSample, error) {
+	types := map[string]string{}
+	var samples []scrapedSample
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			if f := strings.Fields(line); len(f) == 4 && f[1] == "TYPE" {
+				types[f[2]] = f[3]
+			}
+			continue
+		}
+		smp, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		smp.counter = isCounter(types, smp.name)
+		samples = append(samples, smp)
+	}
+	return samples, sc.Err()
+}
+
+// isCounter reports whether the sample name belongs to a counter, or
+// is the bucket or count of a histogram or summary.
+func isCounter(types map[string]string, name string) bool {
+	if types[name] == "counter" {
+		return true
+	}
+	for _, suffix := range []string{"_total", "_bucket", "_count"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		switch types[family] {
+		case "counter":
+			return suffix == "_total"
+		case "histogram", "gaugehistogram", "summary":
+			return suffix != "_total"
+		}
+	}
+	return false
+}
+
+func parseSample(line string) (scrapedSample, error) {
+	var smp scrapedSample
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return smp, errors.New("missing value")
+	}
+	smp.name = line[:i]
+	rest := line[i:]
+	if rest[0] == '{' {
+		var err error
+		if smp.labels, rest, err = parseLabels(rest[1:]); err != nil {
+			return smp, err
+		}
+		sort.Slice(smp.labels, func(i, j int) bool { return smp.labels[i].name < smp.labels[j].name })
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return smp, errors.New("missing value")
+	}
+	v, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return smp, fmt.Errorf("invalid value %q", fields[0])
+	}
+	smp.value = v
+	return smp, nil
+}
+
+// parseLabels parses labels up to and including the closing brace,
+// returning the rest of the line.
+func parseLabels(s string) ([]label, string, error) {
+	var ls []label
+	for {
+		s = strings.TrimLeft(s, " \t,")
+		if s == "" {
+			return nil, "", errors.New("unterminated label set")
+		}
+		if s[0] == '}' {
+			return ls, s[1:], nil
+		}
+		name, rest, ok := strings.Cut(s, "=")
+		if !ok || len(rest) == 0 || rest[0] != '"' {
+			return nil, "", errors.New("malformed label")
+		}
+		var value strings.Builder
+		i := 1
+		for ; i < len(rest) && rest[i] != '"'; i++ {
+			ch := rest[i]
+			if ch == '\\' && i+1 < len(rest) {
+				i++
+				switch rest[i] {
+				case 'n':
+					ch = '\n'
+				default:
+					ch = rest[i]
+				}
+			}
+			value.WriteByte(ch)
+		}
+		if i == len(rest) {
+			return nil, "", errors.New("unterminated label value")
+		}
+		ls = append(ls, label{strings.TrimSpace(name), value.String()})
+		s = rest[i+1:]
+	}
+}
@@ -0,0 +1,159 @@
+package collectd
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateCache converts values to per-second rates the way collectd's
+// value cache does for plugins with the StoreRates option, remembering
+// the previous values of each identifier. Gauges are returned as they
+// are. The zero value is ready to use.
+type RateCache struct {
+	// TypesDB, if not nil, provides the allowed range of data
+	// sources. Like in collectd, rates outside of it are NaN.
+	TypesDB TypesDB
+
+	mu        sync.Mutex
+	entries   map[Identifier]rateEntry
+	lastSweep time.Time
+}
+
+type rateEntry struct {
+	time    time.Time
+	values  []Value
+	expires time.Time
+}
+
+// Like collectd, forget identifiers that haven't been updated for
+// rateCacheTimeout intervals, so that rates aren't computed across
+// long gaps.
+const rateCacheTimeout = 2
+
+// Rates returns the rates of vl's values. For the first value list of
+// an identifier, and when the number or types of values change, the
+// rates of all values but gauges are NaN. Like collectd, Rates
+// returns an error for value lists that are not newer than the
+// previous one with the same identifier. A zero time means now.
+func (c *RateCache) Rates(vl ValueList) ([]float64, error) {
+	now := time.Now()
+	if vl.Time.IsZero() {
+		vl.Time = now
+	}
+	interval := vl.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[Identifier]rateEntry{}
+	}
+	if now.Sub(c.lastSweep) > time.Minute {
+		for id, e := range c.entries {
+			if now.After(e.expires) {
+				delete(c.entries, id)
+			}
+		}
+		c.lastSweep = now
+	}
+	prev, ok := c.entries[vl.Identifier]
+	if ok && now.After(prev.expires) {
+		ok = false
+	}
+	if ok && !vl.Time.After(prev.time) {
+		return nil, fmt.Errorf("value too old: name = %s; value time = %s; last cache update = %s",
+			vl.Identifier, formatTime(vl.Time, 3), formatTime(prev.time, 3))
+	}
+	if ok && !sameDSTypes(prev.values, vl.Values) {
+		ok = false
+	}
+	c.entries[vl.Identifier] = rateEntry{
+		time:    vl.Time,
+		values:  append([]Value(nil), vl.Values...),
+		expires: now.Add(rateCacheTimeout * interval),
+	}
+
+	dss := c.TypesDB[vl.Type]
+	if len(dss) != len(vl.Values) {
+		dss = nil
+	}
+	secs := vl.Time.Sub(prev.time).Seconds()
+	rates := make([]float64, len(vl.Values))
+	for i, v := range vl.Values {
+		if g, isGauge := v.(Gauge); isGauge {
+			rates[i] = float64(g)
+		} else if !ok {
+			rates[i] = math.NaN()
+		} else {
+			rates[i] = rate(prev.values[i], v, secs)
+		}
+		if dss != nil && (rates[i] < dss[i].Min || rates[i] > dss[i].Max) {
+			rates[i] = math.NaN()
+		}
+	}
+	return rates, nil
+}
+
+func rate(prev, cur Value, secs float64) float64 {
+	switch cur := cur.(type) {
+	case Derive:
+		return float64(cur-prev.(Derive)) / secs
+	case Counter:
+		return float64(counterDiff(prev.(Counter), cur)) / secs
+	case Absolute:
+		return float64(cur) / secs
+	default:
+		return math.NaN()
+	}
+}
+
+// counterDiff returns the increase of a counter from old to cur. Like
+// collectd, a counter that decreased is assumed to have wrapped
+// around, at 32 bits if its old value fits into 32 bits and at 64
+// bits otherwise.
+func counterDiff(old, cur Counter) Counter {
+	if old <= cur {
+		return cur - old
+	}
+	if old <= math.MaxUint32 {
+		return math.MaxUint32 - old + cur + 1
+	}
+	return math.MaxUint64 - old + cur + 1
+}
+
+func sameDSTypes(a, b []Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].DSType() != b[i].DSType() {
+			return false
+		}
+	}
+	return true
+}
+
+// Convert returns vl with its values replaced by gauges of their
+// rates. See Rates.
+func (c *RateCache) Convert(vl ValueList) (ValueList, error) {
+	rates, err := c.Rates(vl)
+	if err != nil {
+		return ValueList{}, err
+	}
+	values := make([]Value, len(rates))
+	for i, r := range rates {
+		values[i] = Gauge(r)
+	}
+	vl.Values = values
+	return vl, nil
+}
+
+// Len returns the number of identifiers in the cache.
+func (c *RateCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
@@ -0,0 +1,119 @@
+package collectd
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCounterDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, cur Counter
+		want     Counter
+	}{
+		{"increase", 100, 150, 50},
+		{"unchanged", 100, 100, 0},
+		{"32-bit wrap", math.MaxUint32 - 9, 10, 20},
+		{"32-bit wrap to zero", math.MaxUint32, 0, 1},
+		{"64-bit wrap", math.MaxUint64 - 9, 10, 20},
+		{"64-bit wrap just above 32 bits", math.MaxUint32 + 1, 0, math.MaxUint64 - math.MaxUint32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := counterDiff(tt.old, tt.cur); got != tt.want {
+				t.Errorf("counterDiff(%d, %d) = %d, want %d", tt.old, tt.cur, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateCacheRates(t *testing.T) {
+	base := time.Now().Add(-time.Minute).Truncate(time.Second)
+	id := Identifier{Host: "example.com", Plugin: "interface", PluginInstance: "eth0", Type: "if_octets"}
+	type sample struct {
+		offset time.Duration
+		values []Value
+		want   []float64
+		err    string
+	}
+	nan := math.NaN()
+	tests := []struct {
+		name    string
+		samples []sample
+	}{
+		{"first sample", []sample{
+			{0, []Value{Counter(10), Derive(5), Absolute(20), Gauge(1.5)}, []float64{nan, nan, nan, 1.5}, ""},
+		}},
+		{"rates", []sample{
+			{0, []Value{Counter(10), Derive(5), Absolute(20)}, []float64{nan, nan, nan}, ""},
+			{10 * time.Second, []Value{Counter(110), Derive(-15), Absolute(20)}, []float64{10, -2, 2}, ""},
+		}},
+		{"32-bit counter wrap", []sample{
+			{0, []Value{Counter(math.MaxUint32 - 9)}, []float64{nan}, ""},
+			{10 * time.Second, []Value{Counter(90)}, []float64{10}, ""},
+		}},
+		{"64-bit counter wrap", []sample{
+			{0, []Value{Counter(math.MaxUint64 - 9)}, []float64{nan}, ""},
+			{10 * time.Second, []Value{Counter(90)}, []float64{10}, ""},
+		}},
+		{"DS types change", []sample{
+			{0, []Value{Counter(10)}, []float64{nan}, ""},
+			{10 * time.Second, []Value{Derive(110)}, []float64{nan}, ""},
+			{20 * time.Second, []Value{Derive(210)}, []float64{10}, ""},
+		}},
+		{"number of values changes", []sample{
+			{0, []Value{Derive(10)}, []float64{nan}, ""},
+			{10 * time.Second, []Value{Derive(110), Derive(0)}, []float64{nan, nan}, ""},
+		}},
+		{"value too old", []sample{
+			{10 * time.Second, []Value{Derive(10)}, []float64{nan}, ""},
+			{10 * time.Second, []Value{Derive(20)}, nil, "value too old"},
+			{5 * time.Second, []Value{Derive(20)}, nil, "value too old"},
+			// Rejected values don't replace the previous one.
+			{20 * time.Second, []Value{Derive(110)}, []float64{10}, ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c RateCache
+			for i, s := range tt.samples {
+				vl := ValueList{Identifier: id, Time: base.Add(s.offset), Interval: 10 * time.Second, Values: s.values}
+				got, err := c.Rates(vl)
+				if s.err != "" {
+					if err == nil || !strings.Contains(err.Error(), s.err) {
+						t.Fatalf("sample %d: got error %v, want %q", i, err, s.err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("sample %d: %s", i, err)
+				}
+				if len(got) != len(s.want) {
+					t.Fatalf("sample %d: got %v, want %v", i, got, s.want)
+				}
+				for j := range got {
+					if got[j] != s.want[j] && !(math.IsNaN(got[j]) && math.IsNaN(s.want[j])) {
+						t.Errorf("sample %d: got %v, want %v", i, got, s.want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRateCacheRange(t *testing.T) {
+	c := RateCache{TypesDB: TypesDB{"derive": {{Name: "value", Type: DSTypeDerive, Min: 0, Max: math.NaN()}}}}
+	id := Identifier{Host: "example.com", Plugin: "test", Type: "derive"}
+	base := time.Now().Add(-time.Minute)
+	c.Rates(ValueList{Identifier: id, Time: base, Values: []Value{Derive(100)}})
+	got, err := c.Rates(ValueList{Identifier: id, Time: base.Add(10 * time.Second), Values: []Value{Derive(0)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !math.IsNaN(got[0]) {
+		t.Errorf("got rate %v below the minimum, want NaN", got[0])
+	}
+}
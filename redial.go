@@ -0,0 +1,83 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Redialer is a Writer that establishes a new connection whenever the
+// previous one failed, for example because collectd was restarted.
+type Redialer struct {
+	// Dial opens a new connection, e.g. by calling DialUnix.
+	Dial func() (*Conn, error)
+
+	mu   sync.Mutex
+	conn *Conn
+}
+
+var (
+	_ Writer             = (*Redialer)(nil)
+	_ NotificationWriter = (*Redialer)(nil)
+	_ BatchWriter        = (*Redialer)(nil)
+)
+
+func (r *Redialer) do(fn func(c *Conn) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		c, err := r.Dial()
+		if err != nil {
+			return err
+		}
+		r.conn = c
+	}
+	err := fn(r.conn)
+	var ioErr IOError
+	if errors.As(err, &ioErr) {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return err
+}
+
+// Write writes vl to the current connection, dialing one if
+// necessary.
+func (r *Redialer) Write(ctx context.Context, vl ValueList) error {
+	return r.do(func(c *Conn) error { return c.Write(ctx, vl) })
+}
+
+// WriteBatch writes vls to the current connection, dialing one if
+// necessary.
+func (r *Redialer) WriteBatch(ctx context.Context, vls []ValueList) error {
+	return r.do(func(c *Conn) error { return c.WriteBatch(ctx, vls) })
+}
+
+// WriteNotification writes n to the current connection, dialing one
+// if necessary.
+func (r *Redialer) WriteNotification(ctx context.Context, n Notification) error {
+	return r.do(func(c *Conn) error { return c.WriteNotification(ctx, n) })
+}
+
+// Health reports the health of the current connection. Without a
+// connection, the Redialer is healthy but not connected.
+func (r *Redialer) Health() Health {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return Health{Healthy: true}
+	}
+	return r.conn.Health()
+}
+
+// Close closes the current connection, if any.
+func (r *Redialer) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil
+	}
+	err := r.conn.Close()
+	r.conn = nil
+	return err
+}
@@ -0,0 +1,253 @@
+// Package riemann converts collectd values and notifications to
+// Riemann events, mapping their fields like collectd's write_riemann
+// plugin, and encodes them in Riemann's protocol buffer format.
+package riemann // import "honnef.co/go/collectd/riemann"
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"honnef.co/go/collectd"
+)
+
+var _ collectd.Encoder = (*Converter)(nil)
+
+// Event is a Riemann event.
+type Event struct {
+	// Time has second resolution. The zero time is not encoded,
+	// letting Riemann use the time it receives the event.
+	Time        time.Time
+	State       string
+	Service     string
+	Host        string
+	Description string
+	Tags        []string
+	// TTL is the number of seconds the event is valid for. Zero
+	// means Riemann's default.
+	TTL        float32
+	Attributes []Attribute
+	// Metric is nil, an int64 or a float64.
+	Metric any
+}
+
+// Attribute is a custom field of an event.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Converter converts value lists and notifications to events. Its
+// fields correspond to write_riemann's options of similar names. The
+// zero value converts like write_riemann's defaults, except for
+// TTLFactor.
+type Converter struct {
+	// Prefix is prepended to services, as by EventServicePrefix.
+	Prefix string
+	// AlwaysAppendDS appends the data source name to the services
+	// of types with a single data source.
+	AlwaysAppendDS bool
+	// TTLFactor is multiplied with the interval of value lists to
+	// obtain the TTL of their events. Zero omits the TTL; set it to
+	// 2 for write_riemann's default.
+	TTLFactor float64
+	// Tags are added to all events.
+	Tags []string
+	// Attributes are added to all events.
+	Attributes []Attribute
+	// TypesDB provides data source names. If it is nil, they are
+	// named as by collectd.TypesDB.DSNames.
+	TypesDB collectd.TypesDB
+}
+
+// service returns the service of id, plugin-pi/type-ti, with the
+// data source name appended if it isn't empty.
+func (c *Converter) service(id collectd.Identifier, dsName string) string {
+	id.Host = ""
+	s := c.Prefix + id.String()[1:]
+	if dsName != "" {
+		s += "/" + dsName
+	}
+	return s
+}
+
+func (c *Converter) addCustom(e *Event) {
+	e.Attributes = append(e.Attributes, c.Attributes...)
+	e.Tags = append(e.Tags, c.Tags...)
+}
+
+// ValueList returns one event per value of vl. Gauges become double
+// metrics and other values integer metrics. String metadata is added
+// as attributes.
+func (c *Converter) ValueList(vl collectd.ValueList) []Event {
+	t := vl.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	names := c.TypesDB.DSNames(vl)
+	var meta []Attribute
+	for k, v := range vl.Meta {
+		if s, ok := v.(string); ok {
+			meta = append(meta, Attribute{k, s})
+		}
+	}
+	sort.Slice(meta, func(i, j int) bool { return meta[i].Key < meta[j].Key })
+	events := make([]Event, len(vl.Values))
+	for i, v := range vl.Values {
+		e := Event{
+			Time: t,
+			Host: vl.Host,
+			Attributes: []Attribute{
+				{"plugin", vl.Plugin},
+			},
+		}
+		if c.TTLFactor != 0 {
+			e.TTL = float32(vl.Interval.Seconds() * c.TTLFactor)
+		}
+		if vl.PluginInstance != "" {
+			e.Attributes = append(e.Attributes, Attribute{"plugin_instance", vl.PluginInstance})
+		}
+		e.Attributes = append(e.Attributes, Attribute{"type", vl.Type})
+		if vl.TypeInstance != "" {
+			e.Attributes = append(e.Attributes, Attribute{"type_instance", vl.TypeInstance})
+		}
+		e.Attributes = append(e.Attributes,
+			Attribute{"ds_type", v.DSType().String()},
+			Attribute{"ds_name", names[i]},
+			Attribute{"ds_index", strconv.Itoa(i)},
+		)
+		e.Attributes = append(e.Attributes, meta...)
+		c.addCustom(&e)
+		switch v := v.(type) {
+		case collectd.Gauge:
+			e.Metric = float64(v)
+		case collectd.Derive:
+			e.Metric = int64(v)
+		case collectd.Counter:
+			e.Metric = int64(v)
+		case collectd.Absolute:
+			e.Metric = int64(v)
+		}
+		dsName := ""
+		if c.AlwaysAppendDS || len(vl.Values) > 1 {
+			dsName = names[i]
+		}
+		e.Service = c.service(vl.Identifier, dsName)
+		events[i] = e
+	}
+	return events
+}
+
+// Notification returns the event of n. Its state is "ok", "warning"
+// or "critical", it is tagged "notification", and the message is
+// stored in the "description" attribute.
+func (c *Converter) Notification(n collectd.Notification) Event {
+	t := n.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	e := Event{
+		Time:    t,
+		Host:    n.Host,
+		Tags:    []string{"notification"},
+		Service: c.service(n.Identifier, ""),
+	}
+	switch n.Severity {
+	case collectd.SeverityOkay:
+		e.State = "ok"
+	case collectd.SeverityWarning:
+		e.State = "warning"
+	case collectd.SeverityFailure:
+		e.State = "critical"
+	default:
+		e.State = "unknown"
+	}
+	for _, a := range [...]Attribute{
+		{"host", n.Host},
+		{"plugin", n.Plugin},
+		{"plugin_instance", n.PluginInstance},
+		{"type", n.Type},
+		{"type_instance", n.TypeInstance},
+	} {
+		if a.Value != "" {
+			e.Attributes = append(e.Attributes, a)
+		}
+	}
+	c.addCustom(&e)
+	if n.Message != "" {
+		e.Attributes = append(e.Attributes, Attribute{"description", n.Message})
+	}
+	return e
+}
+
+// Encode appends a message containing the events of vl to dst, for
+// use with collectd.EncodingWriter. Riemann's TCP transport
+// additionally requires the message to be prefixed with its length,
+// which AppendFrame does.
+func (c *Converter) Encode(dst []byte, vl collectd.ValueList) ([]byte, error) {
+	return AppendMsg(dst, c.ValueList(vl)), nil
+}
+
+// AppendMsg appends a Riemann message carrying events to dst.
+func AppendMsg(dst []byte, events []Event) []byte {
+	for _, e := range events {
+		dst = protowire.AppendTag(dst, 6, protowire.BytesType)
+		dst = protowire.AppendBytes(dst, appendEvent(nil, e))
+	}
+	return dst
+}
+
+// AppendFrame appends a Riemann message carrying events to dst,
+// prefixed with its length as required by Riemann's TCP transport.
+func AppendFrame(dst []byte, events []Event) []byte {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	dst = AppendMsg(dst, events)
+	binary.BigEndian.PutUint32(dst[start:], uint32(len(dst)-start-4))
+	return dst
+}
+
+func appendEvent(b []byte, e Event) []byte {
+	if !e.Time.IsZero() {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(e.Time.Unix()))
+	}
+	for _, f := range [...]struct {
+		num protowire.Number
+		s   string
+	}{{2, e.State}, {3, e.Service}, {4, e.Host}, {5, e.Description}} {
+		if f.s != "" {
+			b = protowire.AppendTag(b, f.num, protowire.BytesType)
+			b = protowire.AppendString(b, f.s)
+		}
+	}
+	for _, tag := range e.Tags {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendString(b, tag)
+	}
+	if e.TTL != 0 {
+		b = protowire.AppendTag(b, 8, protowire.Fixed32Type)
+		b = protowire.AppendFixed32(b, math.Float32bits(e.TTL))
+	}
+	for _, a := range e.Attributes {
+		var ab []byte
+		ab = protowire.AppendTag(ab, 1, protowire.BytesType)
+		ab = protowire.AppendString(ab, a.Key)
+		ab = protowire.AppendTag(ab, 2, protowire.BytesType)
+		ab = protowire.AppendString(ab, a.Value)
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, ab)
+	}
+	switch m := e.Metric.(type) {
+	case int64:
+		b = protowire.AppendTag(b, 13, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(m))
+	case float64:
+		b = protowire.AppendTag(b, 14, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m))
+	}
+	return b
+}
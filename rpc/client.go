@@ -0,0 +1,207 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+	"honnef.co/go/collectd/rpc/pb"
+)
+
+// A ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithDialOptions passes opts to grpc.NewClient, after the client's
+// own options, which they override.
+func WithDialOptions(opts ...grpc.DialOption) ClientOption {
+	return func(c *Client) {
+		c.dialOpts = append(c.dialOpts, opts...)
+	}
+}
+
+// WithTLS secures the connection with TLS, using cfg, which may be
+// created with TLSFiles.ClientConfig.
+func WithTLS(cfg *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tls = cfg
+	}
+}
+
+// Client sends value lists to collectd's grpc plugin and queries its
+// cache.
+type Client struct {
+	dialOpts []grpc.DialOption
+	tls      *tls.Config
+
+	conn   *grpc.ClientConn
+	client pb.CollectdClient
+
+	errs   health.ErrorTracker
+	failed atomic.Bool
+}
+
+var (
+	_ collectd.Writer      = (*Client)(nil)
+	_ collectd.BatchWriter = (*Client)(nil)
+)
+
+// Dial returns a Client for the grpc plugin listening on address. If
+// address has no port, the grpc plugin's default port is used. The
+// connection is established lazily, and is not encrypted unless
+// WithTLS is used.
+func Dial(address string, opts ...ClientOption) (*Client, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, DefaultPort)
+	}
+	c := &Client{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	creds := insecure.NewCredentials()
+	if c.tls != nil {
+		creds = credentials.NewTLS(c.tls)
+	}
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, c.dialOpts...)
+	conn, err := grpc.NewClient(address, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.client = pb.NewCollectdClient(conn)
+	return c, nil
+}
+
+// NewClient returns a Client that uses an existing connection. Closing
+// the client doesn't close cc.
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{client: pb.NewCollectdClient(cc)}
+}
+
+// Write sends vl to collectd.
+func (c *Client) Write(ctx context.Context, vl collectd.ValueList) error {
+	return c.WriteBatch(ctx, []collectd.ValueList{vl})
+}
+
+// WriteBatch sends vls to collectd in a single DispatchValues stream.
+// collectd aborts the stream at the first value list it can't
+// dispatch, so the value lists before it have been dispatched when
+// WriteBatch returns an error.
+func (c *Client) WriteBatch(ctx context.Context, vls []collectd.ValueList) error {
+	err := c.dispatch(ctx, vls)
+	c.errs.Track(err)
+	c.failed.Store(err != nil)
+	return err
+}
+
+func (c *Client) dispatch(ctx context.Context, vls []collectd.ValueList) error {
+	reqs := make([]*pb.DispatchValuesRequest, len(vls))
+	for i, vl := range vls {
+		pvl, err := MarshalValueList(vl)
+		if err != nil {
+			return fmt.Errorf("value list %d: %w", i, err)
+		}
+		reqs[i] = &pb.DispatchValuesRequest{ValueList: pvl}
+	}
+	stream, err := c.client.DispatchValues(ctx)
+	if err != nil {
+		return err
+	}
+	for _, req := range reqs {
+		// Send returns io.EOF if the server ended the stream, and
+		// CloseAndRecv returns the actual error.
+		if err := stream.Send(req); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// QueryValues returns the value lists in collectd's cache whose
+// identifiers match pattern. Each field of pattern is a shell
+// wildcard pattern, as used by fnmatch(3); use "*" to match any value.
+// The value lists are streamed as the iterator advances.
+func (c *Client) QueryValues(ctx context.Context, pattern collectd.Identifier) *QueryIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	it := &QueryIterator{cancel: cancel}
+	it.stream, it.err = c.client.QueryValues(ctx, &pb.QueryValuesRequest{Identifier: MarshalIdentifier(pattern)})
+	return it
+}
+
+// QueryIterator iterates over the results of QueryValues.
+type QueryIterator struct {
+	stream grpc.ServerStreamingClient[pb.QueryValuesResponse]
+	cancel context.CancelFunc
+	vl     collectd.ValueList
+	err    error
+	done   bool
+}
+
+// Next advances to the next value list. It returns false when there
+// are no more value lists or an error occurred.
+func (it *QueryIterator) Next() bool {
+	if it.done || it.err != nil {
+		it.Close()
+		return false
+	}
+	res, err := it.stream.Recv()
+	if err == nil {
+		it.vl, err = UnmarshalValueList(res.ValueList)
+	}
+	if err != nil {
+		if err != io.EOF {
+			it.err = err
+		}
+		it.Close()
+		return false
+	}
+	return true
+}
+
+// ValueList returns the current value list.
+func (it *QueryIterator) ValueList() collectd.ValueList {
+	return it.vl
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *QueryIterator) Err() error {
+	return it.err
+}
+
+// Close ends the query early. It is not necessary to call Close after
+// Next returned false.
+func (it *QueryIterator) Close() {
+	it.done = true
+	it.cancel()
+}
+
+// Health reports the client as connected if the most recent
+// submission succeeded.
+func (c *Client) Health() collectd.Health {
+	err, when := c.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     !c.failed.Load(),
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+// Close closes the connection, unless the client was created with
+// NewClient.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
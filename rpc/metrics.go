@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"honnef.co/go/collectd/collector"
+)
+
+// Metrics records the RPCs of a gRPC server in a collector.Registry,
+// using interceptors. For a method such as /pkg.Service/Method, named
+// pkg.Service.Method in identifiers, the number of RPCs is a counter
+// of type "total_requests" and type instance the method's name, the
+// number of RPCs per status code one with type instances such as
+// "pkg.Service.Method-OK", and the latency of RPCs a histogram of type
+// "response_time". The latency of streaming RPCs is the duration of
+// the whole stream.
+type Metrics struct {
+	Registry *collector.Registry
+	// Latency configures the latency histograms. If it has neither
+	// buckets nor quantiles, collector.DefaultLatency is used.
+	Latency collector.HistogramOpts
+}
+
+// UnaryServerInterceptor returns an interceptor that records unary
+// RPCs. Pass it to grpc.NewServer with grpc.ChainUnaryInterceptor.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+		m.record(info.FullMethod, start, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor returns an interceptor that records
+// streaming RPCs. Pass it to grpc.NewServer with
+// grpc.ChainStreamInterceptor.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		m.record(info.FullMethod, start, err)
+		return err
+	}
+}
+
+func (m *Metrics) record(fullMethod string, start time.Time, err error) {
+	opts := m.Latency
+	if len(opts.Buckets) == 0 && len(opts.Quantiles) == 0 {
+		opts = collector.DefaultLatency
+	}
+	name := strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", ".")
+	m.Registry.Histogram("response_time", name, opts).Observe(time.Since(start).Seconds())
+	m.Registry.Counter("total_requests", name).Inc()
+	m.Registry.Counter("total_requests", name+"-"+status.Code(err).String()).Inc()
+}
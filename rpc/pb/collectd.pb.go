@@ -0,0 +1,304 @@
+// Based on collectd's src/proto/collectd.proto, with go_package
+// adjusted.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.35.1
+// 	protoc        (unknown)
+// source: collectd.proto
+
+package pb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// The arguments to DispatchValues.
+type DispatchValuesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// value_list is the metric to be sent to the server.
+	ValueList *ValueList `protobuf:"bytes,1,opt,name=value_list,json=valueList,proto3" json:"value_list,omitempty"`
+}
+
+func (x *DispatchValuesRequest) Reset() {
+	*x = DispatchValuesRequest{}
+	mi := &file_collectd_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DispatchValuesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DispatchValuesRequest) ProtoMessage() {}
+
+func (x *DispatchValuesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_collectd_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DispatchValuesRequest.ProtoReflect.Descriptor instead.
+func (*DispatchValuesRequest) Descriptor() ([]byte, []int) {
+	return file_collectd_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DispatchValuesRequest) GetValueList() *ValueList {
+	if x != nil {
+		return x.ValueList
+	}
+	return nil
+}
+
+// The response from DispatchValues.
+type DispatchValuesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *DispatchValuesResponse) Reset() {
+	*x = DispatchValuesResponse{}
+	mi := &file_collectd_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DispatchValuesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DispatchValuesResponse) ProtoMessage() {}
+
+func (x *DispatchValuesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_collectd_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DispatchValuesResponse.ProtoReflect.Descriptor instead.
+func (*DispatchValuesResponse) Descriptor() ([]byte, []int) {
+	return file_collectd_proto_rawDescGZIP(), []int{1}
+}
+
+// The arguments to QueryValues.
+type QueryValuesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Query by the fields of the identifier. Only return values matching the
+	// specified shell wildcard patterns (see fnmatch(3)). Use '*' to match
+	// any value.
+	Identifier *Identifier `protobuf:"bytes,1,opt,name=identifier,proto3" json:"identifier,omitempty"`
+}
+
+func (x *QueryValuesRequest) Reset() {
+	*x = QueryValuesRequest{}
+	mi := &file_collectd_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryValuesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryValuesRequest) ProtoMessage() {}
+
+func (x *QueryValuesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_collectd_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryValuesRequest.ProtoReflect.Descriptor instead.
+func (*QueryValuesRequest) Descriptor() ([]byte, []int) {
+	return file_collectd_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *QueryValuesRequest) GetIdentifier() *Identifier {
+	if x != nil {
+		return x.Identifier
+	}
+	return nil
+}
+
+// The response from QueryValues.
+type QueryValuesResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ValueList *ValueList `protobuf:"bytes,1,opt,name=value_list,json=valueList,proto3" json:"value_list,omitempty"`
+}
+
+func (x *QueryValuesResponse) Reset() {
+	*x = QueryValuesResponse{}
+	mi := &file_collectd_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *QueryValuesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*QueryValuesResponse) ProtoMessage() {}
+
+func (x *QueryValuesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_collectd_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use QueryValuesResponse.ProtoReflect.Descriptor instead.
+func (*QueryValuesResponse) Descriptor() ([]byte, []int) {
+	return file_collectd_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *QueryValuesResponse) GetValueList() *ValueList {
+	if x != nil {
+		return x.ValueList
+	}
+	return nil
+}
+
+var File_collectd_proto protoreflect.FileDescriptor
+
+var file_collectd_proto_rawDesc = []byte{
+	0x0a, 0x0e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x64, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x12, 0x08, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x64, 0x1a, 0x0b, 0x74, 0x79, 0x70, 0x65,
+	0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x51, 0x0a, 0x15, 0x44, 0x69, 0x73, 0x70, 0x61,
+	0x74, 0x63, 0x68, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x38, 0x0a, 0x0a, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x64, 0x2e,
+	0x74, 0x79, 0x70, 0x65, 0x73, 0x2e, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x52,
+	0x09, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x22, 0x18, 0x0a, 0x16, 0x44, 0x69,
+	0x73, 0x70, 0x61, 0x74, 0x63, 0x68, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x50, 0x0a, 0x12, 0x51, 0x75, 0x65, 0x72, 0x79, 0x56, 0x61, 0x6c,
+	0x75, 0x65, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x3a, 0x0a, 0x0a, 0x69, 0x64,
+	0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a,
+	0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x64, 0x2e, 0x74, 0x79, 0x70, 0x65, 0x73, 0x2e,
+	0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x52, 0x0a, 0x69, 0x64, 0x65, 0x6e,
+	0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x22, 0x4f, 0x0a, 0x13, 0x51, 0x75, 0x65, 0x72, 0x79, 0x56,
+	0x61, 0x6c, 0x75, 0x65, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x38, 0x0a,
+	0x0a, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x5f, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x19, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74, 0x64, 0x2e, 0x74, 0x79, 0x70,
+	0x65, 0x73, 0x2e, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x09, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x32, 0xaf, 0x01, 0x0a, 0x08, 0x43, 0x6f, 0x6c, 0x6c,
+	0x65, 0x63, 0x74, 0x64, 0x12, 0x55, 0x0a, 0x0e, 0x44, 0x69, 0x73, 0x70, 0x61, 0x74, 0x63, 0x68,
+	0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x12, 0x1f, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74,
+	0x64, 0x2e, 0x44, 0x69, 0x73, 0x70, 0x61, 0x74, 0x63, 0x68, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x20, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63,
+	0x74, 0x64, 0x2e, 0x44, 0x69, 0x73, 0x70, 0x61, 0x74, 0x63, 0x68, 0x56, 0x61, 0x6c, 0x75, 0x65,
+	0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x12, 0x4c, 0x0a, 0x0b, 0x51,
+	0x75, 0x65, 0x72, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x12, 0x1c, 0x2e, 0x63, 0x6f, 0x6c,
+	0x6c, 0x65, 0x63, 0x74, 0x64, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x63, 0x6f, 0x6c, 0x6c, 0x65,
+	0x63, 0x74, 0x64, 0x2e, 0x51, 0x75, 0x65, 0x72, 0x79, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x73, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x30, 0x01, 0x42, 0x1e, 0x5a, 0x1c, 0x68, 0x6f, 0x6e,
+	0x6e, 0x65, 0x66, 0x2e, 0x63, 0x6f, 0x2f, 0x67, 0x6f, 0x2f, 0x63, 0x6f, 0x6c, 0x6c, 0x65, 0x63,
+	0x74, 0x64, 0x2f, 0x72, 0x70, 0x63, 0x2f, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_collectd_proto_rawDescOnce sync.Once
+	file_collectd_proto_rawDescData = file_collectd_proto_rawDesc
+)
+
+func file_collectd_proto_rawDescGZIP() []byte {
+	file_collectd_proto_rawDescOnce.Do(func() {
+		file_collectd_proto_rawDescData = protoimpl.X.CompressGZIP(file_collectd_proto_rawDescData)
+	})
+	return file_collectd_proto_rawDescData
+}
+
+var file_collectd_proto_msgTypes = make([]protoimpl.MessageInfo, 4)
+var file_collectd_proto_goTypes = []any{
+	(*DispatchValuesRequest)(nil),  // 0: collectd.DispatchValuesRequest
+	(*DispatchValuesResponse)(nil), // 1: collectd.DispatchValuesResponse
+	(*QueryValuesRequest)(nil),     // 2: collectd.QueryValuesRequest
+	(*QueryValuesResponse)(nil),    // 3: collectd.QueryValuesResponse
+	(*ValueList)(nil),              // 4: collectd.types.ValueList
+	(*Identifier)(nil),             // 5: collectd.types.Identifier
+}
+var file_collectd_proto_depIdxs = []int32{
+	4, // 0: collectd.DispatchValuesRequest.value_list:type_name -> collectd.types.ValueList
+	5, // 1: collectd.QueryValuesRequest.identifier:type_name -> collectd.types.Identifier
+	4, // 2: collectd.QueryValuesResponse.value_list:type_name -> collectd.types.ValueList
+	0, // 3: collectd.Collectd.DispatchValues:input_type -> collectd.DispatchValuesRequest
+	2, // 4: collectd.Collectd.QueryValues:input_type -> collectd.QueryValuesRequest
+	1, // 5: collectd.Collectd.DispatchValues:output_type -> collectd.DispatchValuesResponse
+	3, // 6: collectd.Collectd.QueryValues:output_type -> collectd.QueryValuesResponse
+	5, // [5:7] is the sub-list for method output_type
+	3, // [3:5] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_collectd_proto_init() }
+func file_collectd_proto_init() {
+	if File_collectd_proto != nil {
+		return
+	}
+	file_types_proto_init()
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_collectd_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   4,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_collectd_proto_goTypes,
+		DependencyIndexes: file_collectd_proto_depIdxs,
+		MessageInfos:      file_collectd_proto_msgTypes,
+	}.Build()
+	File_collectd_proto = out.File
+	file_collectd_proto_rawDesc = nil
+	file_collectd_proto_goTypes = nil
+	file_collectd_proto_depIdxs = nil
+}
@@ -0,0 +1,5 @@
+// Package pb contains the protocol buffer and gRPC bindings of
+// collectd's grpc plugin, generated from collectd's proto files.
+package pb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative types.proto collectd.proto
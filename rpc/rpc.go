@@ -0,0 +1,110 @@
+// Package rpc implements clients and servers for the gRPC service of
+// collectd's grpc plugin, available since collectd 5.7.
+package rpc // import "honnef.co/go/collectd/rpc"
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/rpc/pb"
+)
+
+// DefaultPort is the grpc plugin's default port.
+const DefaultPort = "50051"
+
+// MarshalIdentifier converts id to its protocol buffer form.
+func MarshalIdentifier(id collectd.Identifier) *pb.Identifier {
+	return &pb.Identifier{
+		Host:           id.Host,
+		Plugin:         id.Plugin,
+		PluginInstance: id.PluginInstance,
+		Type:           id.Type,
+		TypeInstance:   id.TypeInstance,
+	}
+}
+
+// UnmarshalIdentifier converts id from its protocol buffer form. A
+// nil id results in the zero Identifier.
+func UnmarshalIdentifier(id *pb.Identifier) collectd.Identifier {
+	return collectd.Identifier{
+		Host:           id.GetHost(),
+		Plugin:         id.GetPlugin(),
+		PluginInstance: id.GetPluginInstance(),
+		Type:           id.GetType(),
+		TypeInstance:   id.GetTypeInstance(),
+	}
+}
+
+// MarshalValueList converts vl to its protocol buffer form. A zero
+// time or interval is left unset, so that the receiver picks its
+// own.
+func MarshalValueList(vl collectd.ValueList) (*pb.ValueList, error) {
+	values := make([]*pb.Value, len(vl.Values))
+	for i, v := range vl.Values {
+		switch v := v.(type) {
+		case collectd.Gauge:
+			values[i] = &pb.Value{Value: &pb.Value_Gauge{Gauge: float64(v)}}
+		case collectd.Derive:
+			values[i] = &pb.Value{Value: &pb.Value_Derive{Derive: int64(v)}}
+		case collectd.Counter:
+			values[i] = &pb.Value{Value: &pb.Value_Counter{Counter: uint64(v)}}
+		case collectd.Absolute:
+			values[i] = &pb.Value{Value: &pb.Value_Absolute{Absolute: uint64(v)}}
+		default:
+			return nil, fmt.Errorf("rpc: unsupported value type %T", v)
+		}
+	}
+	pvl := &pb.ValueList{
+		Values:     values,
+		Identifier: MarshalIdentifier(vl.Identifier),
+	}
+	if !vl.Time.IsZero() {
+		pvl.Time = timestamppb.New(vl.Time)
+	}
+	if vl.Interval > 0 {
+		pvl.Interval = durationpb.New(vl.Interval)
+	}
+	return pvl, nil
+}
+
+// UnmarshalValueList converts vl from its protocol buffer form. Data
+// source names and metadata are dropped.
+func UnmarshalValueList(vl *pb.ValueList) (collectd.ValueList, error) {
+	if vl == nil {
+		return collectd.ValueList{}, errors.New("rpc: missing value list")
+	}
+	out := collectd.ValueList{
+		Identifier: UnmarshalIdentifier(vl.Identifier),
+		Values:     make([]collectd.Value, len(vl.Values)),
+	}
+	for i, v := range vl.Values {
+		switch v := v.GetValue().(type) {
+		case *pb.Value_Gauge:
+			out.Values[i] = collectd.Gauge(v.Gauge)
+		case *pb.Value_Derive:
+			out.Values[i] = collectd.Derive(v.Derive)
+		case *pb.Value_Counter:
+			out.Values[i] = collectd.Counter(v.Counter)
+		case *pb.Value_Absolute:
+			out.Values[i] = collectd.Absolute(v.Absolute)
+		default:
+			return collectd.ValueList{}, fmt.Errorf("rpc: value %d has no value", i)
+		}
+	}
+	if vl.Time != nil {
+		if err := vl.Time.CheckValid(); err != nil {
+			return collectd.ValueList{}, fmt.Errorf("rpc: %s", err)
+		}
+		out.Time = vl.Time.AsTime()
+	}
+	if vl.Interval != nil {
+		if err := vl.Interval.CheckValid(); err != nil {
+			return collectd.ValueList{}, fmt.Errorf("rpc: %s", err)
+		}
+		out.Interval = vl.Interval.AsDuration()
+	}
+	return out, nil
+}
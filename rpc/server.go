@@ -0,0 +1,183 @@
+package rpc
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"path"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+	"honnef.co/go/collectd/rpc/pb"
+)
+
+// A Querier answers QueryValues requests.
+type Querier interface {
+	// Query returns the current value lists whose identifiers
+	// match pattern, as reported by Match.
+	Query(ctx context.Context, pattern collectd.Identifier) ([]collectd.ValueList, error)
+}
+
+// Match reports whether id matches pattern, whose fields are shell
+// wildcard patterns as used by QueryValues.
+func Match(pattern, id collectd.Identifier) bool {
+	for _, f := range [...][2]string{
+		{pattern.Host, id.Host},
+		{pattern.Plugin, id.Plugin},
+		{pattern.PluginInstance, id.PluginInstance},
+		{pattern.Type, id.Type},
+		{pattern.TypeInstance, id.TypeInstance},
+	} {
+		if ok, _ := path.Match(f[0], f[1]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Server implements the gRPC service of collectd's grpc plugin. collectd
+// instances whose grpc plugin has a Server block pointing at it push
+// their value lists to it.
+type Server struct {
+	// Addr is the TCP address to listen on. It defaults to the grpc
+	// plugin's default port on all interfaces.
+	Addr string
+	// Writer receives all value lists.
+	Writer collectd.Writer
+	// Querier, if not nil, answers QueryValues requests, which
+	// otherwise fail as unimplemented.
+	Querier Querier
+	// TLSConfig, if not nil, secures connections with TLS. It may
+	// be created with TLSFiles.ServerConfig.
+	TLSConfig *tls.Config
+	// ServerOptions are passed to grpc.NewServer by ListenAndServe
+	// and Serve.
+	ServerOptions []grpc.ServerOption
+	// Logger, if not nil, receives errors returned by Writer.
+	Logger *slog.Logger
+
+	errs      health.ErrorTracker
+	listening atomic.Int32
+	stopped   atomic.Bool
+}
+
+// ListenAndServe listens on s.Addr and serves requests until ctx is
+// canceled.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":" + DefaultPort
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	var lc net.ListenConfig
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		s.errs.Track(err)
+		return err
+	}
+	return s.Serve(ctx, l)
+}
+
+// Serve serves requests on l until ctx is canceled. It closes l
+// before returning.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	opts := s.ServerOptions
+	if s.TLSConfig != nil {
+		opts = append([]grpc.ServerOption{grpc.Creds(credentials.NewTLS(s.TLSConfig))}, opts...)
+	}
+	gs := grpc.NewServer(opts...)
+	s.Register(gs)
+	s.listening.Add(1)
+	defer s.listening.Add(-1)
+	stop := context.AfterFunc(ctx, gs.Stop)
+	defer stop()
+	err := gs.Serve(l)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	s.errs.Track(err)
+	s.stopped.Store(true)
+	return err
+}
+
+// Register registers the service with r, for serving it alongside
+// other services.
+func (s *Server) Register(r grpc.ServiceRegistrar) {
+	pb.RegisterCollectdServer(r, service{s: s})
+}
+
+// Health reports the server as healthy unless it stopped because of
+// an error, and as connected while it is serving.
+func (s *Server) Health() collectd.Health {
+	err, when := s.errs.Last()
+	return collectd.Health{
+		Healthy:       !s.stopped.Load(),
+		Connected:     s.listening.Load() > 0,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (s *Server) log(ctx context.Context, msg string, err error) {
+	s.errs.Track(err)
+	if s.Logger != nil {
+		s.Logger.WarnContext(ctx, msg, "error", err)
+	}
+}
+
+// service implements pb.CollectdServer, keeping its methods out of
+// Server's API.
+type service struct {
+	pb.UnimplementedCollectdServer
+	s *Server
+}
+
+func (svc service) DispatchValues(stream grpc.ClientStreamingServer[pb.DispatchValuesRequest, pb.DispatchValuesResponse]) error {
+	ctx := stream.Context()
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&pb.DispatchValuesResponse{})
+		}
+		if err != nil {
+			return err
+		}
+		vl, err := UnmarshalValueList(req.GetValueList())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err := svc.s.Writer.Write(ctx, vl); err != nil {
+			svc.s.log(ctx, "could not write value list", err)
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+}
+
+func (svc service) QueryValues(req *pb.QueryValuesRequest, stream grpc.ServerStreamingServer[pb.QueryValuesResponse]) error {
+	if svc.s.Querier == nil {
+		return status.Error(codes.Unimplemented, "QueryValues is not supported")
+	}
+	ctx := stream.Context()
+	vls, err := svc.s.Querier.Query(ctx, UnmarshalIdentifier(req.GetIdentifier()))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	for _, vl := range vls {
+		pvl, err := MarshalValueList(vl)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(&pb.QueryValuesResponse{ValueList: pvl}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSFiles mirrors the SSL options of the grpc plugin's Server and
+// Listen blocks, for building TLS configurations that interoperate
+// with collectd.
+type TLSFiles struct {
+	// CACertificateFile is the PEM file of the certificate
+	// authorities that verify the peer. If it is empty, clients use
+	// the system's roots, and servers don't request client
+	// certificates.
+	CACertificateFile string
+	// CertificateFile and CertificateKeyFile are the PEM files of
+	// the own certificate and its key. Servers need them; clients
+	// present them for mutual TLS.
+	CertificateFile    string
+	CertificateKeyFile string
+	// ServerName is the name that clients verify the server's
+	// certificate against. It defaults to the host being dialed.
+	ServerName string
+	// NoVerifyPeer makes servers accept clients without a
+	// certificate, like VerifyPeer false. By default, servers with
+	// a CACertificateFile require a valid client certificate.
+	NoVerifyPeer bool
+}
+
+// ClientConfig returns the TLS configuration for a Client.
+func (f TLSFiles) ClientConfig() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: f.ServerName}
+	if f.CACertificateFile != "" {
+		pool, err := loadCertPool(f.CACertificateFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if f.CertificateFile != "" || f.CertificateKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(f.CertificateFile, f.CertificateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// ServerConfig returns the TLS configuration for a Server.
+func (f TLSFiles) ServerConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(f.CertificateFile, f.CertificateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}}
+	if f.CACertificateFile != "" {
+		pool, err := loadCertPool(f.CACertificateFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		if f.NoVerifyPeer {
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+	return cfg, nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("rpc: %s: no certificates found", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,346 @@
+// Package rrdcached implements a client for the protocol of
+// rrdcached, the RRDtool caching daemon, which collectd's rrdcached
+// plugin writes to. Unlike GETVAL, which only returns current values,
+// FETCH gives access to the history stored in RRD files.
+package rrdcached // import "honnef.co/go/collectd/rrdcached"
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// DefaultPort is rrdcached's default TCP port.
+const DefaultPort = "42217"
+
+// Error is an error returned by rrdcached.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string { return "rrdcached: " + e.Message }
+
+// Client is a connection to rrdcached. It is safe for concurrent use;
+// commands are serialized.
+type Client struct {
+	conn io.ReadWriteCloser
+
+	errs   health.ErrorTracker
+	closed atomic.Bool
+	// broken is set after I/O errors, which leave the connection in
+	// an unknown state.
+	broken atomic.Bool
+
+	mu sync.Mutex
+	r  *bufio.Reader
+}
+
+var _ collectd.Writer = (*Client)(nil)
+
+// Dial connects to rrdcached at address, using the syntax of
+// collectd's DaemonAddress option: "unix:/path/to/socket" or an
+// absolute path for unix sockets, and host or host:port for TCP.
+func Dial(ctx context.Context, address string) (*Client, error) {
+	network := "tcp"
+	switch {
+	case strings.HasPrefix(address, "unix:"):
+		network, address = "unix", strings.TrimPrefix(address, "unix:")
+	case strings.HasPrefix(address, "/"):
+		network = "unix"
+	default:
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(address, DefaultPort)
+		}
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// NewClient returns a client that talks to rrdcached over conn.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Filename returns the file, relative to rrdcached's base directory,
+// that collectd's rrdtool and rrdcached plugins store values of id
+// in.
+func Filename(id collectd.Identifier) string {
+	return id.String() + ".rrd"
+}
+
+// maxResponseLines bounds the number of lines we are willing to read
+// for a single response, protecting against corrupt counts.
+const maxResponseLines = 1 << 24
+
+// command sends a command and returns the message of the status line
+// and the lines that follow it.
+func (c *Client) command(ctx context.Context, cmd string) (string, []string, error) {
+	msg, lines, err := c.roundTrip(ctx, cmd)
+	c.errs.Track(err)
+	// Errors other than those reported by rrdcached, and other than
+	// those detected before sending the command, leave the
+	// connection out of sync.
+	var rerr *Error
+	if err != nil && err != ctx.Err() && err != errNewline && !errors.As(err, &rerr) {
+		c.broken.Store(true)
+	}
+	return msg, lines, err
+}
+
+var errNewline = errors.New("rrdcached: command contains newline")
+
+func (c *Client) roundTrip(ctx context.Context, cmd string) (string, []string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", nil, err
+	}
+	if strings.ContainsAny(cmd, "\r\n") {
+		return "", nil, errNewline
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.conn.(interface{ SetDeadline(time.Time) error }); ok {
+		if dl, ok := ctx.Deadline(); ok {
+			d.SetDeadline(dl)
+			defer d.SetDeadline(time.Time{})
+		}
+	}
+	if _, err := io.WriteString(c.conn, cmd+"\n"); err != nil {
+		return "", nil, err
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return "", nil, err
+	}
+	code, msg, _ := strings.Cut(line, " ")
+	status, err := strconv.Atoi(code)
+	if err != nil {
+		return "", nil, fmt.Errorf("rrdcached: malformed response %q", line)
+	}
+	if status < 0 {
+		return "", nil, &Error{Status: status, Message: msg}
+	}
+	if status > maxResponseLines {
+		return "", nil, fmt.Errorf("rrdcached: implausible number of lines in %q", line)
+	}
+	lines := make([]string, 0, min(status, 1024))
+	for range status {
+		l, err := c.readLine()
+		if err != nil {
+			return "", nil, err
+		}
+		lines = append(lines, l)
+	}
+	return msg, lines, nil
+}
+
+func (c *Client) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Update enqueues updates of file with the values of vls, which must
+// match the file's data sources. Times have second resolution, as in
+// collectd's rrdcached plugin; a zero time means now.
+func (c *Client) Update(ctx context.Context, file string, vls ...collectd.ValueList) error {
+	if len(vls) == 0 {
+		return nil
+	}
+	var b strings.Builder
+	b.WriteString("UPDATE ")
+	b.WriteString(file)
+	for _, vl := range vls {
+		b.WriteByte(' ')
+		if vl.Time.IsZero() {
+			b.WriteByte('N')
+		} else {
+			b.WriteString(strconv.FormatInt(vl.Time.Unix(), 10))
+		}
+		for _, v := range vl.Values {
+			b.WriteByte(':')
+			b.WriteString(formatValue(v))
+		}
+	}
+	_, _, err := c.command(ctx, b.String())
+	return err
+}
+
+func formatValue(v collectd.Value) string {
+	switch v := v.(type) {
+	case collectd.Gauge:
+		if math.IsNaN(float64(v)) {
+			return "U"
+		}
+		return strconv.FormatFloat(float64(v), 'f', -1, 64)
+	case collectd.Derive:
+		return strconv.FormatInt(int64(v), 10)
+	case collectd.Counter:
+		return strconv.FormatUint(uint64(v), 10)
+	case collectd.Absolute:
+		return strconv.FormatUint(uint64(v), 10)
+	default:
+		return "U"
+	}
+}
+
+// Write updates the file of vl's identifier, as returned by Filename.
+// The file must already exist.
+func (c *Client) Write(ctx context.Context, vl collectd.ValueList) error {
+	return c.Update(ctx, Filename(vl.Identifier), vl)
+}
+
+// Flush writes the pending updates of file to disk.
+func (c *Client) Flush(ctx context.Context, file string) error {
+	_, _, err := c.command(ctx, "FLUSH "+file)
+	return err
+}
+
+// FlushAll writes all pending updates to disk.
+func (c *Client) FlushAll(ctx context.Context) error {
+	_, _, err := c.command(ctx, "FLUSHALL")
+	return err
+}
+
+// FetchResult is the result of a FETCH command.
+type FetchResult struct {
+	Start   time.Time
+	End     time.Time
+	Step    time.Duration
+	DSNames []string
+	Rows    []FetchRow
+}
+
+// FetchRow is a row of consolidated values. Unknown values are NaN.
+type FetchRow struct {
+	Time   time.Time
+	Values []float64
+}
+
+// Fetch returns the values of file consolidated with cf, such as
+// "AVERAGE", between start and end. Zero times use rrdcached's
+// defaults of one day ago and now. rrdcached flushes pending updates
+// of the file first.
+func (c *Client) Fetch(ctx context.Context, file, cf string, start, end time.Time) (*FetchResult, error) {
+	cmd := "FETCH " + file + " " + cf
+	if !start.IsZero() || !end.IsZero() {
+		if start.IsZero() {
+			start = time.Now().Add(-24 * time.Hour)
+		}
+		cmd += " " + strconv.FormatInt(start.Unix(), 10)
+		if !end.IsZero() {
+			cmd += " " + strconv.FormatInt(end.Unix(), 10)
+		}
+	}
+	_, lines, err := c.command(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	res := &FetchResult{}
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("rrdcached: malformed FETCH line %q", line)
+		}
+		switch key {
+		case "FlushVersion":
+		case "Start", "End", "Step":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rrdcached: malformed FETCH line %q", line)
+			}
+			switch key {
+			case "Start":
+				res.Start = time.Unix(n, 0)
+			case "End":
+				res.End = time.Unix(n, 0)
+			case "Step":
+				res.Step = time.Duration(n) * time.Second
+			}
+		case "DSCount":
+		case "DSName":
+			res.DSNames = strings.Fields(value)
+		default:
+			n, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("rrdcached: malformed FETCH line %q", line)
+			}
+			row := FetchRow{Time: time.Unix(n, 0)}
+			for _, f := range strings.Fields(value) {
+				v, err := strconv.ParseFloat(f, 64)
+				if err != nil {
+					v = math.NaN()
+				}
+				row.Values = append(row.Values, v)
+			}
+			res.Rows = append(res.Rows, row)
+		}
+	}
+	return res, nil
+}
+
+// Stats returns the daemon's statistics, such as QueueLength and
+// UpdatesReceived.
+func (c *Client) Stats(ctx context.Context) (map[string]uint64, error) {
+	_, lines, err := c.command(ctx, "STATS")
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]uint64, len(lines))
+	for _, line := range lines {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			return nil, fmt.Errorf("rrdcached: malformed STATS line %q", line)
+		}
+		n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rrdcached: malformed STATS line %q", line)
+		}
+		stats[key] = n
+	}
+	return stats, nil
+}
+
+// Health reports the client as healthy until it is closed, and as
+// connected until it is closed or an I/O error leaves the connection
+// unusable.
+func (c *Client) Health() collectd.Health {
+	err, when := c.errs.Last()
+	closed := c.closed.Load()
+	return collectd.Health{
+		Healthy:       !closed,
+		Connected:     !closed && !c.broken.Load(),
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+// Close sends QUIT and closes the connection.
+func (c *Client) Close() error {
+	c.closed.Store(true)
+	c.mu.Lock()
+	io.WriteString(c.conn, "QUIT\n")
+	c.mu.Unlock()
+	return c.conn.Close()
+}
@@ -0,0 +1,67 @@
+package collectd
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+)
+
+// Schedule describes when a periodic task, such as a collector, runs.
+// When many agents submit on the same interval, Align and Jitter
+// prevent them from synchronizing and creating load spikes on
+// aggregators.
+type Schedule struct {
+	Interval time.Duration
+	// Align causes runs to happen on wall clock boundaries, that
+	// is, at multiples of Interval since the epoch.
+	Align bool
+	// Jitter is the upper bound of a random offset that is chosen
+	// once per run of the schedule and added to every tick. Using a
+	// fixed offset keeps the intervals between ticks regular while
+	// spreading different collectors apart.
+	Jitter time.Duration
+}
+
+// first returns the first tick at or after now.
+func (s Schedule) first(now time.Time, offset time.Duration) time.Time {
+	if !s.Align {
+		return now.Add(offset)
+	}
+	t := now.Truncate(s.Interval).Add(offset)
+	if t.Before(now) {
+		t = t.Add(s.Interval)
+	}
+	return t
+}
+
+func (s Schedule) offset() time.Duration {
+	if s.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(s.Jitter)
+}
+
+// Run calls fn at every tick of the schedule until ctx is canceled,
+// passing the scheduled time of the tick. Ticks that are missed
+// because fn took too long are skipped. Run returns ctx.Err().
+func (s Schedule) Run(ctx context.Context, fn func(ctx context.Context, t time.Time)) error {
+	if s.Interval <= 0 {
+		panic("collectd: non-positive schedule interval")
+	}
+	next := s.first(time.Now(), s.offset())
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+		fn(ctx, next)
+		now := time.Now()
+		for !next.After(now) {
+			next = next.Add(s.Interval)
+		}
+		timer.Reset(time.Until(next))
+	}
+}
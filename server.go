@@ -0,0 +1,251 @@
+package collectd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// A Handler responds to commands received by a Server. The returned
+// lines are sent as the data of a successful response. A non-nil
+// error is sent to the client as a failure status.
+type Handler interface {
+	ServeCommand(ctx context.Context, cmd Command) (lines []string, err error)
+}
+
+// HandlerFunc adapts an ordinary function to the Handler interface.
+type HandlerFunc func(ctx context.Context, cmd Command) ([]string, error)
+
+// ServeCommand calls f(ctx, cmd).
+func (f HandlerFunc) ServeCommand(ctx context.Context, cmd Command) ([]string, error) {
+	return f(ctx, cmd)
+}
+
+// ErrServerClosed is returned by Server.Serve after the server has
+// been closed.
+var ErrServerClosed = errors.New("collectd: server closed")
+
+// Server implements the server side of the plain text protocol,
+// allowing Go programs to impersonate collectd's unixsock plugin, for
+// example in proxies, shims and tests.
+type Server struct {
+	Handler Handler
+	// TypesDB is used to type and check PUTVAL values. If it is nil,
+	// all values are treated as gauges.
+	TypesDB TypesDB
+	// Logger, if not nil, receives connection errors.
+	Logger *slog.Logger
+
+	errs health.ErrorTracker
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// Listen creates a unix socket at path and serves connections to it
+// in the background, passing commands to h. It is a shorthand for
+// calling ListenUnix on a Server with only a Handler; to set other
+// fields, such as TypesDB, use ListenUnix directly, as they must not
+// be changed once the server is serving.
+func Listen(path string, h Handler) (*Server, error) {
+	s := &Server{Handler: h}
+	if err := s.ListenUnix(path); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListenUnix creates a unix socket at path and serves connections to
+// it in the background. An existing socket at path is removed first,
+// like collectd does. On Linux, paths starting with @ denote abstract
+// sockets.
+func (s *Server) ListenUnix(path string) error {
+	addr, err := resolveUnix(path)
+	if err != nil {
+		return err
+	}
+	if addr.Name[0] != '@' {
+		if fi, err := os.Lstat(addr.Name); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(addr.Name)
+		}
+	}
+	l, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return err
+	}
+	go s.Serve(l)
+	return nil
+}
+
+func (s *Server) init() {
+	if s.listeners == nil {
+		s.listeners = map[net.Listener]struct{}{}
+		s.conns = map[net.Conn]struct{}{}
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// Serve accepts connections on l and serves them until the server is
+// closed. It always returns a non-nil error.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	s.init()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			s.errs.Track(err)
+			l.Close()
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			continue
+		}
+		s.conns[c] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.serveConn(c)
+	}
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	sc := bufio.NewScanner(c)
+	sc.Buffer(nil, 1<<20)
+	w := bufio.NewWriter(c)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		status, lines := s.serveLine(line)
+		fmt.Fprintf(w, "%s\n", status)
+		for _, l := range lines {
+			w.WriteString(l)
+			w.WriteByte('\n')
+		}
+		if err := w.Flush(); err != nil {
+			s.log("could not write response", err)
+			return
+		}
+	}
+	if err := sc.Err(); err != nil {
+		s.log("could not read command", err)
+	}
+}
+
+func (s *Server) serveLine(line string) (string, []string) {
+	cmd, err := ParseCommand(line, s.TypesDB)
+	if err != nil {
+		return "-1 " + oneLine(err.Error()), nil
+	}
+	lines, err := s.Handler.ServeCommand(s.ctx, cmd)
+	if err != nil {
+		return "-1 " + oneLine(err.Error()), nil
+	}
+	var msg string
+	switch cmd := cmd.(type) {
+	case *PutvalCommand:
+		n := len(cmd.ValueLists)
+		if n == 1 {
+			msg = "Success: 1 value has been dispatched."
+		} else {
+			msg = fmt.Sprintf("Success: %d values have been dispatched.", n)
+		}
+		return "0 " + msg, nil
+	case *PutnotifCommand:
+		return "0 Success", nil
+	case *FlushCommand:
+		return "0 Done", nil
+	default:
+		if len(lines) == 1 {
+			msg = "Value found"
+		} else {
+			msg = "Values found"
+		}
+		return fmt.Sprintf("%d %s", len(lines), msg), lines
+	}
+}
+
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+func (s *Server) log(msg string, err error) {
+	s.errs.Track(err)
+	if s.Logger != nil {
+		s.Logger.Error(msg, "error", err)
+	}
+}
+
+// Health reports the server as healthy until it is closed, and as
+// connected while it is listening.
+func (s *Server) Health() Health {
+	s.mu.Lock()
+	closed, listening := s.closed, len(s.listeners) > 0
+	s.mu.Unlock()
+	err, when := s.errs.Last()
+	return Health{Healthy: !closed, Connected: listening, LastError: err, LastErrorTime: when}
+}
+
+// Close stops all listeners, closes all connections and waits for
+// their handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.init()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.closed = true
+	s.cancel()
+	var err error
+	for l := range s.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
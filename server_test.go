@@ -0,0 +1,104 @@
+package collectd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testHandler answers GETVAL and LISTVAL with canned lines and fails
+// commands for the plugin "fail".
+func testHandler(ctx context.Context, cmd Command) ([]string, error) {
+	switch cmd := cmd.(type) {
+	case *PutvalCommand:
+		if cmd.ValueLists[0].Plugin == "fail" {
+			return nil, errors.New("write failed:\nbackend down")
+		}
+		return nil, nil
+	case *GetvalCommand:
+		return []string{"value=1"}, nil
+	case *ListvalCommand:
+		return []string{"1700000000.000 example.com/cpu/gauge", "1700000000.000 example.com/load/load"}, nil
+	default:
+		return nil, nil
+	}
+}
+
+func TestServeLine(t *testing.T) {
+	s := &Server{Handler: HandlerFunc(testHandler), TypesDB: TypesDB{"gauge": {{Name: "value", Type: DSTypeGauge}}}}
+	tests := []struct {
+		line   string
+		status string
+		lines  []string
+	}{
+		{`PUTVAL example.com/cpu/gauge N:1`, "0 Success: 1 value has been dispatched.", nil},
+		{`PUTVAL example.com/cpu/gauge N:1 N:2`, "0 Success: 2 values have been dispatched.", nil},
+		{`PUTVAL example.com/cpu/gauge N:1:2`, "-1 PUTVAL: type gauge has 1 data sources, got 2 values", nil},
+		{`PUTVAL example.com/fail/gauge N:1`, "-1 write failed: backend down", nil},
+		{`PUTNOTIF severity=okay message=hi`, "0 Success", nil},
+		{`GETVAL example.com/cpu/gauge`, "1 Value found", []string{"value=1"}},
+		{`LISTVAL`, "2 Values found", []string{"1700000000.000 example.com/cpu/gauge", "1700000000.000 example.com/load/load"}},
+		{`FLUSH`, "0 Done", nil},
+		{`STOP`, `-1 unknown command "STOP"`, nil},
+		{`GETVAL "unterminated`, "-1 unterminated quoted string", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			status, lines := s.serveLine(tt.line)
+			if status != tt.status {
+				t.Errorf("got status %q, want %q", status, tt.status)
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("got lines %q, want %q", lines, tt.lines)
+			}
+		})
+	}
+}
+
+func TestServeConn(t *testing.T) {
+	s := &Server{Handler: HandlerFunc(testHandler)}
+	defer s.Close()
+	path := filepath.Join(t.TempDir(), "unixsock")
+	if err := s.ListenUnix(path); err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+
+	// Blank lines are skipped, CRLF is accepted, and malformed
+	// commands don't end the connection.
+	c.Write([]byte("\nGETVAL example.com/cpu/gauge\r\nBOGUS\n\"\nLISTVAL\n"))
+	want := []string{
+		"1 Value found", "value=1",
+		`-1 unknown command "BOGUS"`,
+		"-1 unterminated quoted string",
+		"2 Values found", "1700000000.000 example.com/cpu/gauge", "1700000000.000 example.com/load/load",
+	}
+	sc := bufio.NewScanner(c)
+	var got []string
+	for len(got) < len(want) && sc.Scan() {
+		got = append(got, sc.Text())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got responses\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	// Lines longer than the scanner's buffer end the connection.
+	c.Write([]byte("GETVAL " + strings.Repeat("a", 2<<20) + "\n"))
+	if sc.Scan() {
+		t.Errorf("got response %q to overlong line, want closed connection", sc.Text())
+	}
+	if h := s.Health(); h.LastError == nil {
+		t.Error("read error wasn't reported by Health")
+	}
+}
@@ -0,0 +1,335 @@
+package collectd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// Spool is a Writer that stores value lists on disk while the
+// underlying writer fails, and replays them with their original
+// timestamps once it works again. Together with a Redialer, this
+// bridges collectd restarts without losing values.
+//
+// The spool is a directory of append-only segment files. Writes are
+// not synced to disk individually.
+type Spool struct {
+	// RetryInterval is the minimum time between attempts to replay
+	// spooled value lists. It defaults to ten seconds.
+	RetryInterval time.Duration
+	// SegmentSize is the number of value lists per segment file. It
+	// defaults to 10000.
+	SegmentSize int
+
+	dir string
+	w   Writer
+
+	errs health.ErrorTracker
+
+	mu         sync.Mutex
+	cur        *os.File
+	curRecords int
+	seq        int
+	pending    int
+	lastTry    time.Time
+}
+
+var _ Writer = (*Spool)(nil)
+
+const spoolSuffix = ".spool"
+
+// NewSpool returns a Spool that writes to w and spools to dir,
+// creating it if necessary. Value lists left in dir by an earlier
+// Spool will be replayed.
+func NewSpool(dir string, w Writer) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &Spool{dir: dir, w: w}
+	segs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seg := range segs {
+		n, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(seg), spoolSuffix))
+		if err == nil && n > s.seq {
+			s.seq = n
+		}
+		b, err := os.ReadFile(seg)
+		if err != nil {
+			return nil, err
+		}
+		s.pending += bytes.Count(b, []byte{'\n'})
+	}
+	return s, nil
+}
+
+type spoolRecord struct {
+	Host           string        `json:"host"`
+	Plugin         string        `json:"plugin"`
+	PluginInstance string        `json:"plugin_instance,omitempty"`
+	Type           string        `json:"type"`
+	TypeInstance   string        `json:"type_instance,omitempty"`
+	Time           int64         `json:"time"`
+	Interval       time.Duration `json:"interval,omitempty"`
+	// Values are encoded as the data source type's number, a colon
+	// and the value in the plain text protocol's format.
+	Values []string `json:"values"`
+}
+
+func encodeSpoolRecord(vl ValueList) ([]byte, error) {
+	rec := spoolRecord{
+		Host:           vl.Host,
+		Plugin:         vl.Plugin,
+		PluginInstance: vl.PluginInstance,
+		Type:           vl.Type,
+		TypeInstance:   vl.TypeInstance,
+		Time:           vl.Time.UnixNano(),
+		Interval:       vl.Interval,
+		Values:         make([]string, len(vl.Values)),
+	}
+	for i, v := range vl.Values {
+		rec.Values[i] = strconv.Itoa(int(v.DSType())) + ":" + formatValue(v)
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func decodeSpoolRecord(b []byte) (ValueList, error) {
+	var rec spoolRecord
+	if err := json.Unmarshal(b, &rec); err != nil {
+		return ValueList{}, err
+	}
+	vl := ValueList{
+		Identifier: Identifier{
+			Host:           rec.Host,
+			Plugin:         rec.Plugin,
+			PluginInstance: rec.PluginInstance,
+			Type:           rec.Type,
+			TypeInstance:   rec.TypeInstance,
+		},
+		Time:     time.Unix(0, rec.Time),
+		Interval: rec.Interval,
+		Values:   make([]Value, len(rec.Values)),
+	}
+	for i, s := range rec.Values {
+		t, v, ok := strings.Cut(s, ":")
+		n, err := strconv.Atoi(t)
+		if !ok || err != nil {
+			return ValueList{}, fmt.Errorf("invalid spooled value %q", s)
+		}
+		if vl.Values[i], err = parseValue(v, DSType(n)); err != nil {
+			return ValueList{}, err
+		}
+	}
+	return vl, nil
+}
+
+func (s *Spool) segments() ([]string, error) {
+	segs, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(segs)
+	return segs, nil
+}
+
+// Write writes vl to the underlying writer. If that fails, or if
+// there are still spooled value lists that could not be replayed, vl
+// is spooled instead and Write returns nil. Only value lists that
+// failed because collectd was unreachable are spooled; the errors of
+// all others, such as malformed value lists or ones that collectd
+// rejected, are returned.
+func (s *Spool) Write(ctx context.Context, vl ValueList) error {
+	if vl.Time.IsZero() {
+		// Replayed values must keep their original time.
+		vl.Time = time.Now()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending > 0 {
+		s.tryReplay(ctx)
+		if s.pending > 0 {
+			return s.append(vl)
+		}
+	}
+	err := s.w.Write(ctx, vl)
+	s.errs.Track(err)
+	if err == nil || !isTransient(err) {
+		return err
+	}
+	s.lastTry = time.Now()
+	return s.append(vl)
+}
+
+// isTransient reports whether err is caused by collectd being
+// unreachable, as opposed to the value list being invalid, so that
+// writing it again may succeed.
+func isTransient(err error) bool {
+	var ioErr IOError
+	var netErr net.Error
+	return errors.As(err, &ioErr) || errors.As(err, &netErr) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (s *Spool) tryReplay(ctx context.Context) {
+	retry := s.RetryInterval
+	if retry <= 0 {
+		retry = 10 * time.Second
+	}
+	if time.Since(s.lastTry) < retry {
+		return
+	}
+	s.lastTry = time.Now()
+	s.errs.Track(s.replay(ctx))
+}
+
+func (s *Spool) append(vl ValueList) error {
+	size := s.SegmentSize
+	if size <= 0 {
+		size = 10000
+	}
+	if s.cur != nil && s.curRecords >= size {
+		s.cur.Close()
+		s.cur = nil
+	}
+	if s.cur == nil {
+		s.seq++
+		name := filepath.Join(s.dir, fmt.Sprintf("%016d%s", s.seq, spoolSuffix))
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return err
+		}
+		s.cur, s.curRecords = f, 0
+	}
+	b, err := encodeSpoolRecord(vl)
+	if err != nil {
+		return err
+	}
+	if _, err := s.cur.Write(b); err != nil {
+		return err
+	}
+	s.curRecords++
+	s.pending++
+	return nil
+}
+
+// Replay writes all spooled value lists to the underlying writer, in
+// the order they were spooled. It stops at the first error caused by
+// collectd being unreachable; value lists that fail for other reasons
+// are dropped, as they would fail again.
+func (s *Spool) Replay(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastTry = time.Now()
+	err := s.replay(ctx)
+	s.errs.Track(err)
+	return err
+}
+
+func (s *Spool) replay(ctx context.Context) error {
+	if s.cur != nil {
+		s.cur.Close()
+		s.cur = nil
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if err := s.replaySegment(ctx, seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Spool) replaySegment(ctx context.Context, seg string) error {
+	b, err := os.ReadFile(seg)
+	if err != nil {
+		return err
+	}
+	var lines [][]byte
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		lines = append(lines, append([]byte(nil), sc.Bytes()...))
+	}
+	for i, line := range lines {
+		vl, err := decodeSpoolRecord(line)
+		if err != nil {
+			// A corrupt record can never be replayed, drop it.
+			s.pending--
+			continue
+		}
+		if err := s.w.Write(ctx, vl); err != nil && isTransient(err) {
+			return s.rewrite(seg, lines[i:], err)
+		}
+		s.pending--
+	}
+	return os.Remove(seg)
+}
+
+// rewrite replaces seg with the lines that could not be replayed.
+func (s *Spool) rewrite(seg string, lines [][]byte, cause error) error {
+	tmp := seg + ".tmp"
+	if err := os.WriteFile(tmp, append(bytes.Join(lines, []byte{'\n'}), '\n'), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, seg); err != nil {
+		return err
+	}
+	return cause
+}
+
+// Pending returns the number of spooled value lists.
+func (s *Spool) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// Health reports the Spool as connected if no value lists are
+// spooled, with the number of spooled value lists as its queue.
+func (s *Spool) Health() Health {
+	s.mu.Lock()
+	pending := s.pending
+	s.mu.Unlock()
+	err, when := s.errs.Last()
+	return Health{
+		Healthy:       true,
+		Connected:     pending == 0,
+		LastError:     err,
+		LastErrorTime: when,
+		Queued:        pending,
+	}
+}
+
+// Close closes the current segment file. It does not close the
+// underlying writer.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cur == nil {
+		return nil
+	}
+	err := s.cur.Close()
+	s.cur = nil
+	return err
+}
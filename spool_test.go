@@ -0,0 +1,65 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSpoolReplaySkipsInvalid(t *testing.T) {
+	up := false
+	var written []ValueList
+	w := WriterFunc(func(ctx context.Context, vl ValueList) error {
+		if !up {
+			return IOError{errors.New("connection refused")}
+		}
+		if err := checkValueList(vl); err != nil {
+			return fmt.Errorf("could not write: %w", err)
+		}
+		written = append(written, vl)
+		return nil
+	})
+	s, err := NewSpool(t.TempDir(), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	vl := func(host string) ValueList {
+		return ValueList{
+			Identifier: Identifier{Host: host, Plugin: "test", Type: "gauge"},
+			Time:       time.Unix(1700000000, 0),
+			Values:     []Value{Gauge(1)},
+		}
+	}
+	ctx := context.Background()
+	for _, host := range []string{"bad\nhost", "good1", "good2"} {
+		if err := s.Write(ctx, vl(host)); err != nil {
+			t.Fatalf("could not spool %q: %s", host, err)
+		}
+	}
+	if n := s.Pending(); n != 3 {
+		t.Fatalf("got %d pending value lists, want 3", n)
+	}
+
+	up = true
+	if err := s.Replay(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Pending(); n != 0 {
+		t.Errorf("got %d pending value lists after replay, want 0", n)
+	}
+	if len(written) != 2 || written[0].Host != "good1" || written[1].Host != "good2" {
+		t.Errorf("replayed %v, want good1 and good2", written)
+	}
+
+	// Invalid value lists are returned, not spooled.
+	if err := s.Write(ctx, vl("bad\nhost")); !errors.Is(err, ErrLineBreak) {
+		t.Errorf("got error %v, want ErrLineBreak", err)
+	}
+	if n := s.Pending(); n != 0 {
+		t.Errorf("got %d pending value lists, want 0", n)
+	}
+}
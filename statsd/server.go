@@ -0,0 +1,376 @@
+// Package statsd implements a StatsD server that aggregates metrics
+// like collectd's statsd plugin and submits them as value lists.
+package statsd // import "honnef.co/go/collectd/statsd"
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// DefaultPort is StatsD's default port.
+const DefaultPort = "8125"
+
+// Server receives StatsD metrics over UDP, aggregates them and writes
+// them to Writer every Interval, with the same identifiers as
+// collectd's statsd plugin: counters become derives of type "derive",
+// gauges gauges of type "gauge", sets the number of their distinct
+// values of type "objects" and timers their average, in seconds, of
+// type "latency" with a type instance of name-average. All are of
+// plugin "statsd" and use the metric name as type instance.
+//
+// The options correspond to the statsd plugin's options of the same
+// names.
+type Server struct {
+	// Addr is the UDP address to listen on. It defaults to StatsD's
+	// default port on all interfaces.
+	Addr string
+	// Writer receives the aggregated value lists.
+	Writer collectd.Writer
+	// Host is the host of the value lists. If it is empty, the host
+	// name is looked up with collectd.Hostname.
+	Host string
+	// Interval is the time between writes. It defaults to ten
+	// seconds.
+	Interval time.Duration
+
+	// DeleteCounters, DeleteTimers, DeleteGauges and DeleteSets
+	// forget metrics of the respective kinds that weren't updated
+	// during an interval, instead of writing them again.
+	DeleteCounters bool
+	DeleteTimers   bool
+	DeleteGauges   bool
+	DeleteSets     bool
+	// CounterSum additionally writes the change of counters during
+	// each interval, as type "count".
+	CounterSum bool
+	// TimerPercentiles are the percentiles of timers to write, as
+	// type instances name-percentile-N.
+	TimerPercentiles []float64
+	// TimerLower, TimerUpper and TimerSum additionally write the
+	// minimum, maximum and sum of timers, and TimerCount the number
+	// of timings, as type "gauge".
+	TimerLower bool
+	TimerUpper bool
+	TimerSum   bool
+	TimerCount bool
+
+	// Logger, if not nil, receives malformed metrics and errors
+	// returned by Writer.
+	Logger *slog.Logger
+
+	errs      health.ErrorTracker
+	listening atomic.Int32
+	stopped   atomic.Bool
+
+	mu      sync.Mutex
+	metrics map[metricKey]*metric
+}
+
+type metricKind byte
+
+const (
+	kindCounter metricKind = 'c'
+	kindGauge   metricKind = 'g'
+	kindTimer   metricKind = 't'
+	kindSet     metricKind = 's'
+)
+
+type metricKey struct {
+	kind metricKind
+	name string
+}
+
+// metric is the state of a metric.
+type metric struct {
+	value   float64
+	sum     float64
+	timings []float64
+	set     map[string]struct{}
+	updated bool
+}
+
+// ListenAndServe listens on s.Addr and serves until ctx is canceled.
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	addr := s.Addr
+	if addr == "" {
+		addr = ":" + DefaultPort
+	} else if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, DefaultPort)
+	}
+	var lc net.ListenConfig
+	conn, err := lc.ListenPacket(ctx, "udp", addr)
+	if err != nil {
+		s.errs.Track(err)
+		return err
+	}
+	return s.Serve(ctx, conn)
+}
+
+// Serve receives metrics on conn until ctx is canceled, writing the
+// aggregated values every interval and once more before returning.
+// conn is closed when Serve returns.
+func (s *Server) Serve(ctx context.Context, conn net.PacketConn) error {
+	s.listening.Add(1)
+	defer s.listening.Add(-1)
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	defer conn.Close()
+
+	interval := cmp.Or(s.Interval, 10*time.Second)
+	// Look up the host name once, not on every flush.
+	host := s.Host
+	if host == "" {
+		var err error
+		if host, err = collectd.Hostname(true); err != nil {
+			host = "localhost"
+		}
+	}
+	flushCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		collectd.Schedule{Interval: interval}.Run(flushCtx, func(ctx context.Context, t time.Time) {
+			s.flush(ctx, host, t, interval)
+		})
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+		s.flush(context.WithoutCancel(ctx), host, time.Now(), interval)
+	}()
+
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.errs.Track(err)
+			s.stopped.Store(true)
+			return err
+		}
+		for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			if err := s.handle(string(line)); err != nil {
+				s.log(ctx, "malformed metric", err, "peer", addr.String())
+			}
+		}
+	}
+}
+
+// handle parses a line of the form name:value|type[|@rate].
+func (s *Server) handle(line string) error {
+	name, rest, ok := strings.Cut(strings.TrimSpace(line), ":")
+	if !ok || name == "" {
+		return fmt.Errorf("statsd: invalid metric %q", line)
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return fmt.Errorf("statsd: invalid metric %q", line)
+	}
+	value, typ := fields[0], fields[1]
+	rate := 1.0
+	if len(fields) > 2 && strings.HasPrefix(fields[2], "@") {
+		r, err := strconv.ParseFloat(fields[2][1:], 64)
+		if err != nil || r <= 0 || r > 1 {
+			return fmt.Errorf("statsd: invalid sample rate in %q", line)
+		}
+		rate = r
+	}
+
+	if typ == "s" {
+		s.update(kindSet, name, func(m *metric) {
+			if m.set == nil {
+				m.set = map[string]struct{}{}
+			}
+			m.set[value] = struct{}{}
+		})
+		return nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("statsd: invalid value in %q", line)
+	}
+	switch typ {
+	case "c":
+		s.update(kindCounter, name, func(m *metric) {
+			m.value += f / rate
+			m.sum += f / rate
+		})
+	case "g":
+		relative := value[0] == '+' || value[0] == '-'
+		s.update(kindGauge, name, func(m *metric) {
+			if relative {
+				m.value += f
+			} else {
+				m.value = f
+			}
+		})
+	case "ms", "h":
+		s.update(kindTimer, name, func(m *metric) {
+			m.timings = append(m.timings, f/1000)
+		})
+	default:
+		return fmt.Errorf("statsd: invalid metric type in %q", line)
+	}
+	return nil
+}
+
+func (s *Server) update(kind metricKind, name string, fn func(*metric)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.metrics == nil {
+		s.metrics = map[metricKey]*metric{}
+	}
+	k := metricKey{kind, name}
+	m, ok := s.metrics[k]
+	if !ok {
+		m = &metric{}
+		s.metrics[k] = m
+	}
+	m.updated = true
+	fn(m)
+}
+
+// flush writes all metrics and resets their per-interval state.
+func (s *Server) flush(ctx context.Context, host string, t time.Time, interval time.Duration) {
+	var vls []collectd.ValueList
+	add := func(typ, instance string, v collectd.Value) {
+		vls = append(vls, collectd.ValueList{
+			Identifier: collectd.Identifier{Host: host, Plugin: "statsd", Type: typ, TypeInstance: instance},
+			Time:       t,
+			Interval:   interval,
+			Values:     []collectd.Value{v},
+		})
+	}
+
+	s.mu.Lock()
+	keys := make([]metricKey, 0, len(s.metrics))
+	for k := range s.metrics {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].kind != keys[j].kind {
+			return keys[i].kind < keys[j].kind
+		}
+		return keys[i].name < keys[j].name
+	})
+	for _, k := range keys {
+		m := s.metrics[k]
+		if !m.updated && s.deleteStale(k.kind) {
+			delete(s.metrics, k)
+			continue
+		}
+		switch k.kind {
+		case kindCounter:
+			add("derive", k.name, collectd.Derive(int64(m.value)))
+			if s.CounterSum {
+				add("count", k.name, collectd.Gauge(m.sum))
+			}
+			m.sum = 0
+		case kindGauge:
+			add("gauge", k.name, collectd.Gauge(m.value))
+		case kindSet:
+			add("objects", k.name, collectd.Gauge(len(m.set)))
+			m.set = nil
+		case kindTimer:
+			s.addTimer(add, k.name, m.timings)
+			m.timings = m.timings[:0]
+		}
+		m.updated = false
+	}
+	s.mu.Unlock()
+
+	for _, vl := range vls {
+		if err := s.Writer.Write(ctx, vl); err != nil {
+			s.log(ctx, "could not write value list", err, "identifier", vl.Identifier.String())
+		}
+	}
+}
+
+func (s *Server) deleteStale(kind metricKind) bool {
+	switch kind {
+	case kindCounter:
+		return s.DeleteCounters
+	case kindGauge:
+		return s.DeleteGauges
+	case kindTimer:
+		return s.DeleteTimers
+	default:
+		return s.DeleteSets
+	}
+}
+
+// addTimer adds the value lists of a timer. Without timings, all
+// values but the count are NaN.
+func (s *Server) addTimer(add func(typ, instance string, v collectd.Value), name string, timings []float64) {
+	sort.Float64s(timings)
+	lower, upper, sum, avg := math.NaN(), math.NaN(), 0.0, math.NaN()
+	if len(timings) > 0 {
+		lower, upper = timings[0], timings[len(timings)-1]
+		for _, t := range timings {
+			sum += t
+		}
+		avg = sum / float64(len(timings))
+	} else {
+		sum = math.NaN()
+	}
+	add("latency", name+"-average", collectd.Gauge(avg))
+	if s.TimerLower {
+		add("latency", name+"-lower", collectd.Gauge(lower))
+	}
+	if s.TimerUpper {
+		add("latency", name+"-upper", collectd.Gauge(upper))
+	}
+	if s.TimerSum {
+		add("latency", name+"-sum", collectd.Gauge(sum))
+	}
+	for _, p := range s.TimerPercentiles {
+		v := math.NaN()
+		if len(timings) > 0 {
+			i := int(math.Ceil(p/100*float64(len(timings)))) - 1
+			v = timings[min(max(i, 0), len(timings)-1)]
+		}
+		add("latency", name+"-percentile-"+strconv.FormatFloat(p, 'f', -1, 64), collectd.Gauge(v))
+	}
+	if s.TimerCount {
+		add("gauge", name+"-count", collectd.Gauge(len(timings)))
+	}
+}
+
+// Health reports the server as healthy unless it stopped because of
+// an error, and as connected while it is serving.
+func (s *Server) Health() collectd.Health {
+	err, when := s.errs.Last()
+	return collectd.Health{
+		Healthy:       !s.stopped.Load(),
+		Connected:     s.listening.Load() > 0,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (s *Server) log(ctx context.Context, msg string, err error, args ...any) {
+	s.errs.Track(err)
+	if s.Logger != nil {
+		s.Logger.WarnContext(ctx, msg, append([]any{"error", err}, args...)...)
+	}
+}
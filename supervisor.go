@@ -0,0 +1,234 @@
+package collectd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"honnef.co/go/collectd/internal/health"
+)
+
+// Program describes an exec plugin style program: an executable
+// that periodically prints PUTVAL and PUTNOTIF commands to its
+// standard output.
+type Program struct {
+	Path string
+	Args []string
+	// Env holds additional environment variables of the form
+	// key=value.
+	Env []string
+}
+
+// A Supervisor runs exec plugin style programs the way collectd's
+// exec plugin does, without needing a collectd daemon. Values and
+// notifications printed by the programs are passed to the handler
+// functions. Programs that exit are restarted with exponential
+// backoff.
+type Supervisor struct {
+	Programs []Program
+	// Hostname and Interval are passed to the programs as
+	// COLLECTD_HOSTNAME and COLLECTD_INTERVAL.
+	Hostname string
+	Interval time.Duration
+	// TypesDB is used to type the values printed by the programs.
+	// If it is nil, all values are treated as gauges.
+	TypesDB TypesDB
+
+	// HandleValues and HandleNotification are called for every
+	// value list and notification read from a program. They may be
+	// called concurrently.
+	HandleValues       func(ValueList)
+	HandleNotification func(Notification)
+
+	// MinBackoff and MaxBackoff bound the delay before restarting
+	// a program. They default to one second and one minute.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// StopTimeout is how long a program may take to exit after
+	// being asked to terminate before it gets killed. It defaults
+	// to five seconds.
+	StopTimeout time.Duration
+
+	// Logger, if not nil, receives the programs' standard error and
+	// any parse errors.
+	Logger *slog.Logger
+
+	errs    health.ErrorTracker
+	running atomic.Int64
+}
+
+// Run runs all programs until ctx is canceled.
+func (s *Supervisor) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, p := range s.Programs {
+		wg.Add(1)
+		go func(p Program) {
+			defer wg.Done()
+			s.supervise(ctx, p)
+		}(p)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (s *Supervisor) supervise(ctx context.Context, p Program) {
+	minb, maxb := s.MinBackoff, s.MaxBackoff
+	if minb <= 0 {
+		minb = time.Second
+	}
+	if maxb <= 0 {
+		maxb = time.Minute
+	}
+	backoff := minb
+	for {
+		start := time.Now()
+		err := s.run(ctx, p)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New(p.Path + " exited")
+		}
+		s.errs.Track(err)
+		if time.Since(start) > maxb {
+			// The program ran for a good while, don't penalize it
+			// for earlier crashes.
+			backoff = minb
+		}
+		s.log("program exited, restarting", "path", p.Path, "error", err, "backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+		backoff *= 2
+		if backoff > maxb {
+			backoff = maxb
+		}
+	}
+}
+
+func (s *Supervisor) run(ctx context.Context, p Program) error {
+	cmd := exec.CommandContext(ctx, p.Path, p.Args...)
+	cmd.Env = append(os.Environ(), p.Env...)
+	if s.Hostname != "" {
+		cmd.Env = append(cmd.Env, "COLLECTD_HOSTNAME="+s.Hostname)
+	}
+	if s.Interval > 0 {
+		cmd.Env = append(cmd.Env, "COLLECTD_INTERVAL="+strconv.FormatFloat(s.Interval.Seconds(), 'f', -1, 64))
+	}
+	cmd.Cancel = func() error {
+		return terminate(cmd.Process)
+	}
+	cmd.WaitDelay = s.StopTimeout
+	if cmd.WaitDelay <= 0 {
+		cmd.WaitDelay = 5 * time.Second
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	s.running.Add(1)
+	defer s.running.Add(-1)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		s.readCommands(p, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		sc := bufio.NewScanner(stderr)
+		for sc.Scan() {
+			s.log("program error output", "path", p.Path, "line", sc.Text())
+		}
+		s.drain(p, stderr, sc.Err())
+	}()
+	wg.Wait()
+	return cmd.Wait()
+}
+
+// Health reports the Supervisor as connected while all of its programs
+// are running.
+func (s *Supervisor) Health() Health {
+	err, when := s.errs.Last()
+	return Health{
+		Healthy:       true,
+		Connected:     s.running.Load() == int64(len(s.Programs)),
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (s *Supervisor) readCommands(p Program, r io.Reader) {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields, err := splitFields(sc.Text())
+		if err != nil {
+			s.log("could not parse line", "path", p.Path, "line", sc.Text(), "error", err)
+			continue
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "PUTVAL":
+			vls, err := parsePutval(fields[1:], s.TypesDB)
+			if err != nil {
+				s.log("could not parse line", "path", p.Path, "line", sc.Text(), "error", err)
+				continue
+			}
+			if s.HandleValues != nil {
+				for _, vl := range vls {
+					s.HandleValues(vl)
+				}
+			}
+		case "PUTNOTIF":
+			n, err := parsePutnotif(fields[1:])
+			if err != nil {
+				s.log("could not parse line", "path", p.Path, "line", sc.Text(), "error", err)
+				continue
+			}
+			if s.HandleNotification != nil {
+				s.HandleNotification(n)
+			}
+		default:
+			s.log("unknown command", "path", p.Path, "line", sc.Text())
+		}
+	}
+	s.drain(p, r, sc.Err())
+}
+
+// drain logs err, the error that made reading from r stop, and then
+// discards the rest of r, so that the program doesn't block writing
+// to a full pipe and can be restarted once it exits.
+func (s *Supervisor) drain(p Program, r io.Reader, err error) {
+	if err != nil {
+		s.errs.Track(err)
+		s.log("could not read program output", "path", p.Path, "error", err)
+	}
+	io.Copy(io.Discard, r)
+}
+
+func (s *Supervisor) log(msg string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Error(msg, args...)
+	}
+}
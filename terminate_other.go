@@ -0,0 +1,11 @@
+//go:build !unix
+
+package collectd
+
+import "os"
+
+// terminate kills the process; platforms other than Unix have no
+// portable way of asking a process to exit.
+func terminate(p *os.Process) error {
+	return p.Kill()
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package collectd
+
+import (
+	"os"
+	"syscall"
+)
+
+// terminate asks a process to exit, giving it a chance to clean up.
+func terminate(p *os.Process) error {
+	return p.Signal(syscall.SIGTERM)
+}
@@ -0,0 +1,91 @@
+package collectd
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+// traceRW copies all traffic of rw to w.
+type traceRW struct {
+	rw io.ReadWriteCloser
+
+	mu sync.Mutex
+	w  io.Writer
+	// sent and received hold incomplete lines.
+	sent, received []byte
+}
+
+func (t *traceRW) Read(b []byte) (int, error) {
+	n, err := t.rw.Read(b)
+	t.dump('<', &t.received, b[:n])
+	return n, err
+}
+
+func (t *traceRW) Write(b []byte) (int, error) {
+	n, err := t.rw.Write(b)
+	t.dump('>', &t.sent, b[:n])
+	return n, err
+}
+
+// Close closes the connection and writes the incomplete lines, if
+// any.
+func (t *traceRW) Close() error {
+	err := t.rw.Close()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flush('>', t.sent)
+	t.flush('<', t.received)
+	t.sent, t.received = nil, nil
+	return err
+}
+
+// SetDeadline passes deadlines through to the underlying connection,
+// if it supports them.
+func (t *traceRW) SetDeadline(d time.Time) error {
+	if c, ok := t.rw.(interface{ SetDeadline(time.Time) error }); ok {
+		return c.SetDeadline(d)
+	}
+	return nil
+}
+
+// dump writes the complete lines of *partial followed by b, keeping
+// the rest in *partial, so that lines spanning several reads or
+// writes are traced as one.
+func (t *traceRW) dump(dir byte, partial *[]byte, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*partial = append(*partial, b...)
+	i := bytes.LastIndexByte(*partial, '\n')
+	if i < 0 {
+		return
+	}
+	t.flush(dir, (*partial)[:i+1])
+	*partial = append((*partial)[:0], (*partial)[i+1:]...)
+}
+
+// flush writes b, prefixing each of its lines with a timestamp and
+// dir. It must be called with t.mu held.
+func (t *traceRW) flush(dir byte, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	prefix := time.Now().Format(time.RFC3339Nano) + " " + string(dir) + " "
+	var buf []byte
+	for len(b) > 0 {
+		line := b
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			b = nil
+		}
+		buf = append(buf, prefix...)
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	t.w.Write(buf)
+}
@@ -0,0 +1,192 @@
+package collectd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecordTranscript returns a wrapper of rw, to be passed to New, that
+// writes all commands sent and responses received to w, for replaying
+// them later with ReplayTranscript. In the transcript, each line of a
+// command is prefixed with "> " and each line of a response with
+// "< ". Pipelined commands, such as those of Conn.GetValues, are
+// followed by all of their responses. Unlike the output of WithTrace,
+// transcripts contain no timestamps, so that they can be kept as
+// golden files.
+//
+// Errors writing to w are returned by Close.
+func RecordTranscript(rw io.ReadWriteCloser, w io.Writer) io.ReadWriteCloser {
+	return &recorder{rw: rw, w: w}
+}
+
+type recorder struct {
+	rw io.ReadWriteCloser
+
+	mu sync.Mutex
+	w  io.Writer
+	// sent and received hold incomplete lines.
+	sent, received []byte
+	err            error
+}
+
+func (r *recorder) Read(b []byte) (int, error) {
+	n, err := r.rw.Read(b)
+	r.record("< ", &r.received, b[:n])
+	return n, err
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	n, err := r.rw.Write(b)
+	r.record("> ", &r.sent, b[:n])
+	return n, err
+}
+
+// SetDeadline passes deadlines through to the underlying connection,
+// if it supports them.
+func (r *recorder) SetDeadline(d time.Time) error {
+	if c, ok := r.rw.(interface{ SetDeadline(time.Time) error }); ok {
+		return c.SetDeadline(d)
+	}
+	return nil
+}
+
+func (r *recorder) Close() error {
+	err := r.rw.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err == nil {
+		err = r.err
+	}
+	return err
+}
+
+// record writes the complete lines of *partial followed by b, keeping
+// the rest in *partial.
+func (r *recorder) record(prefix string, partial *[]byte, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*partial = append(*partial, b...)
+	var buf []byte
+	for {
+		i := bytes.IndexByte(*partial, '\n')
+		if i < 0 {
+			break
+		}
+		buf = append(buf, prefix...)
+		buf = append(buf, bytes.TrimSuffix((*partial)[:i], []byte("\r"))...)
+		buf = append(buf, '\n')
+		*partial = (*partial)[i+1:]
+	}
+	if len(buf) == 0 || r.err != nil {
+		return
+	}
+	_, r.err = r.w.Write(buf)
+}
+
+// exchange is a command of a transcript and the response lines
+// following it. For pipelined commands, the last command is followed
+// by the responses to all of them.
+type exchange struct {
+	command  string
+	response []string
+}
+
+// Replayer is a fake connection, to be passed to New, that answers
+// commands with the responses of a transcript recorded by
+// RecordTranscript, for regression tests against captured sessions.
+// Commands must be sent in the order of the transcript and match it
+// exactly; this includes timestamps, so value lists should be sent
+// with fixed times. Writing a command that doesn't match, or one
+// after the end of the transcript, fails, leaving the Conn broken.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []exchange
+	pending   []byte
+	out       bytes.Buffer
+}
+
+// ReplayTranscript reads a transcript recorded by RecordTranscript.
+// Empty lines and lines starting with # are ignored, so that
+// transcripts can be edited and annotated.
+func ReplayTranscript(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := sc.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "> "):
+			rp.exchanges = append(rp.exchanges, exchange{command: line[2:]})
+		case strings.HasPrefix(line, "< "):
+			if len(rp.exchanges) == 0 {
+				return nil, fmt.Errorf("collectd: transcript line %d: response without command", n)
+			}
+			e := &rp.exchanges[len(rp.exchanges)-1]
+			e.response = append(e.response, line[2:])
+		default:
+			return nil, fmt.Errorf("collectd: transcript line %d: missing > or < prefix", n)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return rp, nil
+}
+
+// Read reads the responses to the commands written so far. It returns
+// io.EOF if there are none left.
+func (rp *Replayer) Read(b []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	if rp.out.Len() == 0 {
+		return 0, io.EOF
+	}
+	return rp.out.Read(b)
+}
+
+// Write checks commands against the transcript and queues their
+// responses.
+func (rp *Replayer) Write(b []byte) (int, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.pending = append(rp.pending, b...)
+	for {
+		i := bytes.IndexByte(rp.pending, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		command := string(bytes.TrimSuffix(rp.pending[:i], []byte("\r")))
+		rp.pending = rp.pending[i+1:]
+		if len(rp.exchanges) == 0 {
+			return 0, fmt.Errorf("collectd: command %q is past the end of the transcript", command)
+		}
+		e := rp.exchanges[0]
+		if command != e.command {
+			return 0, fmt.Errorf("collectd: command %q does not match transcript, which expects %q", command, e.command)
+		}
+		rp.exchanges = rp.exchanges[1:]
+		for _, line := range e.response {
+			rp.out.WriteString(line)
+			rp.out.WriteByte('\n')
+		}
+	}
+}
+
+// Close implements io.Closer. It does nothing.
+func (rp *Replayer) Close() error {
+	return nil
+}
+
+// Remaining returns the number of commands of the transcript that
+// haven't been sent yet, for checking that a test sent all of them.
+func (rp *Replayer) Remaining() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return len(rp.exchanges)
+}
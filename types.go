@@ -0,0 +1,181 @@
+package collectd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Identifier identifies a value list. Its string form is
+// host/plugin-instance/type-instance, where the instances are
+// optional.
+type Identifier struct {
+	Host           string
+	Plugin         string
+	PluginInstance string
+	Type           string
+	TypeInstance   string
+}
+
+// String returns the identifier in the form used by the plain text
+// protocol.
+func (id Identifier) String() string {
+	s := id.Host + "/" + id.Plugin
+	if id.PluginInstance != "" {
+		s += "-" + id.PluginInstance
+	}
+	s += "/" + id.Type
+	if id.TypeInstance != "" {
+		s += "-" + id.TypeInstance
+	}
+	return s
+}
+
+// ParseIdentifier parses an identifier of the form
+// host/plugin-instance/type-instance.
+func ParseIdentifier(s string) (Identifier, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return Identifier{}, fmt.Errorf("invalid identifier %q", s)
+	}
+	var id Identifier
+	id.Host = parts[0]
+	id.Plugin, id.PluginInstance, _ = strings.Cut(parts[1], "-")
+	id.Type, id.TypeInstance, _ = strings.Cut(parts[2], "-")
+	return id, nil
+}
+
+// DSType is the type of a data source.
+type DSType int
+
+// The data source types, using collectd's numbering.
+const (
+	DSTypeCounter  DSType = 0
+	DSTypeGauge    DSType = 1
+	DSTypeDerive   DSType = 2
+	DSTypeAbsolute DSType = 3
+)
+
+func (t DSType) String() string {
+	switch t {
+	case DSTypeCounter:
+		return "counter"
+	case DSTypeGauge:
+		return "gauge"
+	case DSTypeDerive:
+		return "derive"
+	case DSTypeAbsolute:
+		return "absolute"
+	default:
+		return fmt.Sprintf("DSType(%d)", int(t))
+	}
+}
+
+// parseDSType parses the name of a data source type, ignoring case.
+func parseDSType(s string) (DSType, bool) {
+	switch strings.ToLower(s) {
+	case "counter":
+		return DSTypeCounter, true
+	case "gauge":
+		return DSTypeGauge, true
+	case "derive":
+		return DSTypeDerive, true
+	case "absolute":
+		return DSTypeAbsolute, true
+	default:
+		return 0, false
+	}
+}
+
+// A Value is a single data source value. It is one of Gauge, Derive,
+// Counter or Absolute.
+type Value interface {
+	DSType() DSType
+}
+
+// Gauge is a value that is stored as is. NaN represents an undefined
+// value.
+type Gauge float64
+
+// Derive is a signed value of which collectd stores the rate of
+// change.
+type Derive int64
+
+// Counter is an unsigned value of which collectd stores the rate of
+// change, allowing it to wrap around.
+type Counter uint64
+
+// Absolute is an unsigned value that is reset every time it is read.
+type Absolute uint64
+
+func (Gauge) DSType() DSType    { return DSTypeGauge }
+func (Derive) DSType() DSType   { return DSTypeDerive }
+func (Counter) DSType() DSType  { return DSTypeCounter }
+func (Absolute) DSType() DSType { return DSTypeAbsolute }
+
+// ValueList is a set of values for one identifier at one point in
+// time.
+type ValueList struct {
+	Identifier
+	// Time is the time the values were collected. The zero time
+	// lets the receiver pick the current time.
+	Time time.Time
+	// Interval is the collection interval. Zero means the
+	// receiver's default interval.
+	Interval time.Duration
+	Values   []Value
+	// Meta is optional metadata, with values of the types that
+	// collectd supports: string, int64, uint64, float64 and bool.
+	// Only some formats, such as JSON, carry it.
+	Meta map[string]any
+}
+
+// Severity is the severity of a notification.
+type Severity int
+
+// The severities, using collectd's numbering.
+const (
+	SeverityFailure Severity = 1
+	SeverityWarning Severity = 2
+	SeverityOkay    Severity = 4
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityFailure:
+		return "failure"
+	case SeverityWarning:
+		return "warning"
+	case SeverityOkay:
+		return "okay"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ParseSeverity parses the textual representation of a severity.
+func ParseSeverity(s string) (Severity, error) {
+	switch strings.ToLower(s) {
+	case "failure":
+		return SeverityFailure, nil
+	case "warning":
+		return SeverityWarning, nil
+	case "okay":
+		return SeverityOkay, nil
+	default:
+		return 0, errors.New("invalid severity " + s)
+	}
+}
+
+// Notification is a message about a (possible) problem, optionally
+// related to an identifier. Any fields of the identifier may be
+// empty.
+type Notification struct {
+	Identifier
+	Severity Severity
+	// Time is the time of the notification. The zero time lets the
+	// receiver pick the current time.
+	Time    time.Time
+	Message string
+}
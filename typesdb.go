@@ -0,0 +1,133 @@
+package collectd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DataSource describes one value of a type, as defined in types.db.
+type DataSource struct {
+	Name string
+	Type DSType
+	// Min and Max are the allowed range of values. NaN means
+	// unbounded.
+	Min float64
+	Max float64
+}
+
+// TypesDB maps type names to their data sources, as defined by
+// collectd's types.db.
+type TypesDB map[string][]DataSource
+
+// DSNames returns the data source names of vl's values. If vl's type
+// is unknown or doesn't match the number of values, they are named
+// "value" for a single value, and "value0", "value1" and so on
+// otherwise. db may be nil.
+func (db TypesDB) DSNames(vl ValueList) []string {
+	if dss, ok := db[vl.Type]; ok && len(dss) == len(vl.Values) {
+		names := make([]string, len(dss))
+		for i, ds := range dss {
+			names[i] = ds.Name
+		}
+		return names
+	}
+	if len(vl.Values) == 1 {
+		return []string{"value"}
+	}
+	names := make([]string, len(vl.Values))
+	for i := range names {
+		names[i] = "value" + strconv.Itoa(i)
+	}
+	return names
+}
+
+// ReadTypesDB reads types.db files and merges them into one TypesDB.
+// Later files override types of earlier ones.
+func ReadTypesDB(paths ...string) (TypesDB, error) {
+	db := TypesDB{}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		err = db.parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	return db, nil
+}
+
+// ParseTypesDB parses a types.db file.
+func ParseTypesDB(r io.Reader) (TypesDB, error) {
+	db := TypesDB{}
+	if err := db.parse(r); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Lines have the form
+//
+//	type  name:GAUGE:0:U, name2:DERIVE:0:U
+func (db TypesDB) parse(r io.Reader) error {
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return fmt.Errorf("line %d: missing data sources", n)
+		}
+		specs := strings.Split(strings.Join(fields[1:], ""), ",")
+		dss := make([]DataSource, 0, len(specs))
+		for _, spec := range specs {
+			ds, err := parseDataSource(spec)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", n, err)
+			}
+			dss = append(dss, ds)
+		}
+		db[fields[0]] = dss
+	}
+	return s.Err()
+}
+
+func parseDataSource(spec string) (DataSource, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 4 {
+		return DataSource{}, fmt.Errorf("invalid data source %q", spec)
+	}
+	ds := DataSource{Name: parts[0]}
+	var ok bool
+	if ds.Type, ok = parseDSType(parts[1]); !ok {
+		return DataSource{}, fmt.Errorf("invalid data source type %q", parts[1])
+	}
+	var err error
+	if ds.Min, err = parseBound(parts[2]); err != nil {
+		return DataSource{}, err
+	}
+	if ds.Max, err = parseBound(parts[3]); err != nil {
+		return DataSource{}, err
+	}
+	return ds, nil
+}
+
+func parseBound(s string) (float64, error) {
+	if s == "U" {
+		return math.NaN(), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid bound %q", s)
+	}
+	return f, nil
+}
@@ -0,0 +1,27 @@
+package collectd
+
+import (
+	"errors"
+	"net"
+)
+
+var (
+	errAbstractUnsupported = errors.New("abstract unix sockets are not supported on this platform")
+	errEmptySocketPath     = errors.New("empty unix socket path")
+)
+
+// resolveUnix resolves the name of a unix socket. Names starting with
+// @ or a NUL byte denote abstract sockets, which are only supported on
+// Linux.
+func resolveUnix(name string) (*net.UnixAddr, error) {
+	if name == "" {
+		return nil, &net.OpError{Op: "resolve", Net: "unix", Err: errEmptySocketPath}
+	}
+	if name[0] == 0 {
+		name = "@" + name[1:]
+	}
+	if name[0] == '@' && !abstractSockets {
+		return nil, &net.OpError{Op: "resolve", Net: "unix", Err: errAbstractUnsupported}
+	}
+	return net.ResolveUnixAddr("unix", name)
+}
@@ -0,0 +1,4 @@
+package collectd
+
+// The kernel maps names starting with @ to the abstract namespace.
+const abstractSockets = true
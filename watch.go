@@ -0,0 +1,108 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// WatchUpdate is an update of an identifier's values observed by
+// Watch.
+type WatchUpdate struct {
+	Identifier Identifier
+	// Time is the time of the update, as reported by LISTVAL.
+	Time   time.Time
+	Values map[string]float64
+}
+
+// Watch polls collectd every period and sends the values of
+// identifiers matching pattern on the returned channel whenever they
+// are updated. pattern is matched like the patterns of a Group. See
+// WatchGroup.
+func (c *Conn) Watch(ctx context.Context, pattern string, period time.Duration) <-chan WatchUpdate {
+	return c.WatchGroup(ctx, Group{Patterns: []string{pattern}}, period)
+}
+
+// WatchGroup polls collectd every period and sends the values of
+// identifiers in g on the returned channel whenever they are updated.
+// Updates are detected by comparing the times reported by LISTVAL,
+// and only the values of updated identifiers are fetched with GETVAL.
+// The first poll reports all identifiers in g.
+//
+// Because collectd's cache only holds the most recent values, updates
+// that happen more often than period are coalesced. If period is not
+// positive, it defaults to ten seconds. Failed polls are retried at
+// the next period, and their errors are reported by the connection's
+// Health. The channel is closed once ctx is canceled.
+func (c *Conn) WatchGroup(ctx context.Context, g Group, period time.Duration) <-chan WatchUpdate {
+	if period <= 0 {
+		period = 10 * time.Second
+	}
+	ch := make(chan WatchUpdate)
+	go func() {
+		defer close(ch)
+		seen := map[string]time.Time{}
+		Schedule{Interval: period}.Run(ctx, func(ctx context.Context, _ time.Time) {
+			for _, u := range c.pollUpdates(g, seen) {
+				select {
+				case ch <- u:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}()
+	return ch
+}
+
+// pollUpdates returns the updates of identifiers in g since the times
+// recorded in seen, and updates seen. Errors are tracked for Health.
+func (c *Conn) pollUpdates(g Group, seen map[string]time.Time) []WatchUpdate {
+	vals, err := c.ListValues()
+	if err != nil {
+		c.errs.Track(err)
+		return nil
+	}
+	for name := range seen {
+		if _, ok := vals[name]; !ok {
+			delete(seen, name)
+		}
+	}
+	var ids []Identifier
+	for name, t := range vals {
+		if !g.Match(name) || seen[name].Equal(t) {
+			continue
+		}
+		id, err := ParseIdentifier(name)
+		if err != nil {
+			c.errs.Track(err)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	values, err := c.GetValues(ids)
+	if err != nil {
+		c.errs.Track(err)
+		var gerr *GetValuesError
+		if !errors.As(err, &gerr) {
+			return nil
+		}
+	}
+	var out []WatchUpdate
+	for _, id := range ids {
+		v, ok := values[id]
+		if !ok {
+			// Try again at the next poll.
+			continue
+		}
+		name := id.String()
+		seen[name] = vals[name]
+		out = append(out, WatchUpdate{Identifier: id, Time: vals[name], Values: v})
+	}
+	return out
+}
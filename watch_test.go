@@ -0,0 +1,44 @@
+package collectd_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"honnef.co/go/collectd/collectdtest"
+)
+
+func TestWatchNonPositivePeriod(t *testing.T) {
+	srv := collectdtest.NewServer(nil)
+	defer srv.Close()
+	c := dial(t, srv)
+
+	// This used to panic in the watching goroutine, crashing the
+	// process.
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := c.Watch(ctx, "*", 0)
+	cancel()
+	for range ch {
+	}
+}
+
+func TestWatchRetriesFailedPolls(t *testing.T) {
+	srv := collectdtest.NewServer(nil)
+	defer srv.Close()
+	srv.Put(manyValueLists(1)...)
+	srv.FailNext("LISTVAL", 1, "cache unavailable")
+	c := dial(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	u, ok := <-c.Watch(ctx, "example.com/test/*", 20*time.Millisecond)
+	if !ok {
+		t.Fatal("got no update after the failed poll")
+	}
+	if got := u.Identifier.TypeInstance; got != "0" {
+		t.Errorf("got update of %s, want example.com/test/gauge-0", u.Identifier)
+	}
+	if h := c.Health(); h.LastError == nil {
+		t.Error("failed poll wasn't reported by Health")
+	}
+}
@@ -0,0 +1,404 @@
+package writehttp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// DefaultBufferSize is the default size of a request body, matching
+// write_http's BufferSize default.
+const DefaultBufferSize = 4096
+
+// A ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithFlushInterval sets the maximum time a value list is buffered
+// before it is sent. The default is ten seconds.
+func WithFlushInterval(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.flushInterval = d
+	}
+}
+
+// WithBufferSize sets the size in bytes at which buffered value lists
+// are sent. Value lists larger than the buffer are sent on their own.
+// The default is DefaultBufferSize.
+func WithBufferSize(n int) ClientOption {
+	return func(c *Client) {
+		c.bufferSize = n
+	}
+}
+
+// WithRetries sets how often a failed request is retried, waiting
+// backoff before the first retry and doubling the wait after each
+// one. Requests are retried after network errors and responses with
+// status 429 or 5xx. The default is two retries, starting after one
+// second.
+func WithRetries(n int, backoff time.Duration) ClientOption {
+	return func(c *Client) {
+		c.retries, c.backoff = n, backoff
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to send requests, for
+// example to configure TLS. The default is http.DefaultClient.
+func WithHTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.hc = hc
+	}
+}
+
+// WithBasicAuth authenticates requests with HTTP basic
+// authentication, like write_http's User and Password options.
+func WithBasicAuth(username, password string) ClientOption {
+	return func(c *Client) {
+		c.username, c.password, c.auth = username, password, true
+	}
+}
+
+// WithHeader adds a header to all requests, like write_http's Header
+// option.
+func WithHeader(key, value string) ClientOption {
+	return func(c *Client) {
+		c.header.Add(key, value)
+	}
+}
+
+// WithTypesDB sets the types used to fill in data source names.
+// Without it, names are only known for types with a single data
+// source.
+func WithTypesDB(types collectd.TypesDB) ClientOption {
+	return func(c *Client) {
+		c.types = types
+	}
+}
+
+// WithErrorHandler sets a function that is called with errors that
+// occur when the client sends value lists in the background, which
+// would otherwise only be reported by Health.
+func WithErrorHandler(fn func(c *Client, err error)) ClientOption {
+	return func(c *Client) {
+		c.onError = fn
+	}
+}
+
+// StatusError is returned when the server responds with a status
+// other than 2xx.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string { return "writehttp: server responded with " + e.Status }
+
+// temporary reports whether the request may succeed if retried.
+func (e *StatusError) temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// Client sends value lists to a write_http endpoint, such as a
+// Handler, in collectd's JSON format. They are buffered and sent when
+// the buffer is full or when the flush interval has passed,
+// whichever happens first.
+type Client struct {
+	url           string
+	flushInterval time.Duration
+	bufferSize    int
+	retries       int
+	backoff       time.Duration
+	hc            *http.Client
+	auth          bool
+	username      string
+	password      string
+	header        http.Header
+	types         collectd.TypesDB
+	onError       func(*Client, error)
+
+	done chan struct{}
+	wg   sync.WaitGroup
+	// ctx is the context of requests. Because a request carries the
+	// value lists of many callers, it doesn't use theirs.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// sending counts requests in flight, which Close waits for.
+	sending sync.WaitGroup
+
+	errs health.ErrorTracker
+
+	mu      sync.Mutex
+	buf     []byte
+	n       int
+	closed  bool
+	failing bool
+}
+
+var (
+	_ collectd.Writer      = (*Client)(nil)
+	_ collectd.BatchWriter = (*Client)(nil)
+)
+
+// NewClient returns a Client that POSTs value lists to rawURL.
+func NewClient(rawURL string, opts ...ClientOption) (*Client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("writehttp: unsupported URL scheme %q", u.Scheme)
+	}
+	c := &Client{
+		url:           rawURL,
+		flushInterval: 10 * time.Second,
+		bufferSize:    DefaultBufferSize,
+		retries:       2,
+		backoff:       time.Second,
+		hc:            http.DefaultClient,
+		header:        http.Header{},
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.flushInterval <= 0 {
+		return nil, errors.New("writehttp: flush interval must be positive")
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	c.wg.Add(1)
+	go c.flusher()
+	return c, nil
+}
+
+func (c *Client) flusher() {
+	defer c.wg.Done()
+	t := time.NewTicker(c.flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := c.Flush(context.Background()); err != nil && c.onError != nil {
+				c.onError(c, err)
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Write adds vl to the buffer. If vl doesn't fit, the buffer is sent
+// first, and the error of sending it is returned. ctx is only checked
+// before adding vl; requests are not bound to the contexts of
+// individual callers, as they carry the value lists of many.
+func (c *Client) Write(ctx context.Context, vl collectd.ValueList) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return collectd.ErrClosed
+	}
+	full, err := c.add(vl)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return c.send(full)
+}
+
+// WriteBatch adds vls to the buffer, sending it whenever it fills up.
+// If any of the value lists fail, the returned error is a
+// *collectd.BatchError. Errors of sending the buffer are reported for
+// the value list that didn't fit into it.
+func (c *Client) WriteBatch(ctx context.Context, vls []collectd.ValueList) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	type pending struct {
+		i    int
+		body []byte
+	}
+	var bodies []pending
+	errs := make([]error, len(vls))
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return collectd.ErrClosed
+	}
+	for i, vl := range vls {
+		full, err := c.add(vl)
+		errs[i] = err
+		if full != nil {
+			bodies = append(bodies, pending{i, full})
+		}
+	}
+	c.mu.Unlock()
+	for _, p := range bodies {
+		if err := c.send(p.body); err != nil {
+			errs[p.i] = err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return &collectd.BatchError{Errors: errs}
+		}
+	}
+	return nil
+}
+
+// add appends vl to the buffer, which holds a JSON array without its
+// closing bracket. If vl doesn't fit, it returns the previous contents
+// of the buffer, as by take, which the caller must send. It must be
+// called with c.mu held.
+func (c *Client) add(vl collectd.ValueList) (full []byte, err error) {
+	b, err := collectd.AppendJSON(nil, vl, c.types)
+	if err != nil {
+		return nil, err
+	}
+	if c.n > 0 && len(c.buf)+1+len(b)+1 > c.bufferSize {
+		full = c.take()
+	}
+	if c.n == 0 {
+		c.buf = append(c.buf[:0], '[')
+	} else {
+		c.buf = append(c.buf, ',')
+	}
+	c.buf = append(c.buf, b...)
+	c.n++
+	return full, nil
+}
+
+// take empties the buffer and returns its contents as a complete JSON
+// array, or nil if it is empty. The result must be passed to send. It
+// must be called with c.mu held.
+func (c *Client) take() []byte {
+	if c.n == 0 {
+		return nil
+	}
+	body := append(c.buf, ']')
+	c.buf, c.n = nil, 0
+	c.sending.Add(1)
+	return body
+}
+
+// Flush sends the buffered value lists, if any. Like for Write, ctx
+// is only checked before taking them from the buffer.
+func (c *Client) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	body := c.take()
+	c.mu.Unlock()
+	return c.send(body)
+}
+
+// send sends body, which was returned by take, without holding c.mu,
+// so that writes don't block on requests. Failed requests are not
+// retried beyond the client's retries, so that one bad request
+// doesn't block all later ones.
+func (c *Client) send(body []byte) error {
+	if body == nil {
+		return nil
+	}
+	defer c.sending.Done()
+	err := c.post(c.ctx, body)
+	c.mu.Lock()
+	c.failing = err != nil
+	c.mu.Unlock()
+	c.errs.Track(err)
+	return err
+}
+
+// post sends body, retrying temporary failures.
+func (c *Client) post(ctx context.Context, body []byte) error {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.postOnce(ctx, body)
+		var serr *StatusError
+		if err == nil || attempt >= c.retries || ctx.Err() != nil ||
+			(errors.As(err, &serr) && !serr.temporary()) {
+			return err
+		}
+		t := time.NewTimer(backoff)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) postOnce(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range c.header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.auth {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	res, err := c.hc.Do(req)
+	if err != nil {
+		return err
+	}
+	// Drain the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+	return nil
+}
+
+// Health reports the client as healthy until it is closed, and as
+// connected unless its last request failed.
+func (c *Client) Health() collectd.Health {
+	c.mu.Lock()
+	closed, failing, n := c.closed, c.failing, c.n
+	c.mu.Unlock()
+	err, when := c.errs.Last()
+	return collectd.Health{
+		Healthy:       !closed,
+		Connected:     !closed && !failing,
+		Queued:        n,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+// Close sends the buffered value lists, waits for requests in flight
+// and stops the background flushing.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return collectd.ErrClosed
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	close(c.done)
+	c.wg.Wait()
+	c.mu.Lock()
+	body := c.take()
+	c.mu.Unlock()
+	err := c.send(body)
+	c.sending.Wait()
+	c.cancel()
+	return err
+}
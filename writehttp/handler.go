@@ -0,0 +1,257 @@
+// Package writehttp implements collectd's write_http plugin protocol,
+// in which value lists and notifications are POSTed to an HTTP
+// endpoint, either as JSON or as PUTVAL and PUTNOTIF commands.
+// Handler receives such requests and Client sends them.
+package writehttp // import "honnef.co/go/collectd/writehttp"
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"honnef.co/go/collectd"
+	"honnef.co/go/collectd/internal/health"
+)
+
+// Handler is an http.Handler that accepts the requests of collectd's
+// write_http plugin, making Go services possible targets of its URL
+// option. Requests with a Content-Type of application/json are
+// decoded as collectd's JSON format, others as lines of PUTVAL and
+// PUTNOTIF commands, which is write_http's Command format.
+//
+// The request body is decoded and dispatched one value list at a
+// time, so that large bodies are not held in memory. If decoding or
+// dispatching fails, the request fails, but value lists that were
+// dispatched before remain dispatched.
+type Handler struct {
+	// Writer receives all value lists. If it is also a
+	// NotificationWriter, it receives notifications, which are
+	// otherwise dropped.
+	Writer collectd.Writer
+	// TypesDB is used to type values that lack data source types,
+	// and to check PUTVAL commands. If it is nil, such values are
+	// treated as gauges.
+	TypesDB collectd.TypesDB
+	// MaxBodySize, if positive, limits the size of request bodies.
+	MaxBodySize int64
+	// Logger, if not nil, receives errors returned by Writer.
+	Logger *slog.Logger
+
+	errs health.ErrorTracker
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// errWrite marks errors returned by the Writer, which are the
+// server's fault rather than the client's.
+type errWrite struct{ err error }
+
+func (e errWrite) Error() string { return e.err.Error() }
+
+// ServeHTTP decodes the request body and dispatches its contents.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body := r.Body
+	if h.MaxBodySize > 0 {
+		body = http.MaxBytesReader(w, body, h.MaxBodySize)
+	}
+	var err error
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/json" {
+		err = h.serveJSON(r.Context(), body)
+	} else {
+		err = h.serveCommands(r.Context(), body)
+	}
+	var werr errWrite
+	var maxErr *http.MaxBytesError
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusOK)
+	case errors.As(err, &werr):
+		http.Error(w, werr.Error(), http.StatusInternalServerError)
+	case errors.As(err, &maxErr):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (h *Handler) write(ctx context.Context, vl collectd.ValueList) error {
+	if err := h.Writer.Write(ctx, vl); err != nil {
+		h.log(ctx, "could not write value list", err)
+		return errWrite{err}
+	}
+	return nil
+}
+
+func (h *Handler) writeNotification(ctx context.Context, n collectd.Notification) error {
+	nw, ok := h.Writer.(collectd.NotificationWriter)
+	if !ok {
+		return nil
+	}
+	if err := nw.WriteNotification(ctx, n); err != nil {
+		h.log(ctx, "could not write notification", err)
+		return errWrite{err}
+	}
+	return nil
+}
+
+// serveCommands dispatches a body in write_http's Command format.
+func (h *Handler) serveCommands(ctx context.Context, body io.Reader) error {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(nil, 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		cmd, err := collectd.ParseCommand(line, h.TypesDB)
+		if err != nil {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+		switch cmd := cmd.(type) {
+		case *collectd.PutvalCommand:
+			for _, vl := range cmd.ValueLists {
+				if err := h.write(ctx, vl); err != nil {
+					return err
+				}
+			}
+		case *collectd.PutnotifCommand:
+			if err := h.writeNotification(ctx, cmd.Notification); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("line %d: unsupported command", n)
+		}
+	}
+	return sc.Err()
+}
+
+// jsonItem holds the fields needed to tell value lists and
+// notifications apart.
+type jsonItem struct {
+	Values json.RawMessage   `json:"values"`
+	Labels map[string]string `json:"labels"`
+}
+
+// jsonNotification is a notification in write_http's JSON format,
+// which follows the Prometheus Alertmanager's.
+type jsonNotification struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	StartsAt    string            `json:"startsAt"`
+}
+
+// serveJSON dispatches a body in collectd's JSON format.
+func (h *Handler) serveJSON(ctx context.Context, body io.Reader) error {
+	dec := json.NewDecoder(body)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("expected array, got %v", tok)
+		}
+		for dec.More() {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return err
+			}
+			if err := h.dispatchJSON(ctx, raw); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *Handler) dispatchJSON(ctx context.Context, raw json.RawMessage) error {
+	var item jsonItem
+	if err := json.Unmarshal(raw, &item); err != nil {
+		return err
+	}
+	if item.Values == nil && item.Labels != nil {
+		n, err := parseJSONNotification(raw)
+		if err != nil {
+			return err
+		}
+		return h.writeNotification(ctx, n)
+	}
+	d := collectd.NewJSONDecoder(io.MultiReader(strings.NewReader("["), bytes.NewReader(raw), strings.NewReader("]")), h.TypesDB)
+	vl, err := d.Decode()
+	if err != nil {
+		return err
+	}
+	return h.write(ctx, vl)
+}
+
+func parseJSONNotification(raw json.RawMessage) (collectd.Notification, error) {
+	var jn jsonNotification
+	if err := json.Unmarshal(raw, &jn); err != nil {
+		return collectd.Notification{}, err
+	}
+	sev, err := collectd.ParseSeverity(jn.Labels["severity"])
+	if err != nil {
+		return collectd.Notification{}, err
+	}
+	n := collectd.Notification{
+		Identifier: collectd.Identifier{
+			Host:           jn.Labels["instance"],
+			Plugin:         jn.Labels["plugin"],
+			PluginInstance: jn.Labels["plugin_instance"],
+			Type:           jn.Labels["type"],
+			TypeInstance:   jn.Labels["type_instance"],
+		},
+		Severity: sev,
+		Message:  jn.Annotations["summary"],
+	}
+	if jn.StartsAt != "" {
+		// collectd writes numeric time zones without a colon.
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05Z0700"} {
+			if n.Time, err = time.Parse(layout, jn.StartsAt); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return collectd.Notification{}, fmt.Errorf("invalid startsAt %q", jn.StartsAt)
+		}
+	}
+	return n, nil
+}
+
+// Health reports the handler as healthy and connected, along with the
+// last error returned by Writer.
+func (h *Handler) Health() collectd.Health {
+	err, when := h.errs.Last()
+	return collectd.Health{
+		Healthy:       true,
+		Connected:     true,
+		LastError:     err,
+		LastErrorTime: when,
+	}
+}
+
+func (h *Handler) log(ctx context.Context, msg string, err error) {
+	h.errs.Track(err)
+	if h.Logger != nil {
+		h.Logger.WarnContext(ctx, msg, "error", err)
+	}
+}
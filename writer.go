@@ -0,0 +1,222 @@
+package collectd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Writer submits value lists to a backend, such as a collectd
+// unix socket. Application code can be written against Writer and
+// swap backends at runtime.
+type Writer interface {
+	Write(ctx context.Context, vl ValueList) error
+}
+
+// WriterFunc adapts an ordinary function to the Writer interface.
+type WriterFunc func(ctx context.Context, vl ValueList) error
+
+// Write calls f(ctx, vl).
+func (f WriterFunc) Write(ctx context.Context, vl ValueList) error {
+	return f(ctx, vl)
+}
+
+// A NotificationWriter submits notifications.
+type NotificationWriter interface {
+	WriteNotification(ctx context.Context, n Notification) error
+}
+
+// NotificationWriterFunc adapts an ordinary function to the
+// NotificationWriter interface.
+type NotificationWriterFunc func(ctx context.Context, n Notification) error
+
+// WriteNotification calls f(ctx, n).
+func (f NotificationWriterFunc) WriteNotification(ctx context.Context, n Notification) error {
+	return f(ctx, n)
+}
+
+var (
+	_ Writer             = (*Conn)(nil)
+	_ NotificationWriter = (*Conn)(nil)
+)
+
+// Write submits a value list using PUTVAL. If the underlying
+// connection supports deadlines, the context's deadline is applied to
+// the command. Identifiers containing line breaks are rejected with
+// ErrLineBreak.
+func (c *Conn) Write(ctx context.Context, vl ValueList) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkValueList(vl); err != nil {
+		return err
+	}
+	_, err := c.command(ctx, formatPutval(vl, c.precision))
+	return err
+}
+
+// WriteNotification submits a notification using PUTNOTIF.
+// Like for Write, the context's deadline is applied to the command.
+// Notifications whose identifier or message contain line breaks are
+// rejected with ErrLineBreak.
+func (c *Conn) WriteNotification(ctx context.Context, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := checkNotification(n); err != nil {
+		return err
+	}
+	_, err := c.command(ctx, formatPutnotif(n, c.precision))
+	return err
+}
+
+// ErrLineBreak is returned when a field of a value list, notification
+// or command contains a line break. Because the plain text protocol
+// is line based, sending it would split the command in two and
+// desynchronize all following responses.
+var ErrLineBreak = errors.New("collectd: line break in command")
+
+// checkFields returns an error if any of fields contains a line
+// break.
+func checkFields(fields ...string) error {
+	for _, f := range fields {
+		if strings.ContainsAny(f, "\r\n") {
+			return fmt.Errorf("%w: %q", ErrLineBreak, f)
+		}
+	}
+	return nil
+}
+
+func checkValueList(vl ValueList) error {
+	id := vl.Identifier
+	return checkFields(id.Host, id.Plugin, id.PluginInstance, id.Type, id.TypeInstance)
+}
+
+func checkNotification(n Notification) error {
+	id := n.Identifier
+	return checkFields(id.Host, id.Plugin, id.PluginInstance, id.Type, id.TypeInstance, n.Message)
+}
+
+// FormatPutval returns the PUTVAL command that submits vl, without a
+// trailing newline. Times have millisecond resolution.
+func FormatPutval(vl ValueList) string {
+	return formatPutval(vl, 3)
+}
+
+// FormatPutnotif returns the PUTNOTIF command that submits n, without
+// a trailing newline. Times have millisecond resolution.
+func FormatPutnotif(n Notification) string {
+	return formatPutnotif(n, 3)
+}
+
+// FormatValues returns the time and values of vl, separated by
+// colons, as in the PUTVAL command. Times have millisecond
+// resolution.
+func FormatValues(vl ValueList) string {
+	return formatValues(vl, 3)
+}
+
+func formatValues(vl ValueList, prec int) string {
+	var b strings.Builder
+	b.WriteString(formatTime(vl.Time, prec))
+	for _, v := range vl.Values {
+		b.WriteByte(':')
+		b.WriteString(formatValue(v))
+	}
+	return b.String()
+}
+
+func formatPutnotif(n Notification, prec int) string {
+	var b strings.Builder
+	b.WriteString("PUTNOTIF")
+	opt := func(k, v string) {
+		if v != "" {
+			b.WriteString(" " + k + "=" + quote(v))
+		}
+	}
+	opt("severity", n.Severity.String())
+	t := n.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	b.WriteString(" time=" + formatTime(t, prec))
+	opt("host", n.Host)
+	opt("plugin", n.Plugin)
+	opt("plugin_instance", n.PluginInstance)
+	opt("type", n.Type)
+	opt("type_instance", n.TypeInstance)
+	b.WriteString(" message=" + quote(n.Message))
+	return b.String()
+}
+
+func formatPutval(vl ValueList, prec int) string {
+	var b strings.Builder
+	b.WriteString("PUTVAL ")
+	b.WriteString(quote(vl.Identifier.String()))
+	if vl.Interval > 0 {
+		b.WriteString(" interval=")
+		b.WriteString(strconv.FormatFloat(vl.Interval.Seconds(), 'f', -1, 64))
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValues(vl, prec))
+	return b.String()
+}
+
+// formatTime formats a timestamp for the plain text protocol, with
+// prec digits after the decimal point. The zero time is formatted as
+// N, meaning now.
+func formatTime(t time.Time, prec int) string {
+	if t.IsZero() {
+		return "N"
+	}
+	s := strconv.FormatInt(t.Unix(), 10)
+	if prec <= 0 {
+		return s
+	}
+	if prec > 9 {
+		prec = 9
+	}
+	frac := strconv.Itoa(t.Nanosecond() + 1e9)[1 : 1+prec]
+	return s + "." + frac
+}
+
+// formatValue formats a value for the plain text protocol. NaN
+// gauges are formatted as U, meaning undefined.
+func formatValue(v Value) string {
+	switch v := v.(type) {
+	case Gauge:
+		if math.IsNaN(float64(v)) {
+			return "U"
+		}
+		return strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case Derive:
+		return strconv.FormatInt(int64(v), 10)
+	case Counter:
+		return strconv.FormatUint(uint64(v), 10)
+	case Absolute:
+		return strconv.FormatUint(uint64(v), 10)
+	default:
+		return "U"
+	}
+}
+
+// quote returns s in double quotes, escaping quotes and backslashes.
+func quote(s string) string {
+	if !strings.ContainsAny(s, `"\`) {
+		return `"` + s + `"`
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}